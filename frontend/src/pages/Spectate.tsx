@@ -1,7 +1,7 @@
 import { useState, useEffect, useRef } from "react";
 import { useParams } from 'react-router-dom';
-import { MsgChat, MsgMove, MsgMoveStatus, MsgSync, MsgGameover } from "../types/game";
 import { GameState } from "../types/game";
+import { PROTOCOL_VERSION, ServerMsg } from "../types/protocol";
 import Navbar from "../components/Navbar";
 import {
   cellSize,
@@ -40,10 +40,26 @@ const Spectate: React.FC = () => {
   const [pname, setPname] = useState<string>("Black");
   const [opname, setOpname] = useState<string>("White");
   const [currentTurn, setCurrentTurn] = useState<boolean>(false);
+  const [viewers, setViewers] = useState<number>(0);
   const wsWsPrefix = import.meta.env.PROD ? "wss://" : "ws://";
 
   let playerTime = 900;
   let opponentTime = 900;
+  let paused = false;
+
+  // the clocks of spectator messages are the time spent by each color, the
+  // page shows the side the spectator watches from at the bottom
+  const setClocks = (blackTime: number, whiteTime: number) => {
+    const black = 900 - Math.round(blackTime / 1000);
+    const white = 900 - Math.round(whiteTime / 1000);
+    if (gameStateRef.current?.color === BLACK_CELL) {
+      playerTime = black;
+      opponentTime = white;
+    } else {
+      playerTime = white;
+      opponentTime = black;
+    }
+  };
 
   const getGameState = async () => {
     const socket = socketRef.current;
@@ -74,13 +90,12 @@ const Spectate: React.FC = () => {
   }
 
   const handleSocketRecv = async (data: any) => {
-    const msg: MsgMove | MsgMoveStatus | MsgSync | MsgGameover | MsgChat =
-      await JSON.parse(data);
+    const msg: ServerMsg = await JSON.parse(data);
     switch (msg.type) {
-      case "move":
+      case "spectatormove":
         if (gameStateRef.current) {
           const gameState = gameStateRef.current;
-          if (msg.move === "ps") {
+          if (msg.pass) {
             gameState.history.push(msg.move);
             gameState.turn = !gameState.turn;
             setCurrentTurn(gameState.turn);
@@ -89,52 +104,77 @@ const Spectate: React.FC = () => {
           } else {
             updateState(msg.state, msg.move);
           }
-          playerTime = 900 - Math.round(msg.selfTime / 1000);
-          opponentTime = 900 - Math.round(msg.opTime / 1000);
+          setClocks(msg.blackTime, msg.whiteTime);
+          setupClock();
+        }
+        break;
+
+      case "spectatorpause":
+        if (msg.kind === "adjourn" && msg.action === "accept") {
+          paused = true;
+          showEndMessage("Game adjourned");
+        } else if (msg.action === "accept") {
+          paused = true;
+          showMoveStatus("Game paused");
+        } else {
+          paused = false;
+          showMoveStatus("Game resumed");
         }
         break;
 
-      case "gameover":
+      case "spectatorend": {
         if (intervalRef.current) {
           clearInterval(intervalRef.current);
         }
-        showEndMessage(
-          msg.winner === gameStateRef.current?.color ?
-            `${pname} won` : `${opname} won`
-        );
+        const winner = msg.winner === gameStateRef.current?.color ?
+          gameStateRef.current?.pname : gameStateRef.current?.opname;
+        const score = msg.blackScore !== undefined ?
+          ` (${msg.blackScore} - ${msg.whiteScore})` : "";
+        showEndMessage(`${winner} won${score}`);
         socketRef.current?.close();
         break;
+      }
 
-      case "sync":
+      case "spectatorsync":
         if (gameStateRef.current) {
           const gameState = gameStateRef.current;
           gameState.gameId = msg.gameId;
-          gameState.color = msg.color;
-          gameState.pname = msg.pname;
-          gameState.opname = msg.opname;
-          gameState.turn = msg.turn;
+          gameState.color = msg.side;
+          gameState.pname = msg.side === BLACK_CELL ? msg.black : msg.white;
+          gameState.opname = msg.side === BLACK_CELL ? msg.white : msg.black;
+          gameState.turn = msg.turn === msg.side;
           
           setPname(gameState.pname)
           setOpname(gameState.opname)
           setCurrentTurn(gameState.turn);
 
+          // a sync replaces the board, the stones of an earlier one are
+          // cleared first
+          gameState.state = Array.from(
+            { length: 19 }, () => Array(19).fill(EMPTY_CELL)
+          );
           updateState(msg.state, "");
          
           // setting the turn here again, cuz updateState messes up with
           // turn as well
-          gameState.turn = msg.turn;
+          gameState.turn = msg.turn === msg.side;
 
           gameState.history = msg.history;
-          playerTime = 900 - Math.round(msg.selfTime / 1000);
-          opponentTime = 900 - Math.round(msg.opTime / 1000);
+          paused = msg.paused;
+          setClocks(msg.blackTime, msg.whiteTime);
           redrawCanvas(canvasRef, gameStateRef, ctxRef);
           setupClock();
           updateHistory(gameState.history);
         }
         break;
 
+      case "spectators":
+        setViewers(msg.count);
+        break;
+
+      // the spectator chat and the version the server speaks have no place
+      // on this page yet
       default:
-        socketRef.current?.close();
         break;
     }
   };
@@ -154,7 +194,8 @@ const Spectate: React.FC = () => {
 
     const wsurl = await getWsurl();
     socketRef.current = new WebSocket(
-      `${wsWsPrefix}${wsurl}/spectate/${gameId}?token=${token}`
+      `${wsWsPrefix}${wsurl}/spectate/${gameId}?token=${token}` +
+      `&v=${PROTOCOL_VERSION}`
     );
     if (socketRef.current) {
       socketRef.current.onmessage = async (event: MessageEvent) => {
@@ -262,7 +303,7 @@ const Spectate: React.FC = () => {
 
   useEffect(() => {
     intervalRef.current = window.setInterval(() => {
-      if (!gameStateRef.current) return;
+      if (!gameStateRef.current || paused) return;
       gameStateRef.current.turn === true ? playerTime -= 1 : opponentTime -= 1;
       updateClock();
     }, 1000);
@@ -515,6 +556,9 @@ const Spectate: React.FC = () => {
               <Text fontSize="lg" fontWeight="600" color="orange.200" mb={3}>
                 Game History
               </Text>
+              <Text fontSize="sm" color="whiteAlpha.700" mb={3}>
+                {viewers} watching
+              </Text>
               <Box
                 ref={historyDivRef}
                 display="flex"
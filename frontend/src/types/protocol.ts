@@ -0,0 +1,264 @@
+// Code generated by protogen from protocol.json. DO NOT EDIT.
+
+export const PROTOCOL_VERSION = 2;
+
+// ConditionalNode is one step of a conditional move tree. Reply is played as
+// soon as the opponent plays the move this node is keyed by, and Next holds
+// the replies to the opponent's following moves.
+export interface ConditionalNode {
+  reply: string;
+  next: Record<string, ConditionalNode>;
+}
+
+// HelloMsg is the first message of a connection that asked for a protocol
+// version, it carries the version the server speaks on it.
+export interface HelloMsg {
+  type: "hello";
+  version: number;
+}
+
+// ErrorMsg reports a failed request or a message the server refused.
+export interface ErrorMsg {
+  type: "error";
+  code: string;
+  message: string;
+}
+
+export interface StartMsg {
+  type: "start";
+  start: number;
+  color: number;
+  gameId: string;
+  opname: string;
+  opRating: number;
+  opRank: string;
+}
+
+// MoveMsg is a move played on the board. Binary connections get the stones
+// it captured instead of the whole board state.
+export interface MoveMsg {
+  type: "move";
+  move: string;
+  state: string;
+  selfTime: number;
+  opTime: number;
+  captures?: string[];
+}
+
+export interface AbortMsg {
+  type: "abort";
+}
+
+export interface GameOverMsg {
+  type: "gameover";
+  winner: number;
+  message: string;
+}
+
+// MoveStatusMsg answers a move of the player. Binary connections get the
+// stones it captured instead of the whole board state.
+export interface MoveStatusMsg {
+  type: "movestatus";
+  turnStatus: boolean;
+  moveStatus: boolean;
+  state: string;
+  selfTime: number;
+  opTime: number;
+  move: string;
+  captures?: string[];
+}
+
+export interface ReqStateMsg {
+  type: "reqState";
+}
+
+export interface SyncMsg {
+  type: "sync";
+  gameId: string;
+  pname: string;
+  opname: string;
+  color: number;
+  turn: boolean;
+  state: string;
+  history: string[];
+  selfTime: number;
+  opTime: number;
+  rank: string;
+  opRank: string;
+}
+
+export interface ConditionalMsg {
+  type: "conditional";
+  tree: Record<string, ConditionalNode>;
+}
+
+export interface ConditionalStatusMsg {
+  type: "conditionalstatus";
+  accepted: boolean;
+  message: string;
+}
+
+// AnalysisReqMsg asks for a score estimate or a move hint.
+export interface AnalysisReqMsg {
+  type: "estimate" | "hint";
+}
+
+// EstimateMsg gives the ownership of every point, indexed by row*size+col,
+// as 1 for black, -1 for white and 0 for neutral. Margin is positive when
+// black is ahead.
+export interface EstimateMsg {
+  type: "estimate";
+  score: string;
+  margin: number;
+  ownership: number[];
+  error?: string;
+}
+
+export interface HintMsg {
+  type: "hint";
+  move: string;
+  error?: string;
+}
+
+export interface MaintenanceMsg {
+  type: "maintenance";
+  message: string;
+  deadline: string;
+}
+
+// HandoffMsg tells the client that its game has moved to another websocket
+// server, where it reconnects.
+export interface HandoffMsg {
+  type: "handoff";
+  gameId: string;
+  wsurl: string;
+}
+
+// PauseMsg offers, accepts or declines a pause or an adjournment. A paused
+// game is resumed in the same way, with the resume, resumeaccept and
+// resumedecline actions, and the server sends resumed once the clocks run
+// again.
+export interface PauseMsg {
+  type: "pause" | "adjourn";
+  action: string;
+  selfTime: number;
+  opTime: number;
+}
+
+export interface AdjournedMsg {
+  type: "adjourned";
+  gameId: string;
+}
+
+export interface RematchMsg {
+  type: "rematch";
+  action: string;
+  gameId: string;
+}
+
+export interface ChatMsg {
+  type: "chat";
+  message: string;
+}
+
+// SpectatorsMsg is sent to the players and spectators of a game when someone
+// starts or stops watching it. Viewers leaves out the spectators who watch
+// anonymously.
+export interface SpectatorsMsg {
+  type: "spectators";
+  count: number;
+  viewers: string[];
+}
+
+// SpectatorChatMsg is a chat message between spectators, the players do not
+// get it. Spectators of games with public chat also get the players' chat as
+// playerchat.
+export interface SpectatorChatMsg {
+  type: "spectatorchat" | "playerchat";
+  username: string;
+  message: string;
+}
+
+// SpectatorSyncMsg is the state of a game as spectators see it, behind by
+// the broadcast delay of the game. Side is the color the spectator chose to
+// watch from.
+export interface SpectatorSyncMsg {
+  type: "spectatorsync";
+  gameId: string;
+  black: string;
+  white: string;
+  side: number;
+  turn: number;
+  state: string;
+  history: string[];
+  blackTime: number;
+  whiteTime: number;
+  paused: boolean;
+  delayMoves?: number;
+  delaySeconds?: number;
+}
+
+// SpectatorMoveMsg is a move or a pass, with the clocks of both players
+// after it.
+export interface SpectatorMoveMsg {
+  type: "spectatormove";
+  move: string;
+  color: number;
+  pass: boolean;
+  state: string;
+  captures?: string[];
+  blackTime: number;
+  whiteTime: number;
+}
+
+// SpectatorPauseMsg tells spectators that a game was paused or adjourned,
+// Kind being pause or adjourn, and that it went on again.
+export interface SpectatorPauseMsg {
+  type: "spectatorpause";
+  kind: string;
+  action: string;
+}
+
+// SpectatorEndMsg is the end of a game. A game ended by two passes comes
+// with the score of both players, komi included.
+export interface SpectatorEndMsg {
+  type: "spectatorend";
+  winner: number;
+  message: string;
+  blackScore?: number;
+  whiteScore?: number;
+}
+
+export type ClientMsg =
+  | MoveMsg
+  | AbortMsg
+  | ReqStateMsg
+  | ConditionalMsg
+  | AnalysisReqMsg
+  | PauseMsg
+  | RematchMsg
+  | ChatMsg;
+
+export type ServerMsg =
+  | HelloMsg
+  | ErrorMsg
+  | StartMsg
+  | MoveMsg
+  | GameOverMsg
+  | MoveStatusMsg
+  | SyncMsg
+  | ConditionalStatusMsg
+  | EstimateMsg
+  | HintMsg
+  | MaintenanceMsg
+  | HandoffMsg
+  | PauseMsg
+  | AdjournedMsg
+  | RematchMsg
+  | ChatMsg
+  | SpectatorsMsg
+  | SpectatorChatMsg
+  | SpectatorSyncMsg
+  | SpectatorMoveMsg
+  | SpectatorPauseMsg
+  | SpectatorEndMsg;
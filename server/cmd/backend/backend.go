@@ -52,25 +52,63 @@ func main() {
 
 	r.GET("/profile", routes.Profile)
 	r.GET("/review", routes.Review)
+	r.GET("/review/analysis", routes.ReviewAnalysis)
+	r.GET("/review/spectatorchat", routes.ReviewSpectatorChat)
 	r.GET("/findgame", middleware.HttpAuth, routes.FindGame)
 	r.GET("/getwsurl", middleware.HttpAuth, routes.GetWsurl)
+	r.GET("/seeks", routes.GetSeeks)
+	r.GET("/lobby", middleware.WsAuth, routes.Lobby)
+	r.GET("/tournament/:id", routes.GetTournament)
+	r.GET("/tournament/:id/standings", routes.GetTournamentStandings)
+	r.GET("/tournament/:id/live", routes.TournamentLive)
+	r.GET("/arena/:id", routes.GetArenaLeaderboard)
+	r.GET("/arena/:id/live", routes.ArenaLive)
+	r.GET("/arena/:id/findgame", middleware.HttpAuth, routes.ArenaFindGame)
+	r.GET("/ladder/:id", routes.GetLadder)
+	r.GET("/challenges", middleware.HttpAuth, routes.GetChallenges)
+	r.GET("/botapi", middleware.WsAuth, routes.BotApi)
+	r.GET("/leaderboard", routes.Leaderboard)
+	r.GET("/leaderboard/rank", routes.LeaderboardRank)
+	r.GET("/leaderboard/movers", routes.LeaderboardMovers)
+	r.GET("/livegames", routes.LiveGames)
+	r.GET("/livegames/feed", routes.LiveGamesFeed)
 
 	r.POST("/login", routes.Login)
 	r.POST("/signup", routes.Signup)
 	r.POST("/changeusername", middleware.HttpAuth, routes.ChangeUsername)
+	r.POST("/seek", middleware.HttpAuth, routes.CreateSeek)
+	r.POST("/seek/:id/accept", middleware.HttpAuth, routes.AcceptSeek)
+	r.POST("/tournament", middleware.HttpAuth, routes.CreateTournament)
+	r.POST("/tournament/:id/register", middleware.HttpAuth, routes.RegisterTournament)
+	r.POST("/tournament/:id/start", middleware.HttpAuth, routes.StartTournament)
+	r.POST("/arena", middleware.HttpAuth, routes.CreateArena)
+	r.POST("/arena/:id/join", middleware.HttpAuth, routes.JoinArena)
+	r.POST("/ladder", middleware.HttpAuth, routes.CreateLadder)
+	r.POST("/ladder/:id/join", middleware.HttpAuth, routes.JoinLadder)
+	r.POST("/ladder/:id/challenge", middleware.HttpAuth, routes.CreateChallenge)
+	r.POST("/challenge/:id", middleware.HttpAuth, routes.AnswerChallenge)
+	r.POST("/bot", middleware.HttpAuth, routes.CreateBot)
+	r.POST("/bot/:username/key", middleware.HttpAuth, routes.NewBotKey)
+	r.POST("/bot/:username/challenge", middleware.HttpAuth, routes.ChallengeBot)
+
+	r.DELETE("/seek/:id", middleware.HttpAuth, routes.CancelSeek)
 
 	if err := godotenv.Load("../../.dev.env"); err != nil {
 		log.Println("Error loading env variables: ", err)
 	}
 
-	routes.Pe = new(routes.PlayerExists)
-	routes.Pe.Ch = make(chan routes.GameStarterData)
-	routes.Pe.Exists = false
-
 	db := database.GetDatabase()
 	defer db.Close()
+	if err := database.Migrate(); err != nil {
+		log.Fatalf("Could not migrate the database: %v\n", err)
+	}
 
 	setupRedis()
 
+	go routes.RunLeaderboardSnapshots()
+	go routes.RunSeekExpiry()
+	go routes.RunTournamentForfeits()
+	go routes.RunChallengeExpiry()
+
 	r.Run()
 }
@@ -0,0 +1,315 @@
+// gtpbridge connects a local GTP engine to the server as a bot account. It
+// waits for game offers on the bot API, accepts them while the engine is
+// free, and plays the games over the regular game websocket.
+//
+//	gtpbridge -api ws://localhost:8080 -token 4<key> -engine "gnugo --mode gtp"
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vanshjangir/rapid-go/server/internal/protocol"
+)
+
+const (
+	WHITE = 0
+	BLACK = 1
+
+	// the server scores games with this komi, core.DEFAULT_KOMI
+	KOMI = 7.5
+
+	RECONNECT_DELAY = 5 * time.Second
+
+	// an accepted offer that does not turn into a game within this time
+	// frees the engine again
+	START_TIMEOUT = 10 * time.Second
+)
+
+var (
+	apiUrl    = flag.String("api", "ws://localhost:8080", "backend websocket base url")
+	token     = flag.String("token", "", "API token of the bot account")
+	engineCmd = flag.String("engine", "gnugo --mode gtp", "GTP engine command")
+	secure    = flag.Bool("secure", false, "use wss to connect to games")
+)
+
+type Engine struct {
+	cmd    *exec.Cmd
+	stdin  *bufio.Writer
+	stdout *bufio.Scanner
+}
+
+// Message holds the fields of all the messages the bridge reads, from the
+// bot API and from games. Game messages are sent with the protocol types,
+// the server refuses fields a message does not have.
+type Message struct {
+	Type       string `json:"type"`
+	Id         string `json:"id"`
+	Challenger string `json:"challenger"`
+	GameId     string `json:"gameId"`
+	Color      int    `json:"color"`
+	Size       int    `json:"size"`
+	Wsurl      string `json:"wsurl"`
+	Start      int    `json:"start"`
+	Move       string `json:"move"`
+	MoveStatus bool   `json:"moveStatus"`
+	TurnStatus bool   `json:"turnStatus"`
+	Winner     int    `json:"winner"`
+	Message    string `json:"message"`
+}
+
+func startEngine(cmdline string) (*Engine, error) {
+	args := strings.Fields(cmdline)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty engine command")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	stdinPipe, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &Engine{
+		cmd:    cmd,
+		stdin:  bufio.NewWriter(stdinPipe),
+		stdout: bufio.NewScanner(stdoutPipe),
+	}, nil
+}
+
+// Send runs a GTP command and returns the response without the leading
+// "=", or the error message of a failed command.
+func (e *Engine) Send(cmd string) (string, error) {
+	e.stdin.WriteString(cmd + "\n")
+	e.stdin.Flush()
+
+	var res string
+	for e.stdout.Scan() {
+		line := e.stdout.Text()
+		if line == "" {
+			break
+		}
+		res += line + "\n"
+	}
+
+	res = strings.TrimSpace(res)
+	if strings.HasPrefix(res, "=") {
+		return strings.TrimSpace(res[1:]), nil
+	}
+	if strings.HasPrefix(res, "?") {
+		return "", fmt.Errorf("%v: %v", cmd, strings.TrimSpace(res[1:]))
+	}
+	return "", fmt.Errorf("%v: no response from engine", cmd)
+}
+
+// Moves on the server are a lowercase column letter from 'a' and a row
+// counted from 0, or "ps" for a pass. GTP vertices skip the letter I and
+// count rows from 1.
+
+func toVertex(move string) string {
+	if move == "ps" {
+		return "pass"
+	}
+
+	col := move[0]
+	row, _ := strconv.Atoi(move[1:])
+	if col >= 'i' {
+		col++
+	}
+	return strings.ToUpper(string(col)) + strconv.Itoa(row+1)
+}
+
+func fromVertex(vertex string) string {
+	vertex = strings.ToLower(vertex)
+	if vertex == "pass" {
+		return "ps"
+	}
+
+	col := vertex[0]
+	row, _ := strconv.Atoi(vertex[1:])
+	if col > 'i' {
+		col--
+	}
+	return string(col) + strconv.Itoa(row-1)
+}
+
+func colorName(color int) string {
+	if color == BLACK {
+		return "black"
+	}
+	return "white"
+}
+
+func playEngineMove(e *Engine, conn *websocket.Conn, color int) error {
+	vertex, err := e.Send("genmove " + colorName(color))
+	if err != nil {
+		return err
+	}
+
+	if strings.ToLower(vertex) == "resign" {
+		return conn.WriteJSON(protocol.AbortMsg{Type: "abort"})
+	}
+	return conn.WriteJSON(
+		protocol.MoveMsg{Type: "move", Move: fromVertex(vertex)},
+	)
+}
+
+func playGame(e *Engine, start Message) error {
+	scheme := "ws"
+	if *secure {
+		scheme = "wss"
+	}
+	gameUrl := fmt.Sprintf(
+		"%s://%s/game?token=%s", scheme, start.Wsurl, url.QueryEscape(*token),
+	)
+
+	conn, _, err := websocket.DefaultDialer.Dial(gameUrl, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, cmd := range []string{
+		fmt.Sprintf("boardsize %d", start.Size),
+		"clear_board",
+		fmt.Sprintf("komi %.1f", KOMI),
+	} {
+		if _, err := e.Send(cmd); err != nil {
+			return err
+		}
+	}
+
+	color := start.Color
+	for {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+
+		switch {
+		case msg.Start == 1:
+			log.Println("Game started", msg.GameId, "as", colorName(color))
+			if color == BLACK {
+				if err := playEngineMove(e, conn, color); err != nil {
+					return err
+				}
+			}
+
+		case msg.Type == "move":
+			if _, err := e.Send(
+				"play " + colorName(1-color) + " " + toVertex(msg.Move),
+			); err != nil {
+				return err
+			}
+			if err := playEngineMove(e, conn, color); err != nil {
+				return err
+			}
+
+		case msg.Type == "movestatus" && !msg.MoveStatus && msg.TurnStatus:
+			// the server refused the engine's move, take it back and pass
+			log.Println("Move refused by server:", msg.Move)
+			if _, err := e.Send("undo"); err != nil {
+				return err
+			}
+			if _, err := e.Send("play " + colorName(color) + " pass"); err != nil {
+				return err
+			}
+			pass := protocol.MoveMsg{Type: "move", Move: "ps"}
+			if err := conn.WriteJSON(pass); err != nil {
+				return err
+			}
+
+		case msg.Type == "gameover":
+			log.Println("Game over", start.GameId, msg.Message)
+			return nil
+		}
+	}
+}
+
+func serveOffers(e *Engine) error {
+	conn, _, err := websocket.DefaultDialer.Dial(
+		*apiUrl+"/botapi?token="+url.QueryEscape(*token), nil,
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	log.Println("Waiting for offers")
+
+	// busy is set from accepting an offer until the game is over, so the
+	// engine plays one game at a time
+	var busy, playing atomic.Bool
+	for {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+
+		switch msg.Type {
+		case "offer":
+			answer := "decline"
+			if busy.CompareAndSwap(false, true) {
+				answer = "accept"
+				time.AfterFunc(START_TIMEOUT, func() {
+					if !playing.Load() {
+						busy.Store(false)
+					}
+				})
+			}
+			log.Println("Offer from", msg.Challenger, answer)
+			if err := conn.WriteJSON(Message{Type: answer, Id: msg.Id}); err != nil {
+				return err
+			}
+
+		case "start":
+			playing.Store(true)
+			go func(start Message) {
+				defer busy.Store(false)
+				defer playing.Store(false)
+				if err := playGame(e, start); err != nil {
+					log.Println("Error in game", start.GameId, err)
+				}
+			}(msg)
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *token == "" {
+		log.Fatal("-token is required")
+	}
+
+	e, err := startEngine(*engineCmd)
+	if err != nil {
+		log.Fatal("Error starting engine: ", err)
+	}
+	defer e.cmd.Process.Kill()
+
+	if _, err := e.Send("protocol_version"); err != nil {
+		log.Fatal("Engine does not speak GTP: ", err)
+	}
+
+	for {
+		if err := serveOffers(e); err != nil {
+			log.Println("Bot API connection lost:", err)
+		}
+		time.Sleep(RECONNECT_DELAY)
+	}
+}
@@ -0,0 +1,462 @@
+// protogen generates the Go and TypeScript types of the game protocol from
+// its definition, along with the protobuf encoding of the messages for
+// binary connections. It is run by go generate in internal/protocol.
+//
+//	protogen -in protocol.json -go messages_gen.go -ts protocol.ts -proto protocol.proto
+//
+// The protobuf field numbers follow the order of the fields, a message's type
+// being field 1, so new fields go at the end of a message.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+)
+
+const HEADER = "// Code generated by protogen from protocol.json. DO NOT EDIT.\n"
+
+var (
+	inFile    = flag.String("in", "protocol.json", "protocol definition")
+	goFile    = flag.String("go", "messages_gen.go", "generated Go file")
+	tsFile    = flag.String("ts", "", "generated TypeScript file")
+	protoFile = flag.String("proto", "", "generated protobuf definition")
+)
+
+var primitives = map[string]bool{
+	"string": true, "int": true, "int64": true, "float64": true,
+	"bool": true, "time.Time": true,
+}
+
+type Field struct {
+	Name     string `json:"name"`
+	Json     string `json:"json"`
+	Type     string `json:"type"`
+	Optional bool   `json:"optional"`
+	Min      int    `json:"min"`
+	Max      int    `json:"max"`
+
+	// Format "move" only takes a pass or a point of the largest board
+	Format string `json:"format"`
+
+	// JsonOnly fields are left out of the protobuf encoding
+	JsonOnly bool `json:"jsonOnly"`
+}
+
+// Type is a message, which has a type field and is sent on the websocket,
+// or a type used inside messages.
+type Type struct {
+	Name   string   `json:"name"`
+	Types  []string `json:"types"`
+	From   string   `json:"from"`
+	Doc    string   `json:"doc"`
+	Fields []Field  `json:"fields"`
+}
+
+type Definition struct {
+	Version  int    `json:"version"`
+	Types    []Type `json:"types"`
+	Messages []Type `json:"messages"`
+}
+
+func (t Type) fromClient() bool {
+	return t.From == "client" || t.From == "both"
+}
+
+func (t Type) fromServer() bool {
+	return t.From == "server" || t.From == "both"
+}
+
+// comment wraps doc into lines of at most 77 characters with the prefix.
+func comment(buf *bytes.Buffer, prefix string, doc string) {
+	if doc == "" {
+		return
+	}
+
+	line := prefix
+	for _, word := range strings.Fields(doc) {
+		if len(line)+len(word)+1 > 77 && line != prefix {
+			buf.WriteString(line + "\n")
+			line = prefix
+		}
+		line += " " + word
+	}
+	buf.WriteString(line + "\n")
+}
+
+// elemType returns the named type inside a slice or map field, if any.
+func elemType(goType string) string {
+	t := strings.TrimPrefix(goType, "[]")
+	t = strings.TrimPrefix(t, "map[string]")
+	t = strings.TrimPrefix(t, "*")
+	if primitives[t] {
+		return ""
+	}
+	return t
+}
+
+// number is the protobuf field number of the i-th field.
+func number(i int, message bool) int {
+	if message {
+		return i + 2
+	}
+	return i + 1
+}
+
+func protoType(goType string) string {
+	switch {
+	case strings.HasPrefix(goType, "[]"):
+		return "repeated " + protoType(goType[2:])
+	case strings.HasPrefix(goType, "map[string]"):
+		return "map<string, " + protoType(goType[len("map[string]"):]) + ">"
+	case strings.HasPrefix(goType, "*"):
+		return protoType(goType[1:])
+	}
+
+	switch goType {
+	case "string", "bool", "int64":
+		return goType
+	case "int":
+		return "sint32"
+	case "float64":
+		return "double"
+	case "time.Time":
+		return "int64"
+	}
+	return goType
+}
+
+// appendCall returns the statement encoding a field.
+func appendCall(f Field, num int) string {
+	switch f.Type {
+	case "string":
+		return fmt.Sprintf("b = appendString(b, %d, m.%s)\n", num, f.Name)
+	case "int":
+		return fmt.Sprintf("b = appendSint(b, %d, m.%s)\n", num, f.Name)
+	case "int64":
+		return fmt.Sprintf("b = appendInt(b, %d, m.%s)\n", num, f.Name)
+	case "float64":
+		return fmt.Sprintf("b = appendDouble(b, %d, m.%s)\n", num, f.Name)
+	case "bool":
+		return fmt.Sprintf("b = appendBool(b, %d, m.%s)\n", num, f.Name)
+	case "time.Time":
+		return fmt.Sprintf("b = appendTime(b, %d, m.%s)\n", num, f.Name)
+	case "[]string":
+		return fmt.Sprintf("b = appendStrings(b, %d, m.%s)\n", num, f.Name)
+	case "[]int":
+		return fmt.Sprintf("b = appendSints(b, %d, m.%s)\n", num, f.Name)
+	}
+
+	if strings.HasPrefix(f.Type, "map[string]*") {
+		return fmt.Sprintf(`for k, v := range m.%s {
+			entry := appendString(nil, 1, k)
+			if v != nil {
+				entry = appendMessage(entry, 2, v.AppendProto(nil))
+			}
+			b = appendMessage(b, %d, entry)
+		}
+		`, f.Name, num)
+	}
+	log.Fatalf("field %v has unsupported type %v", f.Name, f.Type)
+	return ""
+}
+
+// consumeCall returns the statement decoding a field.
+func consumeCall(f Field) string {
+	switch f.Type {
+	case "string":
+		return fmt.Sprintf("return consumeString(b, typ, &m.%s)\n", f.Name)
+	case "int":
+		return fmt.Sprintf("return consumeSint(b, typ, &m.%s)\n", f.Name)
+	case "int64":
+		return fmt.Sprintf("return consumeInt(b, typ, &m.%s)\n", f.Name)
+	case "float64":
+		return fmt.Sprintf("return consumeDouble(b, typ, &m.%s)\n", f.Name)
+	case "bool":
+		return fmt.Sprintf("return consumeBool(b, typ, &m.%s)\n", f.Name)
+	case "time.Time":
+		return fmt.Sprintf("return consumeTime(b, typ, &m.%s)\n", f.Name)
+	case "[]string":
+		return fmt.Sprintf("return consumeStrings(b, typ, &m.%s)\n", f.Name)
+	case "[]int":
+		return fmt.Sprintf("return consumeSints(b, typ, &m.%s)\n", f.Name)
+	}
+
+	elem := elemType(f.Type)
+	return fmt.Sprintf(`return consumeEntry(b, typ, func(key string, value []byte) error {
+			v := new(%s)
+			if err := v.UnmarshalProto(value); err != nil {
+				return err
+			}
+			if m.%s == nil {
+				m.%s = %s{}
+			}
+			m.%s[key] = v
+			return nil
+		})
+		`, elem, f.Name, f.Name, f.Type, f.Name)
+}
+
+func writeProtoMethods(buf *bytes.Buffer, t Type, message bool) {
+	fmt.Fprintf(buf, "func (m %s) AppendProto(b []byte) []byte {\n", t.Name)
+	if message {
+		buf.WriteString("b = appendString(b, 1, m.Type)\n")
+	}
+	for i, f := range t.Fields {
+		if !f.JsonOnly {
+			buf.WriteString(appendCall(f, number(i, message)))
+		}
+	}
+	buf.WriteString("return b\n}\n\n")
+
+	fmt.Fprintf(buf, "func (m *%s) UnmarshalProto(b []byte) error {\n", t.Name)
+	buf.WriteString("return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {\n")
+	buf.WriteString("switch num {\n")
+	if message {
+		buf.WriteString("case 1:\nreturn consumeString(b, typ, &m.Type)\n")
+	}
+	for i, f := range t.Fields {
+		if !f.JsonOnly {
+			fmt.Fprintf(buf, "case %d:\n%s", number(i, message), consumeCall(f))
+		}
+	}
+	buf.WriteString("}\nreturn protowire.ConsumeFieldValue(num, typ, b)\n})\n}\n\n")
+}
+
+func tsType(goType string) string {
+	switch {
+	case strings.HasPrefix(goType, "[]"):
+		return tsType(goType[2:]) + "[]"
+	case strings.HasPrefix(goType, "map[string]"):
+		return "Record<string, " + tsType(goType[len("map[string]"):]) + ">"
+	case strings.HasPrefix(goType, "*"):
+		return tsType(goType[1:])
+	}
+
+	switch goType {
+	case "string", "time.Time":
+		return "string"
+	case "int", "int64", "float64":
+		return "number"
+	case "bool":
+		return "boolean"
+	}
+	return goType
+}
+
+func writeValidate(buf *bytes.Buffer, t Type) {
+	fmt.Fprintf(buf, "func (m *%s) Validate() error {\n", t.Name)
+	for _, f := range t.Fields {
+		if f.Min == 1 {
+			fmt.Fprintf(buf, "if m.%s == \"\" {\n", f.Name)
+			fmt.Fprintf(buf, "return fmt.Errorf(\"%s is empty\")\n}\n", f.Json)
+		} else if f.Min > 0 {
+			fmt.Fprintf(buf, "if utf8.RuneCountInString(m.%s) < %d {\n", f.Name, f.Min)
+			fmt.Fprintf(buf, "return fmt.Errorf(\"%s is shorter than %d characters\")\n}\n", f.Json, f.Min)
+		}
+		if f.Max > 0 {
+			fmt.Fprintf(buf, "if utf8.RuneCountInString(m.%s) > %d {\n", f.Name, f.Max)
+			fmt.Fprintf(buf, "return fmt.Errorf(\"%s is longer than %d characters\")\n}\n", f.Json, f.Max)
+		}
+		if f.Format == "move" {
+			fmt.Fprintf(buf, "if !ValidMove(m.%s) {\n", f.Name)
+			fmt.Fprintf(buf, "return fmt.Errorf(\"%s is not a point or a pass\")\n}\n", f.Json)
+		}
+		if elemType(f.Type) != "" {
+			fmt.Fprintf(buf, "for _, v := range m.%s {\n", f.Name)
+			if strings.Contains(f.Type, "*") {
+				buf.WriteString("if v == nil {\ncontinue\n}\n")
+			}
+			buf.WriteString("if err := v.Validate(); err != nil {\nreturn err\n}\n}\n")
+		}
+	}
+	buf.WriteString("return nil\n}\n\n")
+}
+
+func writeStruct(buf *bytes.Buffer, t Type, message bool) {
+	comment(buf, "//", t.Doc)
+	fmt.Fprintf(buf, "type %s struct {\n", t.Name)
+	if message {
+		buf.WriteString("Type string `json:\"type\"`\n")
+	}
+	for _, f := range t.Fields {
+		tag := f.Json
+		if f.Optional {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(buf, "%s %s `json:\"%s\"`\n", f.Name, f.Type, tag)
+	}
+	buf.WriteString("}\n\n")
+	writeValidate(buf, t)
+	writeProtoMethods(buf, t, message)
+}
+
+func generateGo(def Definition) ([]byte, error) {
+	var body bytes.Buffer
+	for _, t := range def.Types {
+		writeStruct(&body, t, false)
+	}
+	for _, t := range def.Messages {
+		writeStruct(&body, t, true)
+	}
+
+	body.WriteString("// clientMessages are the messages a client can send, by type.\n")
+	body.WriteString("var clientMessages = map[string]func() Message{\n")
+	for _, t := range def.Messages {
+		if !t.fromClient() {
+			continue
+		}
+		for _, name := range t.Types {
+			fmt.Fprintf(&body, "%q: func() Message { return new(%s) },\n", name, t.Name)
+		}
+	}
+	body.WriteString("}\n\n")
+
+	body.WriteString("// serverMessages are the messages the server sends, by type.\n")
+	body.WriteString("var serverMessages = map[string]func() Message{\n")
+	for _, t := range def.Messages {
+		if !t.fromServer() {
+			continue
+		}
+		for _, name := range t.Types {
+			fmt.Fprintf(&body, "%q: func() Message { return new(%s) },\n", name, t.Name)
+		}
+	}
+	body.WriteString("}\n")
+
+	var buf bytes.Buffer
+	buf.WriteString(HEADER + "\npackage protocol\n\nimport (\n")
+	buf.WriteString("\"fmt\"\n")
+	if strings.Contains(body.String(), "time.Time") {
+		buf.WriteString("\"time\"\n")
+	}
+	buf.WriteString("\"unicode/utf8\"\n\n")
+	buf.WriteString("\"google.golang.org/protobuf/encoding/protowire\"\n)\n\n")
+	buf.WriteString("// VERSION is the newest version of the protocol.\n")
+	fmt.Fprintf(&buf, "const VERSION = %d\n\n", def.Version)
+	buf.Write(body.Bytes())
+
+	return format.Source(buf.Bytes())
+}
+
+func writeInterface(buf *bytes.Buffer, t Type, message bool) {
+	comment(buf, "//", t.Doc)
+	fmt.Fprintf(buf, "export interface %s {\n", t.Name)
+	if message {
+		types := make([]string, len(t.Types))
+		for i, name := range t.Types {
+			types[i] = fmt.Sprintf("%q", name)
+		}
+		fmt.Fprintf(buf, "  type: %s;\n", strings.Join(types, " | "))
+	}
+	for _, f := range t.Fields {
+		optional := ""
+		if f.Optional {
+			optional = "?"
+		}
+		fmt.Fprintf(buf, "  %s%s: %s;\n", f.Json, optional, tsType(f.Type))
+	}
+	buf.WriteString("}\n\n")
+}
+
+func union(buf *bytes.Buffer, name string, messages []Type, from func(Type) bool) {
+	names := []string{}
+	for _, t := range messages {
+		if from(t) {
+			names = append(names, t.Name)
+		}
+	}
+	fmt.Fprintf(buf, "export type %s =\n  | %s;\n", name, strings.Join(names, "\n  | "))
+}
+
+func generateTs(def Definition) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(HEADER + "\n")
+	fmt.Fprintf(&buf, "export const PROTOCOL_VERSION = %d;\n\n", def.Version)
+	for _, t := range def.Types {
+		writeInterface(&buf, t, false)
+	}
+	for _, t := range def.Messages {
+		writeInterface(&buf, t, true)
+	}
+	union(&buf, "ClientMsg", def.Messages, Type.fromClient)
+	buf.WriteString("\n")
+	union(&buf, "ServerMsg", def.Messages, Type.fromServer)
+	return buf.Bytes()
+}
+
+func writeProtoMessage(buf *bytes.Buffer, t Type, message bool) {
+	comment(buf, "//", t.Doc)
+	fmt.Fprintf(buf, "message %s {\n", t.Name)
+	if message {
+		buf.WriteString("  string type = 1;\n")
+	}
+	for i, f := range t.Fields {
+		num := number(i, message)
+		if f.JsonOnly {
+			fmt.Fprintf(buf, "  reserved %d; // %s, only sent as JSON\n", num, f.Json)
+			continue
+		}
+		fmt.Fprintf(buf, "  %s %s = %d;", protoType(f.Type), f.Json, num)
+		if f.Type == "time.Time" {
+			buf.WriteString(" // milliseconds since the epoch")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n\n")
+}
+
+func generateProto(def Definition) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(HEADER + "\n")
+	buf.WriteString("syntax = \"proto3\";\n\npackage rapidgo;\n\n")
+	comment(&buf, "//", "Every message has its type as field 1, a client reads an "+
+		"Envelope first to learn which message it got.")
+	buf.WriteString("message Envelope {\n  string type = 1;\n}\n\n")
+	for _, t := range def.Types {
+		writeProtoMessage(&buf, t, false)
+	}
+	for _, t := range def.Messages {
+		writeProtoMessage(&buf, t, true)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func main() {
+	flag.Parse()
+
+	jsondata, err := os.ReadFile(*inFile)
+	if err != nil {
+		log.Fatal("Error reading definition: ", err)
+	}
+
+	var def Definition
+	if err := json.Unmarshal(jsondata, &def); err != nil {
+		log.Fatal("Error parsing definition: ", err)
+	}
+
+	src, err := generateGo(def)
+	if err != nil {
+		log.Fatal("Error formatting Go types: ", err)
+	}
+	if err := os.WriteFile(*goFile, src, 0644); err != nil {
+		log.Fatal("Error writing Go types: ", err)
+	}
+
+	if *tsFile != "" {
+		if err := os.WriteFile(*tsFile, generateTs(def), 0644); err != nil {
+			log.Fatal("Error writing TypeScript types: ", err)
+		}
+	}
+
+	if *protoFile != "" {
+		if err := os.WriteFile(*protoFile, generateProto(def), 0644); err != nil {
+			log.Fatal("Error writing protobuf definition: ", err)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 	"crypto/tls"
 
 	"github.com/gin-contrib/cors"
@@ -13,6 +19,7 @@ import (
 
 	"github.com/vanshjangir/rapid-go/server/internal/core"
 	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
 	"github.com/vanshjangir/rapid-go/server/internal/middleware"
 	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
 	"github.com/vanshjangir/rapid-go/server/internal/routes"
@@ -42,6 +49,8 @@ func setupRedis() {
 	log.Println("Successfully connected to Redis!")
 }
 
+const SHUTDOWN_TIMEOUT = 10 * time.Second
+
 func main() {
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
@@ -53,19 +62,77 @@ func main() {
 	r.GET("/game", middleware.WsAuth, routes.ConnectPlayer)
 	r.GET("/againstbot", middleware.WsAuth, routes.ConnectAgainstBot)
 	r.GET("/spectate/:gameId", middleware.WsAuth, routes.Spectate)
+	r.GET("/spectate/user/:username", middleware.WsAuth, routes.SpectateUser)
 
 	r.GET("/ispending", middleware.HttpAuth, routes.IsPending)
+	r.GET(
+		"/metrics/engines",
+		middleware.HttpAuth, middleware.AdminAuth, routes.EngineMetrics,
+	)
+
+	r.POST(
+		"/exhibition",
+		middleware.HttpAuth, middleware.AdminAuth, routes.StartExhibition,
+	)
+	r.POST(
+		"/admin/drain",
+		middleware.HttpAuth, middleware.AdminAuth, routes.DrainInstance,
+	)
 
 	if err := godotenv.Load("../../.dev.env"); err != nil {
 		log.Println("Error loading env variables: ", err)
 	}
 
-	core.Pmap = make(map[string]*core.Game)
+	core.OnGameOver(routes.RecordTournamentResult)
+	core.OnGameOver(routes.RecordArenaResult)
+	core.OnGameOver(routes.RecordLadderResult)
+	core.OnGameOver(core.QueueAnalysis)
+	core.OnGameOver(routes.UnlistFinishedGame)
+	core.OnGameAdjourned(routes.UnlistAdjournedGame)
+	core.RegisterGame = routes.RegisterGame
+
+	poolSize, err := strconv.Atoi(os.Getenv("ENGINE_POOL_SIZE"))
+	if err != nil || poolSize <= 0 {
+		poolSize = core.DEFAULT_ENGINE_POOL_SIZE
+	}
+	core.Engines = core.NewEnginePool(poolSize)
+	go core.RunAnalysisWorker()
 
 	db := database.GetDatabase()
 	defer db.Close()
+	if err := database.Migrate(); err != nil {
+		log.Fatalf("Could not migrate the database: %v\n", err)
+	}
+	core.RequeuePendingAnalysis()
 
 	setupRedis()
 
-	r.Run(":8000")
+	instance.Register(os.Getenv("WSURL"))
+	go instance.RunHeartbeat(func() int {
+		return core.GameCount()
+	})
+	go core.RunHandoffMonitor()
+
+	srv := &http.Server{Addr: ":8000", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v\n", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
+	<-quit
+
+	// games are drained while the server still answers reconnects and
+	// spectators, then it stops
+	log.Println("Shutting down")
+	core.Drain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("Error shutting down server:", err)
+	}
+	instance.Unregister()
 }
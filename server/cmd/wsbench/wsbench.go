@@ -0,0 +1,136 @@
+// wsbench compares the bandwidth of the JSON and the binary protobuf game
+// protocol. It plays random games and encodes the messages the server sends
+// for every move, the move status to the player and the move to the
+// opponent, in both encodings.
+//
+//	wsbench -games 20 -moves 250 -size 19
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/protocol"
+)
+
+// tries at a random point before a player passes
+const MAX_TRIES = 50
+
+var (
+	games = flag.Int("games", 20, "number of games to play")
+	moves = flag.Int("moves", 250, "moves per game")
+	size  = flag.Int("size", 19, "board size")
+	seed  = flag.Int64("seed", 1, "random seed")
+)
+
+type Totals struct {
+	Json  int
+	Proto int
+}
+
+func (t *Totals) add(msg any) {
+	jsonBytes, err := json.Marshal(msg)
+	if err != nil {
+		log.Fatal("Error marshalling message: ", err)
+	}
+	protoBytes, err := protocol.ToProto(jsonBytes)
+	if err != nil {
+		log.Fatal("Error converting message: ", err)
+	}
+	t.Json += len(jsonBytes)
+	t.Proto += len(protoBytes)
+}
+
+func randomMove(g *core.Game, r *rand.Rand) string {
+	for range MAX_TRIES {
+		x, y := r.Intn(*size), r.Intn(*size)
+		if !g.Board.Grid[y][x].Empty {
+			continue
+		}
+		move := string(rune('a'+x)) + strconv.Itoa(y)
+		if _, err := g.UpdateState(move, g.Turn); err == nil {
+			return move
+		}
+	}
+	g.UpdateState("ps", g.Turn)
+	return "ps"
+}
+
+func playGame(r *rand.Rand, status *Totals, move *Totals) {
+	g := new(core.Game)
+	g.Player = new(core.Player)
+	g.Settings = core.DefaultSettings()
+	g.Settings.Size = *size
+	g.InitGame()
+
+	var selfTime, opTime int64
+	for range *moves {
+		played := randomMove(g, r)
+		state, _ := g.Board.Encode()
+		selfTime += int64(r.Intn(20000))
+
+		status.add(core.MoveStatusMsg{
+			Type:       "movestatus",
+			TurnStatus: true,
+			MoveStatus: true,
+			State:      state,
+			SelfTime:   selfTime,
+			OpTime:     opTime,
+			Move:       played,
+			Captures:   g.Captures,
+		})
+		move.add(core.MoveMsg{
+			Type:     "move",
+			Move:     played,
+			State:    state,
+			SelfTime: opTime,
+			OpTime:   selfTime,
+			Captures: g.Captures,
+		})
+
+		selfTime, opTime = opTime, selfTime
+		g.Turn = 1 - g.Turn
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	r := rand.New(rand.NewSource(*seed))
+	var status, move Totals
+	for range *games {
+		playGame(r, &status, &move)
+	}
+
+	total := Totals{
+		Json:  status.Json + move.Json,
+		Proto: status.Proto + move.Proto,
+	}
+	count := *games * *moves
+
+	fmt.Printf("%d games of %d moves on %dx%d\n\n", *games, *moves, *size, *size)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "message\tjson bytes\tproto bytes\tproto/json\t")
+	for _, row := range []struct {
+		name   string
+		totals Totals
+	}{
+		{"movestatus", status},
+		{"move", move},
+		{"total", total},
+	} {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t\n",
+			row.name, row.totals.Json, row.totals.Proto,
+			100*float64(row.totals.Proto)/float64(row.totals.Json),
+		)
+	}
+	fmt.Fprintf(w, "per move\t%d\t%d\t\t\n", total.Json/count, total.Proto/count)
+	w.Flush()
+}
@@ -13,6 +13,7 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/vanshjangir/baduk v0.0.0-20250120174421-aa2d9cfd850c
 	google.golang.org/api v0.217.0
+	google.golang.org/protobuf v1.36.2
 )
 
 require (
@@ -59,6 +60,5 @@ require (
 	golang.org/x/text v0.21.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250106144421-5f5ef82da422 // indirect
 	google.golang.org/grpc v1.69.4 // indirect
-	google.golang.org/protobuf v1.36.2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/vanshjangir/rapid-go/server/internal/database"
+)
+
+const (
+	ANALYSIS_QUEUE_SIZE = 100
+
+	// a move that loses at least this many points is a blunder
+	BLUNDER_THRESHOLD = 10.0
+
+	// margin, in points, at which the win rate reaches about 73%
+	WINRATE_SCALE = 5.0
+
+	ANALYSIS_PENDING = "pending"
+	ANALYSIS_RUNNING = "running"
+	ANALYSIS_DONE    = "done"
+	ANALYSIS_FAILED  = "failed"
+
+	// an analysis running for longer was left by a server that stopped
+	ANALYSIS_STALE = 30 * time.Minute
+)
+
+// MoveAnalysis is the position after a move. Score and WinRate are from
+// black's side, Loss is how many points the move gave away for the player
+// who made it.
+type MoveAnalysis struct {
+	Move    string  `json:"move"`
+	Color   int     `json:"color"`
+	Score   float64 `json:"score"`
+	WinRate float64 `json:"winRate"`
+	Loss    float64 `json:"loss"`
+	Blunder bool    `json:"blunder"`
+}
+
+var analysisQueue = make(chan string, ANALYSIS_QUEUE_SIZE)
+
+// winRate turns a score estimate into black's chance of winning. GnuGo has
+// no win rate of its own, so it is approximated from the margin.
+func winRate(margin float64) float64 {
+	return 1 / (1 + math.Exp(-margin/WINRATE_SCALE))
+}
+
+func setAnalysis(gameId string, status string, moves []MoveAnalysis) error {
+	jsondata, err := json.Marshal(moves)
+	if err != nil {
+		return err
+	}
+
+	db := database.GetDatabase()
+	query := `
+	INSERT INTO game_analysis (gameid, status, moves, updated_at)
+	VALUES ($1, $2, $3, NOW())
+	ON CONFLICT (gameid) DO UPDATE SET
+	status = $2, moves = $3, updated_at = NOW()`
+	_, err = db.Exec(query, gameId, status, jsondata)
+	return err
+}
+
+func analyzeMoves(engine *GnuGo, history []string) ([]MoveAnalysis, error) {
+	moves := []MoveAnalysis{}
+	_, prev, err := engine.estimateScore()
+	if err != nil {
+		return moves, err
+	}
+
+	color := BlackCell
+	for _, move := range history {
+		if err := engine.Play(move, color); err != nil {
+			return moves, err
+		}
+		_, margin, err := engine.estimateScore()
+		if err != nil {
+			return moves, err
+		}
+
+		loss := prev - margin
+		if color == WhiteCell {
+			loss = -loss
+		}
+		moves = append(moves, MoveAnalysis{
+			Move:    move,
+			Color:   color,
+			Score:   margin,
+			WinRate: winRate(margin),
+			Loss:    loss,
+			Blunder: loss >= BLUNDER_THRESHOLD,
+		})
+
+		prev = margin
+		color = 1 - color
+	}
+	return moves, nil
+}
+
+// claimAnalysis marks a pending analysis as running. A game can be queued
+// on more than one server, only the one for which it returns true analyses
+// it.
+func claimAnalysis(gameId string) (bool, error) {
+	db := database.GetDatabase()
+	query := `
+	UPDATE game_analysis SET status = $2, updated_at = NOW()
+	WHERE gameid = $1 AND status = $3
+	RETURNING gameid`
+
+	err := db.QueryRow(
+		query, gameId, ANALYSIS_RUNNING, ANALYSIS_PENDING,
+	).Scan(&gameId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func analyzeGame(gameId string) error {
+	db := database.GetDatabase()
+	query := "SELECT moves, size FROM games WHERE gameid = $1"
+
+	// games saved before they were over have no moves or size
+	var moves sql.NullString
+	var size sql.NullInt64
+	if err := db.QueryRow(query, gameId).Scan(&moves, &size); err != nil {
+		return err
+	}
+	if !size.Valid {
+		size.Int64 = DEFAULT_BOARD_SIZE
+	}
+
+	key := "analysis/" + gameId
+	engine, err := Engines.Acquire(key, ANALYSIS_LEVEL, int(size.Int64))
+	if err != nil {
+		return err
+	}
+	defer Engines.Release(key, engine)
+
+	var history []string
+	if moves.String != "" {
+		history = strings.Split(moves.String, "/")
+	}
+	analysis, err := analyzeMoves(engine, history)
+	if err != nil {
+		return err
+	}
+	return setAnalysis(gameId, ANALYSIS_DONE, analysis)
+}
+
+// QueueAnalysis is a game over hook that schedules the engine analysis of
+// the game. Games are dropped when the queue is full.
+func QueueAnalysis(result GameResult) {
+	if err := setAnalysis(
+		result.GameId, ANALYSIS_PENDING, []MoveAnalysis{},
+	); err != nil {
+		log.Println("Error storing analysis status:", err)
+		return
+	}
+
+	select {
+	case analysisQueue <- result.GameId:
+	default:
+		log.Println("Analysis queue full, skipping game", result.GameId)
+		setAnalysis(result.GameId, ANALYSIS_FAILED, []MoveAnalysis{})
+	}
+}
+
+// RequeuePendingAnalysis queues again the games whose analysis was still
+// pending, they were lost from the queue when the server stopped. It runs
+// at startup, so the queue has room for ANALYSIS_QUEUE_SIZE games. Every
+// server requeues them, the worker claims each one before analysing it.
+// Analyses left running by a stopped server are pending again.
+func RequeuePendingAnalysis() {
+	db := database.GetDatabase()
+	staleQuery := `
+	UPDATE game_analysis SET status = $1
+	WHERE status = $2 AND updated_at < $3`
+	if _, err := db.Exec(
+		staleQuery, ANALYSIS_PENDING, ANALYSIS_RUNNING,
+		time.Now().Add(-ANALYSIS_STALE),
+	); err != nil {
+		log.Println("Error resetting stale analysis:", err)
+	}
+
+	query := `
+	SELECT gameid FROM game_analysis WHERE status = $1
+	ORDER BY updated_at LIMIT $2`
+
+	rows, err := db.Query(query, ANALYSIS_PENDING, ANALYSIS_QUEUE_SIZE)
+	if err != nil {
+		log.Println("Error fetching pending analysis:", err)
+		return
+	}
+	defer rows.Close()
+
+	queued := 0
+	for rows.Next() {
+		var gameId string
+		if err := rows.Scan(&gameId); err != nil {
+			log.Println("Error reading pending analysis:", err)
+			continue
+		}
+
+		select {
+		case analysisQueue <- gameId:
+			queued++
+		default:
+			return
+		}
+	}
+	if queued > 0 {
+		log.Println("Requeued analysis of", queued, "games")
+	}
+}
+
+// RunAnalysisWorker analyses the queued games one at a time, so analysis
+// never holds more than one engine of the pool.
+func RunAnalysisWorker() {
+	for gameId := range analysisQueue {
+		claimed, err := claimAnalysis(gameId)
+		if err != nil {
+			log.Println("Error claiming analysis of game", gameId, err)
+			continue
+		}
+		if !claimed {
+			// analysed by another server
+			continue
+		}
+		if err := analyzeGame(gameId); err != nil {
+			log.Println("Error analysing game", gameId, err)
+			setAnalysis(gameId, ANALYSIS_FAILED, []MoveAnalysis{})
+		}
+	}
+}
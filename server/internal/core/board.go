@@ -1,41 +1,121 @@
 package core
 
 import (
+	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
 	"github.com/vanshjangir/baduk"
+	"github.com/vanshjangir/rapid-go/server/internal/protocol"
 )
 
 const (
 	WhiteCell = 0
 	BlackCell = 1
 	EmptyCell = 2
+
+	DEFAULT_BOARD_SIZE = 19
+	DEFAULT_MAIN_TIME  = 900000
+
+	// the komi games are scored with, engines are told the same
+	DEFAULT_KOMI = 7.5
+
+	MAX_DELAY_MOVES   = 30
+	MAX_DELAY_SECONDS = 900
 )
 
+// GameSettings are the parameters a game is created with. MainTime is the
+// time each player has for the whole game in milliseconds.
+//
+// DelayMoves or DelaySeconds hold the game back from spectators, by a number
+// of moves or of seconds, so that they cannot relay engine moves to the
+// players.
+// With PublicChat the players' chat is also shown to spectators.
+type GameSettings struct {
+	Size         int   `json:"size"`
+	MainTime     int64 `json:"mainTime"`
+	Rated        bool  `json:"rated"`
+	DelayMoves   int   `json:"delayMoves,omitempty"`
+	DelaySeconds int   `json:"delaySeconds,omitempty"`
+	PublicChat   bool  `json:"publicChat,omitempty"`
+}
+
 type Game struct {
-	Board   *baduk.Board
-	Player  *Player
-	OpName  string
-	Id      string
-	Turn    int
-	History []string
-	Over    chan bool
+	// Mu serialises the changes to the board, the turn, the clocks and the
+	// offers, which the read loop, PubsubRecv and MonitorTimeout all make.
+	// It is not held across a game over, which waits for a rematch.
+	Mu sync.Mutex
+
+	Board    *baduk.Board
+	Player   *Player
+	OpName   string
+	Id       string
+	Turn     int
+	History  []string
+	Over     chan bool
+	Settings GameSettings
+
+	// Captures are the stones taken by the last move, sent to binary
+	// clients in place of the board state
+	Captures []string
+
+	AgainstBot bool
+	BotLevel   int
+
+	// Exhibition games are played by two engines, BlackLevel is the level of
+	// black's and BotLevel the level of white's
+	Exhibition bool
+	BlackLevel int
+
+	// HandedOff is set once the game has been moved to another instance
+	HandedOff bool
+
+	OpRating      int
+	OpProvisional bool
+
+	// Offer and OpOffer hold the pending pause or adjourn offer made by the
+	// player and by the opponent respectively.
+	Offer          string
+	OpOffer        string
+	Ended          bool
+	Paused         bool
+	PauseStart     time.Time
+	PauseSpent     int64
+	AwaitingResume bool
 }
 
 type GameDataRedis struct {
-	Black       string    `json:"black"`
-	White       string    `json:"white"`
-	BTime       int64     `json:"btime"`
-	WTime       int64     `json:"wtime"`
-	LastUpdated time.Time `json:"lastUpdated"`
-	Id          string    `json:"id"`
-	Turn        int       `json:"turn"`
-	History     []string  `json:"history"`
-	State       string    `json:"state"`
+	Black       string      `json:"black"`
+	White       string      `json:"white"`
+	BTime       int64       `json:"btime"`
+	WTime       int64       `json:"wtime"`
+	LastUpdated time.Time   `json:"lastUpdated"`
+	Id          string      `json:"id"`
+	Turn        int         `json:"turn"`
+	History     []string    `json:"history"`
+	State       string      `json:"state"`
+	Paused      bool        `json:"paused"`
+	Clocks      []MoveClock `json:"clocks,omitempty"`
+
+	// HandedOff is set while the game moves to another instance, its clocks
+	// stand still until the game is picked up there
+	HandedOff  bool `json:"handedOff,omitempty"`
+	AgainstBot bool `json:"againstBot,omitempty"`
+	Exhibition bool `json:"exhibition,omitempty"`
+	BotLevel   int  `json:"botLevel,omitempty"`
+	BlackLevel int  `json:"blackLevel,omitempty"`
+	GameSettings
+}
+
+// MoveClock is when a move was played and the clocks after it, for the
+// delayed view of spectators.
+type MoveClock struct {
+	At    time.Time `json:"at"`
+	BTime int64     `json:"btime"`
+	WTime int64     `json:"wtime"`
 }
 
 type Player struct {
@@ -46,9 +126,15 @@ type Player struct {
 	OpClk       Clock
 	DisConnTime Clock
 	Rating      int
+	Provisional bool
 	Game        *Game
-	Wsc         *websocket.Conn
+	Wsc         *protocol.Conn
 	Ps          *redis.PubSub
+
+	// Conditional is replaced by the read loop and played from by the
+	// pubsub loop, both go through ConditionalMu
+	ConditionalMu sync.Mutex
+	Conditional   map[string]*ConditionalNode
 }
 
 type Clock struct {
@@ -56,74 +142,66 @@ type Clock struct {
 	Spent int64
 }
 
-type MsgType struct {
-	Type string `json:"type"`
-}
-
-type StartMsg struct {
-	Type   string `json:"type"`
-	Start  int    `json:"start"`
-	Color  int    `json:"color"`
-	GameId string `json:"gameId"`
-}
-
-type StopMsg struct {
-	Type string `json:"type"`
-}
-
-type MoveMsg struct {
-	Type     string `json:"type"`
-	Move     string `json:"move"`
-	State    string `json:"state"`
-	SelfTime int64  `json:"selfTime"`
-	OpTime   int64  `json:"opTime"`
-}
-
-type AbortMsg struct {
-	Type string `json:"type"`
-}
-
-type GameOverMsg struct {
-	Type    string `json:"type"`
-	Winner  int    `json:"winner"`
-	Message string `json:"message"`
-}
-
-type MoveStatusMsg struct {
-	Type       string `json:"type"`
-	TurnStatus bool   `json:"turnStatus"`
-	MoveStatus bool   `json:"moveStatus"`
-	State      string `json:"state"`
-	SelfTime   int64  `json:"selfTime"`
-	OpTime     int64  `json:"opTime"`
-	Move       string `json:"move"`
-}
-
-type ReqStateMsg struct {
-	Type string `json:"type"`
-}
+// The messages of the game websocket are defined in the protocol package.
+type (
+	MsgType              = protocol.MsgType
+	ConditionalNode      = protocol.ConditionalNode
+	StartMsg             = protocol.StartMsg
+	MoveMsg              = protocol.MoveMsg
+	AbortMsg             = protocol.AbortMsg
+	GameOverMsg          = protocol.GameOverMsg
+	MoveStatusMsg        = protocol.MoveStatusMsg
+	ReqStateMsg          = protocol.ReqStateMsg
+	SyncMsg              = protocol.SyncMsg
+	ConditionalMsg       = protocol.ConditionalMsg
+	ConditionalStatusMsg = protocol.ConditionalStatusMsg
+	EstimateMsg          = protocol.EstimateMsg
+	HintMsg              = protocol.HintMsg
+	MaintenanceMsg       = protocol.MaintenanceMsg
+	HandoffMsg           = protocol.HandoffMsg
+	PauseMsg             = protocol.PauseMsg
+	AdjournedMsg         = protocol.AdjournedMsg
+	RematchMsg           = protocol.RematchMsg
+	ChatMsg              = protocol.ChatMsg
+)
 
-type SyncMsg struct {
-	Type     string   `json:"type"`
-	GameId   string   `json:"gameId"`
-	PName    string   `json:"pname"`
-	OpName   string   `json:"opname"`
-	Color    int      `json:"color"`
-	Turn     bool     `json:"turn"`
-	State    string   `json:"state"`
-	History  []string `json:"history"`
-	SelfTime int64    `json:"selfTime"`
-	OpTime   int64    `json:"opTime"`
+func DefaultSettings() GameSettings {
+	return GameSettings{
+		Size:     DEFAULT_BOARD_SIZE,
+		MainTime: DEFAULT_MAIN_TIME,
+		Rated:    true,
+	}
 }
 
-type ChatMsg struct {
-	Type    string `json:"type"`
-	Message string `json:"message"`
+func (gs *GameSettings) Validate() error {
+	if gs.Size != 9 && gs.Size != 13 && gs.Size != 19 {
+		return fmt.Errorf("unsupported board size %v", gs.Size)
+	}
+	if gs.MainTime < 60000 || gs.MainTime > 3600000 {
+		return fmt.Errorf("main time must be between 1 and 60 minutes")
+	}
+	if gs.DelayMoves < 0 || gs.DelayMoves > MAX_DELAY_MOVES {
+		return fmt.Errorf(
+			"spectator delay must be between 0 and %v moves", MAX_DELAY_MOVES,
+		)
+	}
+	if gs.DelaySeconds < 0 || gs.DelaySeconds > MAX_DELAY_SECONDS {
+		return fmt.Errorf(
+			"spectator delay must be between 0 and %v seconds", MAX_DELAY_SECONDS,
+		)
+	}
+	if gs.DelayMoves > 0 && gs.DelaySeconds > 0 {
+		return fmt.Errorf("spectator delay is either in moves or in seconds")
+	}
+	return nil
 }
 
 func (g *Game) InitGame() {
+	if g.Settings.Size == 0 {
+		g.Settings = DefaultSettings()
+	}
 	g.Board = new(baduk.Board)
-	g.Board.Init(19)
+	g.Board.Init(g.Settings.Size)
 	g.Turn = BlackCell
 	g.Player.Clk.Spent = 0
 	g.Player.OpClk.Spent = 0
@@ -131,6 +209,18 @@ func (g *Game) InitGame() {
 	g.Player.OpClk.Start = time.Now()
 }
 
+func (g *Game) StartMsg() StartMsg {
+	return StartMsg{
+		Type:     "start",
+		Start:    1,
+		Color:    g.Player.Color,
+		GameId:   g.Id,
+		OpName:   g.OpName,
+		OpRating: g.OpRating,
+		OpRank:   RankString(g.OpRating, g.OpProvisional),
+	}
+}
+
 func GetUniqueId() string {
 	currentTimestamp := int(time.Now().UnixNano()) / int(time.Microsecond)
 	uniqueID := uuid.New().ID()
@@ -148,16 +238,20 @@ func (p *Player) CheckDisConnTime() bool {
 }
 
 func (g *Game) CheckTimeout() bool {
+	if g.Paused {
+		return false
+	}
+
 	if g.Turn == g.Player.Color {
 		addSpent := time.Since(g.Player.Clk.Start).Milliseconds()
-		if g.Player.Clk.Spent+addSpent > 900000 {
+		if g.Player.Clk.Spent+addSpent > g.Settings.MainTime {
 			return true
 		} else {
 			return false
 		}
 	} else {
 		addSpent := time.Since(g.Player.OpClk.Start).Milliseconds()
-		if g.Player.OpClk.Spent+addSpent > 900000 {
+		if g.Player.OpClk.Spent+addSpent > g.Settings.MainTime {
 			return true
 		} else {
 			return false
@@ -177,13 +271,13 @@ func (g *Game) TapClock(color int) {
 
 func (g *Game) GetTime(color int) int64 {
 	if color == g.Player.Color {
-		if g.Turn == color {
+		if g.Turn == color && !g.Paused {
 			addSpent := time.Since(g.Player.Clk.Start).Milliseconds()
 			return g.Player.Clk.Spent + addSpent
 		}
 		return g.Player.Clk.Spent
 	} else {
-		if g.Turn == color {
+		if g.Turn == color && !g.Paused {
 			addSpent := time.Since(g.Player.OpClk.Start).Milliseconds()
 			return g.Player.OpClk.Spent + addSpent
 		}
@@ -192,25 +286,40 @@ func (g *Game) GetTime(color int) int64 {
 }
 
 func (g *Game) CheckTurn(color int) bool {
-	if g.Turn != color {
+	if g.Turn != color || g.Paused {
 		return false
 	}
 
 	return true
 }
 
+// stones returns the points holding a stone of the color, as x, y pairs.
+func (g *Game) stones(color int) [][2]int {
+	points := [][2]int{}
+	for y, row := range g.Board.Grid {
+		for x, p := range row {
+			if (color == BlackCell && p.Black) || (color == WhiteCell && p.White) {
+				points = append(points, [2]int{x, y})
+			}
+		}
+	}
+	return points
+}
+
 func (g *Game) UpdateState(move string, color int) (string, error) {
+	g.Captures = nil
 	if move == "ps" {
 		g.History = append(g.History, move)
 		return "", nil
 	}
 
-	col := int(move[0] - 'a')
-	row, err := strconv.Atoi(move[1:])
-	if err != nil {
-		return "", nil
+	if !isValidMove(move, g.Board.Size) {
+		return "", fmt.Errorf("invalid move %q", move)
 	}
+	col := int(move[0] - 'a')
+	row, _ := strconv.Atoi(move[1:])
 
+	opStones := g.stones(1 - color)
 	if color == BlackCell {
 		if err := g.Board.SetB(col, row); err != nil {
 			return "", err
@@ -221,10 +330,33 @@ func (g *Game) UpdateState(move string, color int) (string, error) {
 		}
 	}
 
+	for _, p := range opStones {
+		if g.Board.Grid[p[1]][p[0]].Empty {
+			g.Captures = append(
+				g.Captures, string(rune('a'+p[0]))+strconv.Itoa(p[1]),
+			)
+		}
+	}
+
 	g.History = append(g.History, move)
 	return g.Board.Encode()
 }
 
+// Replay plays a stored move list on a freshly initialised board, starting
+// with Black, and leaves the turn with the side to move.
+func (g *Game) Replay(history []string) error {
+	for _, move := range history {
+		if move == "" {
+			continue
+		}
+		if _, err := g.UpdateState(move, g.Turn); err != nil {
+			return err
+		}
+		g.Turn = 1 - g.Turn
+	}
+	return nil
+}
+
 func (g *Game) IsOver() int {
 	total := len(g.History)
 	if total < 2 {
@@ -233,7 +365,7 @@ func (g *Game) IsOver() int {
 
 	if (g.History[total-1] == "ps") && (g.History[total-2] == "ps") {
 		bs, ws := g.Board.Score()
-		if float32(bs) > float32(ws)+7.5 {
+		if float32(bs) > float32(ws)+DEFAULT_KOMI {
 			return BlackCell
 		} else {
 			return WhiteCell
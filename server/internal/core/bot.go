@@ -2,23 +2,83 @@ package core
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os/exec"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/vanshjangir/rapid-go/server/internal/protocol"
+)
+
+const (
+	// GnuGo plays at levels 0 to 10, 10 being the strongest
+	MIN_BOT_LEVEL     = 0
+	MAX_BOT_LEVEL     = 10
+	DEFAULT_BOT_LEVEL = MAX_BOT_LEVEL
+
+	// initial rating of the strongest level, each level below it starts
+	// BOT_LEVEL_STEP points lower
+	GNUGO_RATING   = 1800
+	BOT_LEVEL_STEP = 100
+
+	BOT_NAME_PREFIX = "gnugo-"
 )
 
+var errEngineResigned = fmt.Errorf("Game over by resign")
+
 type GnuGo struct {
 	cmd    *exec.Cmd
 	stdin  *bufio.Writer
 	stdout *bufio.Scanner
 }
 
-func NewGnuGo() (*GnuGo, error) {
-	cmd := exec.Command("/usr/games/gnugo", "--mode", "gtp")
+// IsReservedName reports whether username is kept for the levels of the
+// engine, players and their bots cannot take it.
+func IsReservedName(username string) bool {
+	return strings.HasPrefix(strings.ToLower(username), BOT_NAME_PREFIX)
+}
+
+// BotName is the username a level of the engine plays and is rated under.
+func BotName(level int) string {
+	return BOT_NAME_PREFIX + strconv.Itoa(level)
+}
+
+// ExhibitionNames returns the usernames the engines of an exhibition play
+// under. Engines of the same level have their color added, so that the two
+// players of the game can be told apart.
+func ExhibitionNames(blackLevel int, whiteLevel int) (string, string) {
+	black, white := BotName(blackLevel), BotName(whiteLevel)
+	if blackLevel == whiteLevel {
+		black, white = black+"-black", white+"-white"
+	}
+	return black, white
+}
+
+// BotLevel returns the engine level a username stands for, if it is the
+// name of a bot, the names of ExhibitionNames included.
+func BotLevel(username string) (int, bool) {
+	if !strings.HasPrefix(username, BOT_NAME_PREFIX) {
+		return 0, false
+	}
+	username = strings.TrimSuffix(username, "-black")
+	username = strings.TrimSuffix(username, "-white")
+	level, err := strconv.Atoi(strings.TrimPrefix(username, BOT_NAME_PREFIX))
+	if err != nil || level < MIN_BOT_LEVEL || level > MAX_BOT_LEVEL {
+		return 0, false
+	}
+	return level, true
+}
+
+func BotRating(level int) int {
+	return GNUGO_RATING - (MAX_BOT_LEVEL-level)*BOT_LEVEL_STEP
+}
+
+func NewGnuGo(level int) (*GnuGo, error) {
+	cmd := exec.Command(
+		"/usr/games/gnugo", "--mode", "gtp", "--level", strconv.Itoa(level),
+	)
 	stdinPipe, _ := cmd.StdinPipe()
 	stdoutPipe, _ := cmd.StdoutPipe()
 	err := cmd.Start()
@@ -67,29 +127,23 @@ func handleGameOverBot(g *Game, winner int, wonby string) {
 		log.Println("Error closing conn winner:", err)
 	}
 
-	delete(Pmap, g.Player.Username)
+	RemoveGame(g.Player.Username)
+	forgetBotGame(g)
 
 	if err := saveGame(g, winner, wonby); err != nil {
 		log.Println("Error saving game state:", err)
 	}
+	runGameOverHooks(g, winner, wonby)
 
 	if err := updateRating(g, winner); err != nil {
 		log.Println("Error saving game state:", err)
 	}
 }
 
-func handleMoveBot(g *Game, msgBytes []byte, engine *GnuGo) error {
-
-	var moveMsg MoveMsg
+func handleMoveBot(g *Game, moveMsg *MoveMsg, engine *GnuGo) error {
 	var moveStatus MoveStatusMsg
-
-	moveMsg.Type = "move"
 	moveStatus.Type = "movestatus"
 
-	if err := json.Unmarshal(msgBytes, &moveMsg); err != nil {
-		return fmt.Errorf("Error unmarshing move msg: %v", err)
-	}
-
 	if ok := g.CheckTurn(g.Player.Color); !ok {
 		moveStatus.MoveStatus = false
 		moveStatus.TurnStatus = false
@@ -118,6 +172,7 @@ func handleMoveBot(g *Game, msgBytes []byte, engine *GnuGo) error {
 	moveStatus.TurnStatus = true
 	moveStatus.State, _ = g.Board.Encode()
 	moveStatus.Move = moveMsg.Move
+	moveStatus.Captures = g.Captures
 	moveStatus.SelfTime = g.GetTime(g.Player.Color)
 	moveStatus.OpTime = g.GetTime(1 - g.Player.Color)
 
@@ -125,44 +180,21 @@ func handleMoveBot(g *Game, msgBytes []byte, engine *GnuGo) error {
 		return fmt.Errorf("Error sending move msg: %v", err)
 	}
 
-	var engineMove string
-	col := rune(moveMsg.Move[0])
-	t, _ := strconv.Atoi(moveMsg.Move[1:])
-	row := strconv.Itoa(t + 1)
-	if moveMsg.Move[0] >= 'i' {
-		engineMove = string(col+1) + row
-	} else {
-		engineMove = string(col) + row
+	if err := engine.Play(moveMsg.Move, g.Player.Color); err != nil {
+		log.Println("Error sending move to engine:", err)
 	}
 
-	engine.Send("play black" + engineMove)
-
 	return nil
 }
 
 func playBotMove(engine *GnuGo, g *Game) error {
-	res := engine.Send("genmove white")
-
-	if res == "" {
-		handleGameOverBot(g, BlackCell, "abort")
-		close(g.Over)
-		return fmt.Errorf("Game over by abort")
+	res, err := engine.GenMove(WhiteCell)
+	if err != nil {
+		return err
 	}
 
-	res = strings.Split(res, "\n")[0]
-	res = strings.Split(res, " ")[1]
-	if res == "PASS" {
-		res = "ps"
-	} else {
-		col := rune(res[0])
-		t, _ := strconv.Atoi(res[1:])
-		row := strconv.Itoa(t - 1)
-		if res[0] >= 'i' {
-			res = string(col+1+32) + row
-		} else {
-			res = string(col+32) + row
-		}
-
+	if res == "resign" {
+		return errEngineResigned
 	}
 
 	if _, err := g.UpdateState(res, WhiteCell); err != nil {
@@ -180,6 +212,7 @@ func playBotMove(engine *GnuGo, g *Game) error {
 	moveMsg.OpTime = g.GetTime(WhiteCell)
 	moveMsg.SelfTime = g.GetTime(BlackCell)
 	moveMsg.State, _ = g.Board.Encode()
+	moveMsg.Captures = g.Captures
 
 	if err := g.Player.Wsc.WriteJSON(moveMsg); err != nil {
 		return fmt.Errorf("Error sending move msg: %v", err)
@@ -196,14 +229,19 @@ func handleRecvBot(g *Game, engine *GnuGo) error {
 		return fmt.Errorf("Error in reading on player %v: %v", g.Player.Color, err)
 	}
 
-	var msg MsgType
-	if err := json.Unmarshal(msgBytes, &msg); err != nil {
-		return fmt.Errorf("Error unmarshaling msg type: %v", err)
+	msgType, msg, err := protocol.Decode(msgBytes)
+	if err != nil {
+		sendError(g, err)
+		return nil
 	}
 
-	switch msg.Type {
+	// a handoff saves the game between two messages
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+
+	switch msgType {
 	case "move":
-		if err := handleMoveBot(g, msgBytes, engine); err != nil {
+		if err := handleMoveBot(g, msg.(*MoveMsg), engine); err != nil {
 			return err
 		}
 
@@ -214,7 +252,11 @@ func handleRecvBot(g *Game, engine *GnuGo) error {
 		}
 
 		if err := playBotMove(engine, g); err != nil {
-			handleGameOverBot(g, BlackCell, "error")
+			wonby := "error"
+			if err == errEngineResigned {
+				wonby = "resign"
+			}
+			handleGameOverBot(g, BlackCell, wonby)
 			close(g.Over)
 			return err
 		}
@@ -233,21 +275,25 @@ func handleRecvBot(g *Game, engine *GnuGo) error {
 
 	case "reqState":
 		handleSyncState(g)
+
+	case "estimate", "hint":
+		handleAnalysis(g, msgType, engine)
 	}
 
 	return nil
 }
 
-func PlayGameBot(g *Game) {
-	engine, err := NewGnuGo()
-	if err != nil {
-		handleGameOverBot(g, BlackCell, "abort")
-		return
-	}
-	defer engine.Close()
+// PlayGameBot runs the game against an engine taken from Engines, which
+// is given back when the player leaves.
+func PlayGameBot(g *Game, engine *GnuGo) {
+	defer Engines.Release(g.Player.Username, engine)
 	defer g.Player.Wsc.Close()
 
-	fmt.Print(engine.Send("boardsize 19"))
+	// the engine comes from the pool with an empty board, on reconnect the
+	// game so far is played on it first
+	if err := engine.Replay(g.History); err != nil {
+		log.Println("Error replaying game on engine:", err)
+	}
 
 	for {
 		if err := handleRecvBot(g, engine); err != nil {
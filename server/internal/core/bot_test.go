@@ -0,0 +1,77 @@
+package core
+
+import "testing"
+
+func TestBotLevel(t *testing.T) {
+	tests := []struct {
+		username string
+		level    int
+		ok       bool
+	}{
+		{username: BotName(MAX_BOT_LEVEL), level: MAX_BOT_LEVEL, ok: true},
+		{username: BotName(MIN_BOT_LEVEL), level: MIN_BOT_LEVEL, ok: true},
+		{username: "gnugo-7-black", level: 7, ok: true},
+		{username: "gnugo-7-white", level: 7, ok: true},
+		{username: "gnugo-11", ok: false},
+		{username: "gnugo--1", ok: false},
+		{username: "gnugo-x", ok: false},
+		{username: "player", ok: false},
+	}
+
+	for _, tt := range tests {
+		level, ok := BotLevel(tt.username)
+		if level != tt.level || ok != tt.ok {
+			t.Errorf("BotLevel(%q) = %d, %v, want %d, %v",
+				tt.username, level, ok, tt.level, tt.ok)
+		}
+	}
+}
+
+func TestExhibitionNames(t *testing.T) {
+	black, white := ExhibitionNames(3, 8)
+	if black != "gnugo-3" || white != "gnugo-8" {
+		t.Errorf("ExhibitionNames(3, 8) = %q, %q", black, white)
+	}
+
+	black, white = ExhibitionNames(5, 5)
+	if black == white {
+		t.Fatalf("engines of the same level share the name %q", black)
+	}
+	for _, name := range []string{black, white} {
+		if level, ok := BotLevel(name); !ok || level != 5 {
+			t.Errorf("BotLevel(%q) = %d, %v, want 5, true", name, level, ok)
+		}
+	}
+}
+
+func TestBotRating(t *testing.T) {
+	if got := BotRating(MAX_BOT_LEVEL); got != GNUGO_RATING {
+		t.Errorf("BotRating(%d) = %d, want %d", MAX_BOT_LEVEL, got, GNUGO_RATING)
+	}
+	for level := MIN_BOT_LEVEL; level < MAX_BOT_LEVEL; level++ {
+		if diff := BotRating(level+1) - BotRating(level); diff != BOT_LEVEL_STEP {
+			t.Errorf("levels %d and %d are %d points apart, want %d",
+				level, level+1, diff, BOT_LEVEL_STEP)
+		}
+	}
+}
+
+func TestInitialRating(t *testing.T) {
+	if got := initialRating("player"); got != DEFAULT_RATING {
+		t.Errorf("initialRating(player) = %d, want %d", got, DEFAULT_RATING)
+	}
+	if got, want := initialRating(BotName(4)), BotRating(4); got != want {
+		t.Errorf("initialRating(%s) = %d, want %d", BotName(4), got, want)
+	}
+}
+
+func TestIsReservedName(t *testing.T) {
+	for _, name := range []string{"gnugo-3", "GnuGo-strong"} {
+		if !IsReservedName(name) {
+			t.Errorf("IsReservedName(%q) = false", name)
+		}
+	}
+	if IsReservedName("gnugofan") {
+		t.Error("IsReservedName(gnugofan) = true")
+	}
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+)
+
+const MAX_CONDITIONAL_DEPTH = 20
+
+func isValidMove(move string, size int) bool {
+	if move == "ps" {
+		return true
+	}
+	if len(move) < 2 || int(move[0]-'a') >= size {
+		return false
+	}
+	row, err := strconv.Atoi(move[1:])
+	if err != nil {
+		return false
+	}
+	return row >= 0 && row < size
+}
+
+func validateConditional(
+	tree map[string]*ConditionalNode, size int, depth int,
+) error {
+	if depth > MAX_CONDITIONAL_DEPTH {
+		return fmt.Errorf(
+			"conditional tree deeper than %v moves", MAX_CONDITIONAL_DEPTH,
+		)
+	}
+
+	for opMove, node := range tree {
+		if node == nil {
+			return fmt.Errorf("missing reply for %v", opMove)
+		}
+		if !isValidMove(opMove, size) {
+			return fmt.Errorf("invalid opponent move %v", opMove)
+		}
+		if !isValidMove(node.Reply, size) {
+			return fmt.Errorf("invalid reply %v", node.Reply)
+		}
+		if err := validateConditional(node.Next, size, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleConditional replaces the conditional move tree of the player. An
+// empty tree cancels the queued replies.
+func handleConditional(g *Game, conditionalMsg *ConditionalMsg) {
+	var status ConditionalStatusMsg
+	status.Type = "conditionalstatus"
+
+	if err := validateConditional(
+		conditionalMsg.Tree, g.Settings.Size, 1,
+	); err != nil {
+		status.Message = err.Error()
+	} else {
+		g.Player.ConditionalMu.Lock()
+		g.Player.Conditional = conditionalMsg.Tree
+		g.Player.ConditionalMu.Unlock()
+		status.Accepted = true
+	}
+
+	if err := g.Player.Wsc.WriteJSON(status); err != nil {
+		log.Println("Error sending conditional status:", err)
+	}
+}
+
+// playConditional looks up the opponent's move in the conditional move tree
+// and plays the queued reply. The tree is discarded as soon as the opponent
+// deviates from it or the reply can no longer be played. It returns true if
+// a reply was played.
+func playConditional(g *Game, opMove string) bool {
+	g.Player.ConditionalMu.Lock()
+	node, ok := g.Player.Conditional[opMove]
+	if !ok {
+		g.Player.Conditional = nil
+		g.Player.ConditionalMu.Unlock()
+		return false
+	}
+	g.Player.Conditional = node.Next
+	g.Player.ConditionalMu.Unlock()
+
+	if _, err := g.UpdateState(node.Reply, g.Player.Color); err != nil {
+		log.Println("Conditional reply is not playable:", node.Reply, err)
+		g.Player.ConditionalMu.Lock()
+		g.Player.Conditional = nil
+		g.Player.ConditionalMu.Unlock()
+		return false
+	}
+
+	if err := playOwnMove(g, node.Reply); err != nil {
+		log.Println("Error playing conditional reply:", err)
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
+)
+
+const DRAIN_TIMEOUT = 5 * time.Minute
+
+var (
+	draining  atomic.Bool
+	drainOnce sync.Once
+)
+
+// Draining reports whether this instance has stopped taking new games.
+func Draining() bool {
+	return draining.Load()
+}
+
+// notifyMaintenance tells every player on this instance about the drain.
+// Their connections serialise writes, so the notice can go out alongside
+// whatever their game is sending.
+func notifyMaintenance(deadline time.Time) {
+	msg := MaintenanceMsg{
+		Type:     "maintenance",
+		Message:  "This server is going down for maintenance",
+		Deadline: deadline,
+	}
+	for _, g := range Games() {
+		if err := g.Player.Wsc.WriteJSON(msg); err != nil {
+			log.Println("Error sending maintenance msg:", err)
+		}
+	}
+}
+
+// Drain stops new games on this instance and empties it. Games are handed
+// off when another instance is up, otherwise they are given until
+// DRAIN_TIMEOUT to finish. Whatever is left then is saved to Redis, where
+// the instance that takes the game over restores it from. Calls made
+// while a drain is running return when it is done.
+func Drain() {
+	drainOnce.Do(drain)
+}
+
+func drain() {
+	draining.Store(true)
+	log.Println("Draining instance")
+
+	instance.SetDraining(true)
+	deadline := time.Now().Add(DRAIN_TIMEOUT)
+	notifyMaintenance(deadline)
+
+	if available, err := instance.Available(); err == nil && len(available) > 0 {
+		HandOffGames()
+	}
+
+	for GameCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+	}
+
+	for _, g := range Games() {
+		g.Mu.Lock()
+		saveState(g)
+		g.Mu.Unlock()
+	}
+	log.Println("Instance drained, games left:", GameCount())
+}
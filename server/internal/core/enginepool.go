@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_ENGINE_POOL_SIZE = 8
+	ENGINE_QUEUE_TIMEOUT     = 30 * time.Second
+	MAX_ENGINES_PER_USER     = 1
+)
+
+var (
+	ErrEnginePoolBusy = fmt.Errorf("all engines are busy")
+	ErrEngineLimit    = fmt.Errorf("engine limit reached for user")
+)
+
+// EnginePool keeps a bounded set of GnuGo processes alive between games.
+// A game takes a slot for as long as it runs, an idle engine is reset and
+// reused when there is one, otherwise a new process is started.
+type EnginePool struct {
+	slots chan struct{}
+	idle  chan *GnuGo
+
+	mu       sync.Mutex
+	users    map[string]int
+	waiting  int
+	started  int
+	served   int
+	timeouts int
+}
+
+type EnginePoolMetrics struct {
+	Size     int `json:"size"`
+	InUse    int `json:"inUse"`
+	Idle     int `json:"idle"`
+	Waiting  int `json:"waiting"`
+	Started  int `json:"started"`
+	Served   int `json:"served"`
+	Timeouts int `json:"timeouts"`
+}
+
+var Engines *EnginePool
+
+func NewEnginePool(size int) *EnginePool {
+	return &EnginePool{
+		slots: make(chan struct{}, size),
+		idle:  make(chan *GnuGo, size),
+		users: make(map[string]int),
+	}
+}
+
+// Reset prepares the engine for a new game.
+func (gg *GnuGo) Reset(level int, size int) error {
+	cmds := []string{
+		"clear_board",
+		fmt.Sprintf("boardsize %d", size),
+		fmt.Sprintf("komi %.1f", DEFAULT_KOMI),
+		fmt.Sprintf("level %d", level),
+	}
+	for _, cmd := range cmds {
+		if res := gg.Send(cmd); !strings.HasPrefix(res, "=") {
+			return fmt.Errorf("engine failed %q: %q", cmd, res)
+		}
+	}
+	return nil
+}
+
+func (p *EnginePool) getEngine(level int, size int) (*GnuGo, error) {
+	select {
+	case engine := <-p.idle:
+		err := engine.Reset(level, size)
+		if err == nil {
+			return engine, nil
+		}
+		log.Println("Error resetting engine, replacing it:", err)
+		engine.Close()
+	default:
+	}
+
+	engine, err := NewGnuGo(level)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.Reset(level, size); err != nil {
+		engine.Close()
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.started++
+	p.mu.Unlock()
+	return engine, nil
+}
+
+// Acquire returns an engine set up for a game of the user, waiting up to
+// ENGINE_QUEUE_TIMEOUT for a slot when all of them are in use.
+func (p *EnginePool) Acquire(username string, level int, size int) (
+	*GnuGo, error,
+) {
+	p.mu.Lock()
+	if p.users[username] >= MAX_ENGINES_PER_USER {
+		p.mu.Unlock()
+		return nil, ErrEngineLimit
+	}
+	p.users[username]++
+	p.waiting++
+	p.mu.Unlock()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-time.After(ENGINE_QUEUE_TIMEOUT):
+		p.mu.Lock()
+		p.users[username]--
+		p.waiting--
+		p.timeouts++
+		p.mu.Unlock()
+		return nil, ErrEnginePoolBusy
+	}
+
+	p.mu.Lock()
+	p.waiting--
+	p.mu.Unlock()
+
+	engine, err := p.getEngine(level, size)
+	if err != nil {
+		p.release(username)
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.served++
+	p.mu.Unlock()
+	return engine, nil
+}
+
+// Release gives the engine back to the pool, it is kept warm for the next
+// game unless the pool already holds enough idle engines.
+func (p *EnginePool) Release(username string, engine *GnuGo) {
+	select {
+	case p.idle <- engine:
+	default:
+		engine.Close()
+	}
+	p.release(username)
+}
+
+func (p *EnginePool) release(username string) {
+	<-p.slots
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.users[username]--
+	if p.users[username] <= 0 {
+		delete(p.users, username)
+	}
+}
+
+func (p *EnginePool) Metrics() EnginePoolMetrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return EnginePoolMetrics{
+		Size:     cap(p.slots),
+		InUse:    len(p.slots),
+		Idle:     len(p.idle),
+		Waiting:  p.waiting,
+		Started:  p.started,
+		Served:   p.served,
+		Timeouts: p.timeouts,
+	}
+}
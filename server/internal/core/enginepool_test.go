@@ -0,0 +1,126 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// newTestEngine is an engine that answers every GTP command with success,
+// so the pool can be tested without starting GnuGo.
+func newTestEngine(t *testing.T) *GnuGo {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		scanner := bufio.NewScanner(inR)
+		for scanner.Scan() {
+			fmt.Fprint(outW, "= \n\n")
+		}
+	}()
+	t.Cleanup(func() {
+		inW.Close()
+		outW.Close()
+	})
+	return &GnuGo{stdin: bufio.NewWriter(inW), stdout: bufio.NewScanner(outR)}
+}
+
+// newTestPool is a pool whose slots all have an idle engine waiting.
+func newTestPool(t *testing.T, size int) *EnginePool {
+	p := NewEnginePool(size)
+	for i := 0; i < size; i++ {
+		p.idle <- newTestEngine(t)
+	}
+	return p
+}
+
+func TestEnginePoolUserLimit(t *testing.T) {
+	p := newTestPool(t, 2)
+
+	engine, err := p.Acquire("alice", MAX_BOT_LEVEL, 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Acquire("alice", MAX_BOT_LEVEL, 19); err != ErrEngineLimit {
+		t.Fatalf("second engine of a user: got %v, want %v", err, ErrEngineLimit)
+	}
+
+	p.Release("alice", engine)
+	engine, err = p.Acquire("alice", MAX_BOT_LEVEL, 19)
+	if err != nil {
+		t.Fatalf("engine after release: %v", err)
+	}
+	p.Release("alice", engine)
+}
+
+func TestEnginePoolReusesEngines(t *testing.T) {
+	p := newTestPool(t, 1)
+
+	first, err := p.Acquire("alice", MAX_BOT_LEVEL, 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release("alice", first)
+
+	second, err := p.Acquire("bob", 5, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Error("released engine was not reused")
+	}
+	p.Release("bob", second)
+
+	m := p.Metrics()
+	want := EnginePoolMetrics{Size: 1, Idle: 1, Served: 2}
+	if m != want {
+		t.Errorf("Metrics() = %+v, want %+v", m, want)
+	}
+	if len(p.users) != 0 {
+		t.Errorf("users still counted after release: %v", p.users)
+	}
+}
+
+func TestEnginePoolQueues(t *testing.T) {
+	p := newTestPool(t, 1)
+
+	engine, err := p.Acquire("alice", MAX_BOT_LEVEL, 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		engine, err := p.Acquire("bob", MAX_BOT_LEVEL, 19)
+		if err == nil {
+			p.Release("bob", engine)
+		}
+		acquired <- err
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for p.Metrics().Waiting != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second game is not waiting for a slot")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if m := p.Metrics(); m.InUse != 1 {
+		t.Errorf("InUse = %d while the pool is full, want 1", m.InUse)
+	}
+
+	p.Release("alice", engine)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("queued game got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued game did not get the released slot")
+	}
+
+	if m := p.Metrics(); m.InUse != 0 || m.Waiting != 0 {
+		t.Errorf("Metrics() = %+v after both games", m)
+	}
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const ANALYSIS_LEVEL = MAX_BOT_LEVEL
+
+// Replay plays the moves of a game on the engine, black moving first.
+func (gg *GnuGo) Replay(history []string) error {
+	color := BlackCell
+	for _, move := range history {
+		if err := gg.Play(move, color); err != nil {
+			return err
+		}
+		color = 1 - color
+	}
+	return nil
+}
+
+func (gg *GnuGo) vertices(cmd string) ([]string, error) {
+	res := gg.Send(cmd)
+	if !strings.HasPrefix(res, "=") {
+		return nil, fmt.Errorf("engine failed %q: %q", cmd, res)
+	}
+	return strings.Fields(res[1:]), nil
+}
+
+// estimateScore returns the engine's score, like "B+3.5", and the margin,
+// which is positive when black is ahead.
+func (gg *GnuGo) estimateScore() (string, float64, error) {
+	res, err := gtpResult(gg.Send("estimate_score"))
+	if err != nil {
+		return "", 0, err
+	}
+
+	fields := strings.Fields(res)
+	if len(fields) == 0 || len(fields[0]) < 3 {
+		return res, 0, nil
+	}
+	score := fields[0]
+	margin, err := strconv.ParseFloat(score[2:], 64)
+	if err != nil {
+		return score, 0, fmt.Errorf("invalid score %q", score)
+	}
+	if strings.HasPrefix(score, "W+") {
+		margin = -margin
+	}
+	return score, margin, nil
+}
+
+// Estimate asks the engine for the score and the owner of every point.
+func (gg *GnuGo) Estimate(size int) (EstimateMsg, error) {
+	msg := EstimateMsg{Type: "estimate"}
+
+	var err error
+	msg.Score, msg.Margin, err = gg.estimateScore()
+	if err != nil {
+		return msg, err
+	}
+
+	msg.Ownership = make([]int, size*size)
+	owners := []struct {
+		cmd   string
+		owner int
+	}{
+		{"list_stones black", 1},
+		{"list_stones white", -1},
+		{"final_status_list black_territory", 1},
+		{"final_status_list white_territory", -1},
+		// dead stones belong to the other side
+		{"final_status_list dead", 0},
+	}
+	for _, o := range owners {
+		vertices, err := gg.vertices(o.cmd)
+		if err != nil {
+			return msg, err
+		}
+		for _, vertex := range vertices {
+			move := fromGtpVertex(vertex)
+			col := int(move[0] - 'a')
+			row, err := strconv.Atoi(move[1:])
+			if err != nil || col < 0 || col >= size || row < 0 || row >= size {
+				continue
+			}
+
+			if o.owner == 0 {
+				msg.Ownership[row*size+col] *= -1
+			} else {
+				msg.Ownership[row*size+col] = o.owner
+			}
+		}
+	}
+	return msg, nil
+}
+
+// Hint asks the engine for the move it would play, without playing it.
+func (gg *GnuGo) Hint(color int) (string, error) {
+	vertex, err := gtpResult(gg.Send("reg_genmove " + gtpColor(color)))
+	if err != nil {
+		return "", err
+	}
+	if strings.ToLower(vertex) == "resign" {
+		return "resign", nil
+	}
+	return fromGtpVertex(vertex), nil
+}
+
+// analysisAllowed keeps estimates and hints out of rated games between
+// players.
+func analysisAllowed(g *Game) bool {
+	return g.AgainstBot || !g.Settings.Rated
+}
+
+func sendAnalysisError(g *Game, msgType string, errMsg string) {
+	var err error
+	if msgType == "hint" {
+		err = g.Player.Wsc.WriteJSON(HintMsg{Type: msgType, Error: errMsg})
+	} else {
+		err = g.Player.Wsc.WriteJSON(EstimateMsg{Type: msgType, Error: errMsg})
+	}
+	if err != nil {
+		log.Println("Error sending analysis msg:", err)
+	}
+}
+
+// handleAnalysis answers an estimate or hint request. Bot games ask their
+// own engine, other games borrow one from the pool for the request.
+func handleAnalysis(g *Game, msgType string, engine *GnuGo) {
+	if !analysisAllowed(g) {
+		sendAnalysisError(g, msgType, "Not available in rated games")
+		return
+	}
+
+	if engine == nil {
+		key := g.Player.Username + "/analysis"
+		e, err := Engines.Acquire(key, ANALYSIS_LEVEL, g.Settings.Size)
+		if err != nil {
+			sendAnalysisError(g, msgType, err.Error())
+			return
+		}
+		defer Engines.Release(key, e)
+
+		if err := e.Replay(g.History); err != nil {
+			log.Println("Error replaying game on engine:", err)
+			sendAnalysisError(g, msgType, "Engine error")
+			return
+		}
+		engine = e
+	}
+
+	var err error
+	switch msgType {
+	case "estimate":
+		var msg EstimateMsg
+		if msg, err = engine.Estimate(g.Settings.Size); err == nil {
+			err = g.Player.Wsc.WriteJSON(msg)
+		}
+	case "hint":
+		var move string
+		if move, err = engine.Hint(g.Player.Color); err == nil {
+			err = g.Player.Wsc.WriteJSON(HintMsg{Type: "hint", Move: move})
+		}
+	}
+	if err != nil {
+		log.Println("Error in analysis:", err)
+		sendAnalysisError(g, msgType, "Engine error")
+	}
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
+)
+
+const EXHIBITION_MOVE_DELAY = 2 * time.Second
+
+// exhibitions are the exhibition games running on this instance. They have
+// no player connected, so they are not in pmap.
+var (
+	exhibitions   = make(map[string]*Game)
+	exhibitionsMu sync.Mutex
+)
+
+func publishExhibitionMove(g *Game, move string, color int) {
+	player := g.Player.Username
+	if color != g.Player.Color {
+		player = g.OpName
+	}
+
+	var moveMsg PubsubMoveMsg
+	moveMsg.Type = "move"
+	moveMsg.Move = move
+	moveMsg.State, _ = g.Board.Encode()
+	moveMsg.SelfTime = g.GetTime(color)
+	moveMsg.OpTime = g.GetTime(1 - color)
+	moveMsg.MoveNo = len(g.History)
+	publishToGame(g, player, moveMsg, "move")
+}
+
+func endExhibition(g *Game, winner int, wonby string) {
+	var gameOverMsg GameOverMsg
+	gameOverMsg.Type = "gameover"
+	gameOverMsg.Winner = winner
+	gameOverMsg.Message = wonby
+	sendToPubsub(g, gameOverMsg, "gameover")
+
+	if err := saveGame(g, winner, wonby); err != nil {
+		log.Println("Error saving exhibition game:", err)
+	}
+	runGameOverHooks(g, winner, wonby)
+	deleteFromRedis(g.Id)
+}
+
+// handOffExhibitions stops the exhibitions on this instance, which go on
+// on the instance that takes them over.
+func handOffExhibitions() {
+	exhibitionsMu.Lock()
+	defer exhibitionsMu.Unlock()
+	for id, g := range exhibitions {
+		close(g.Over)
+		delete(exhibitions, id)
+	}
+}
+
+// handOffExhibition saves a stopped exhibition for the instance that takes
+// it over, its clocks stand still in between.
+func handOffExhibition(g *Game) {
+	g.HandedOff = true
+	updateStateInRedis(g)
+	log.Println("Exhibition handed off", g.Id, instance.GameUrl(g.Id))
+}
+
+// resumeExhibition picks up an exhibition handed off to this instance, with
+// engines of its own on which the game so far is played first.
+func resumeExhibition(gdr GameDataRedis) {
+	g, err := GameFromRedis(gdr, BlackCell)
+	if err != nil {
+		log.Println("Error replaying exhibition:", err)
+		return
+	}
+
+	// the game is taken before the engines, which may have to be waited for
+	g.HandedOff = false
+	updateStateInRedis(g)
+
+	go func() {
+		blackKey, whiteKey := g.Id+"/black", g.Id+"/white"
+		black, err := Engines.Acquire(blackKey, g.BlackLevel, g.Settings.Size)
+		if err != nil {
+			log.Println("Error resuming exhibition:", err)
+			handOffExhibition(g)
+			return
+		}
+		defer Engines.Release(blackKey, black)
+		white, err := Engines.Acquire(whiteKey, g.BotLevel, g.Settings.Size)
+		if err != nil {
+			log.Println("Error resuming exhibition:", err)
+			handOffExhibition(g)
+			return
+		}
+		defer Engines.Release(whiteKey, white)
+
+		for _, engine := range []*GnuGo{black, white} {
+			if err := engine.Replay(g.History); err != nil {
+				log.Println("Error replaying exhibition on engine:", err)
+			}
+		}
+		log.Println("Exhibition resumed", g.Id)
+		RunExhibition(g, black, white)
+	}()
+}
+
+// RunExhibition plays a game between two engines, g.Player being black.
+// Moves are published on the game's channel like those of players, so the
+// game can be watched like any other. A drain stops it through g.Over.
+func RunExhibition(g *Game, black *GnuGo, white *GnuGo) {
+	engines := map[int]*GnuGo{BlackCell: black, WhiteCell: white}
+
+	g.Over = make(chan bool)
+	exhibitionsMu.Lock()
+	exhibitions[g.Id] = g
+	exhibitionsMu.Unlock()
+	defer func() {
+		exhibitionsMu.Lock()
+		delete(exhibitions, g.Id)
+		exhibitionsMu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-g.Over:
+			handOffExhibition(g)
+			return
+		case <-time.After(EXHIBITION_MOVE_DELAY):
+		}
+
+		color := g.Turn
+		move, err := engines[color].GenMove(color)
+		if err != nil {
+			log.Println("Error in exhibition engine:", err)
+			endExhibition(g, 1-color, "error")
+			return
+		}
+		if move == "resign" {
+			endExhibition(g, 1-color, "resign")
+			return
+		}
+
+		if _, err := g.UpdateState(move, color); err != nil {
+			log.Println("Error in updateState in exhibition", err)
+			move = "ps"
+			g.UpdateState(move, color)
+		}
+		if err := engines[1-color].Play(move, color); err != nil {
+			log.Println("Error sending move to engine:", err)
+		}
+
+		g.TapClock(color)
+		g.Turn = 1 - color
+		updateStateInRedis(g)
+		publishExhibitionMove(g, move, color)
+
+		if winner := g.IsOver(); winner != -1 {
+			endExhibition(g, winner, "move")
+			return
+		}
+	}
+}
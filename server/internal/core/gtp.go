@@ -0,0 +1,79 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Moves in a game are a lowercase column letter from 'a' and a row counted
+// from 0, like "d3", or "ps" for a pass. GTP vertices skip the letter I and
+// count rows from 1, like "D4".
+
+func toGtpVertex(move string) string {
+	if move == "ps" {
+		return "pass"
+	}
+
+	col := move[0]
+	row, _ := strconv.Atoi(move[1:])
+	if col >= 'i' {
+		col++
+	}
+	return strings.ToUpper(string(col)) + strconv.Itoa(row+1)
+}
+
+func fromGtpVertex(vertex string) string {
+	vertex = strings.ToLower(vertex)
+	if vertex == "pass" {
+		return "ps"
+	}
+
+	col := vertex[0]
+	row, _ := strconv.Atoi(vertex[1:])
+	if col > 'i' {
+		col--
+	}
+	return string(col) + strconv.Itoa(row-1)
+}
+
+func gtpColor(color int) string {
+	if color == BlackCell {
+		return "black"
+	}
+	return "white"
+}
+
+// gtpResult returns the first line of a successful response without the
+// leading "=", or the error message of a failed one.
+func gtpResult(res string) (string, error) {
+	line := strings.Split(res, "\n")[0]
+	if strings.HasPrefix(line, "=") {
+		return strings.TrimSpace(line[1:]), nil
+	}
+	if strings.HasPrefix(line, "?") {
+		return "", fmt.Errorf("engine error: %v", strings.TrimSpace(line[1:]))
+	}
+	return "", fmt.Errorf("no response from engine")
+}
+
+// Play tells the engine about a move made in the game.
+func (gg *GnuGo) Play(move string, color int) error {
+	_, err := gtpResult(
+		gg.Send("play " + gtpColor(color) + " " + toGtpVertex(move)),
+	)
+	return err
+}
+
+// GenMove asks the engine for its move, it returns "resign" when the engine
+// gives up.
+func (gg *GnuGo) GenMove(color int) (string, error) {
+	vertex, err := gtpResult(gg.Send("genmove " + gtpColor(color)))
+	if err != nil {
+		return "", err
+	}
+	if strings.ToLower(vertex) == "resign" {
+		return "resign", nil
+	}
+	return fromGtpVertex(vertex), nil
+}
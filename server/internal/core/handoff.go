@@ -0,0 +1,255 @@
+package core
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
+	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
+)
+
+const (
+	HANDOFF_CHECK = 5 * time.Second
+
+	// a handed off game nobody has picked up by then is over
+	HANDOFF_RECONNECT_TIMEOUT = time.Minute
+)
+
+// storeBotGame puts a game against the engine in Redis, where games between
+// players are from the start, so that another instance can restore it.
+func storeBotGame(g *Game) error {
+	gdr := GameDataRedis{Id: g.Id, GameSettings: g.Settings}
+	gdr.Black, gdr.White = g.Player.Username, g.OpName
+	if g.Player.Color == WhiteCell {
+		gdr.Black, gdr.White = g.OpName, g.Player.Username
+	}
+	gameData, err := json.Marshal(gdr)
+	if err != nil {
+		return err
+	}
+	playerData, err := json.Marshal(map[string]any{
+		"gameId": g.Id, "color": g.Player.Color,
+	})
+	if err != nil {
+		return err
+	}
+
+	return pubsub.Rdb.HSet(
+		pubsub.RdbCtx, "live_game", g.Id, gameData, g.Player.Username, playerData,
+	).Err()
+}
+
+// saveState stores the game in Redis as it is now.
+func saveState(g *Game) {
+	if g.AgainstBot {
+		if err := storeBotGame(g); err != nil {
+			log.Println("Error storing bot game:", err)
+			return
+		}
+	}
+	updateStateInRedis(g)
+}
+
+// deletePlayerEntry removes the game entry of the player if it is still the
+// given game.
+func deletePlayerEntry(username string, gameId string) {
+	jsondata, err := pubsub.Rdb.HGet(
+		pubsub.RdbCtx, "live_game", username,
+	).Result()
+	if err != nil {
+		return
+	}
+	var entry struct {
+		GameId string `json:"gameId"`
+	}
+	if err := json.Unmarshal([]byte(jsondata), &entry); err != nil {
+		return
+	}
+	if entry.GameId == gameId {
+		deleteFromRedis(username)
+	}
+}
+
+// forgetBotGame removes what storeBotGame stored once the game is over.
+func forgetBotGame(g *Game) {
+	deletePlayerEntry(g.Player.Username, g.Id)
+	deleteFromRedis(g.Id)
+	instance.ForgetGame(g.Id)
+}
+
+// HandOff moves the player's game to another instance. The game's state is
+// saved to Redis with its clocks stopped, the client is told where the game
+// went and the new instance restores the game when the client reconnects
+// there.
+func HandOff(g *Game) {
+	if g.Ended {
+		return
+	}
+
+	g.Mu.Lock()
+	g.HandedOff = true
+	saveState(g)
+	g.Mu.Unlock()
+	RemoveGame(g.Player.Username)
+
+	handoffMsg := HandoffMsg{
+		Type:   "handoff",
+		GameId: g.Id,
+		Wsurl:  instance.GameUrl(g.Id),
+	}
+	if err := g.Player.Wsc.WriteJSON(handoffMsg); err != nil {
+		log.Println("Error sending handoff msg:", err)
+	}
+
+	// stops MonitorTimeout without ending the game, PubsubRecv and PlayGame
+	// end with their connections
+	close(g.Over)
+	if g.Player.Ps != nil {
+		g.Player.Ps.Close()
+	}
+	g.Player.Wsc.Close()
+	log.Println("Game handed off", g.Id, g.Player.Username, handoffMsg.Wsurl)
+}
+
+// HandOffGames moves every game away from this instance, which has to be
+// draining for them to be placed elsewhere. Games against the engine are
+// picked up with a new engine, exhibitions by the instance that takes them.
+func HandOffGames() {
+	var games []*Game
+	for _, g := range Games() {
+		if !g.AwaitingResume {
+			games = append(games, g)
+		}
+	}
+
+	for _, g := range games {
+		HandOff(g)
+	}
+	handOffExhibitions()
+}
+
+// TakeOver starts the clocks of a handed off game again, once it has been
+// restored on this instance.
+func TakeOver(g *Game) {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+	g.HandedOff = false
+	updateStateInRedis(g)
+}
+
+// RunHandoffMonitor watches the games handed off to this instance.
+// Exhibitions are resumed right away, games whose players have not come
+// back within HANDOFF_RECONNECT_TIMEOUT are ended.
+func RunHandoffMonitor() {
+	for {
+		checkHandedOffGames()
+		time.Sleep(HANDOFF_CHECK)
+	}
+}
+
+func checkHandedOffGames() {
+	if Draining() {
+		return
+	}
+	entries, err := pubsub.Rdb.HGetAll(pubsub.RdbCtx, "live_game").Result()
+	if err != nil {
+		log.Println("Error fetching live games:", err)
+		return
+	}
+
+	for key, jsondata := range entries {
+		var gdr GameDataRedis
+		if err := json.Unmarshal([]byte(jsondata), &gdr); err != nil {
+			continue
+		}
+		// player entries do not unmarshal to a game of their own id
+		if gdr.Id != key || !gdr.HandedOff {
+			continue
+		}
+		if instance.GameUrl(gdr.Id) != instance.Self.Url {
+			continue
+		}
+
+		if gdr.Exhibition {
+			resumeExhibition(gdr)
+		} else if time.Since(gdr.LastUpdated) > HANDOFF_RECONNECT_TIMEOUT {
+			endAbandonedGame(gdr)
+		}
+	}
+}
+
+// GameFromRedis is the game as the player of the given color sees it.
+func GameFromRedis(gdr GameDataRedis, color int) (*Game, error) {
+	g := new(Game)
+	g.Player = new(Player)
+	g.Player.Game = g
+	g.Player.Color = color
+	g.Id = gdr.Id
+	g.Player.Username, g.OpName = gdr.Black, gdr.White
+	if color == WhiteCell {
+		g.Player.Username, g.OpName = gdr.White, gdr.Black
+	}
+	if gdr.Size != 0 {
+		g.Settings = gdr.GameSettings
+	}
+	g.AgainstBot = gdr.AgainstBot
+	g.Exhibition = gdr.Exhibition
+	g.BotLevel = gdr.BotLevel
+	g.BlackLevel = gdr.BlackLevel
+
+	g.InitGame()
+	if err := g.Replay(gdr.History); err != nil {
+		return nil, err
+	}
+	if color == BlackCell {
+		g.Player.Clk.Spent, g.Player.OpClk.Spent = gdr.BTime, gdr.WTime
+	} else {
+		g.Player.Clk.Spent, g.Player.OpClk.Spent = gdr.WTime, gdr.BTime
+	}
+	return g, nil
+}
+
+// endAbandonedGame ends a handed off game that none of its players came
+// back to. The player to move loses, as after a disconnection. Games
+// against the engine are seen from the player's side, who plays black.
+func endAbandonedGame(gdr GameDataRedis) {
+	// only the caller that removes the game ends it
+	removed, err := pubsub.Rdb.HDel(pubsub.RdbCtx, "live_game", gdr.Id).Result()
+	if err != nil || removed == 0 {
+		return
+	}
+
+	winner := 1 - gdr.Turn
+	wonby := "discn"
+	colors := []int{BlackCell, WhiteCell}
+	if gdr.AgainstBot {
+		colors = []int{BlackCell}
+	}
+
+	for i, color := range colors {
+		g, err := GameFromRedis(gdr, color)
+		if err != nil {
+			log.Println("Error replaying abandoned game:", err)
+			return
+		}
+		if i == 0 {
+			gameOverMsg := GameOverMsg{
+				Type: "gameover", Winner: winner, Message: wonby,
+			}
+			sendToPubsub(g, gameOverMsg, "gameover")
+			if err := saveGame(g, winner, wonby); err != nil {
+				log.Println("Error saving game state:", err)
+			}
+			runGameOverHooks(g, winner, wonby)
+		}
+
+		g.LoadRatings()
+		if err := updateRating(g, winner); err != nil {
+			log.Println("Error saving game state:", err)
+		}
+		deletePlayerEntry(g.Player.Username, gdr.Id)
+	}
+	instance.ForgetGame(gdr.Id)
+	log.Println("Handed off game abandoned", gdr.Id)
+}
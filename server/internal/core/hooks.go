@@ -0,0 +1,59 @@
+package core
+
+// GameResult describes a finished game for the subsystems that keep their
+// own records of it, like tournaments.
+type GameResult struct {
+	GameId   string
+	Black    string
+	White    string
+	Winner   int
+	WonBy    string
+	Settings GameSettings
+}
+
+type GameOverHook func(result GameResult)
+
+var gameOverHooks []GameOverHook
+
+// OnGameOver registers a hook that is called once for every game that ends
+// on this server, after the game has been saved. Hooks run in their own
+// goroutine so they cannot hold up the players.
+func OnGameOver(hook GameOverHook) {
+	gameOverHooks = append(gameOverHooks, hook)
+}
+
+func runGameOverHooks(g *Game, winner int, wonby string) {
+	result := GameResult{
+		GameId:   g.Id,
+		Winner:   winner,
+		WonBy:    wonby,
+		Settings: g.Settings,
+	}
+
+	if g.Player.Color == BlackCell {
+		result.Black, result.White = g.Player.Username, g.OpName
+	} else {
+		result.Black, result.White = g.OpName, g.Player.Username
+	}
+
+	for _, hook := range gameOverHooks {
+		go hook(result)
+	}
+}
+
+type GameAdjournedHook func(gameId string)
+
+var gameAdjournedHooks []GameAdjournedHook
+
+// OnGameAdjourned registers a hook that is called when a game on this server
+// is adjourned. Both players' servers call it, so hooks must not mind being
+// called twice for a game.
+func OnGameAdjourned(hook GameAdjournedHook) {
+	gameAdjournedHooks = append(gameAdjournedHooks, hook)
+}
+
+func runGameAdjournedHooks(g *Game) {
+	for _, hook := range gameAdjournedHooks {
+		go hook(g.Id)
+	}
+}
@@ -0,0 +1,329 @@
+package core
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vanshjangir/rapid-go/server/internal/database"
+)
+
+const MAX_PAUSE_TIME = 5 * 60 * 1000
+
+func pauseClocks(g *Game) {
+	if g.Paused {
+		return
+	}
+
+	if g.Turn == g.Player.Color {
+		g.Player.Clk.Spent += time.Since(g.Player.Clk.Start).Milliseconds()
+	} else {
+		g.Player.OpClk.Spent += time.Since(g.Player.OpClk.Start).Milliseconds()
+	}
+	g.Paused = true
+	g.PauseStart = time.Now()
+}
+
+func resumeClocks(g *Game) {
+	if !g.Paused {
+		return
+	}
+
+	// time spent waiting for an adjourned game to be resumed does not count
+	// towards the pause limit
+	if !g.AwaitingResume {
+		g.PauseSpent += time.Since(g.PauseStart).Milliseconds()
+	}
+	g.Paused = false
+	if g.Turn == g.Player.Color {
+		g.Player.Clk.Start = time.Now()
+	} else {
+		g.Player.OpClk.Start = time.Now()
+	}
+}
+
+func (g *Game) GetPauseTime() int64 {
+	if g.Paused && !g.AwaitingResume {
+		return g.PauseSpent + time.Since(g.PauseStart).Milliseconds()
+	}
+	return g.PauseSpent
+}
+
+func sendPauseState(g *Game, action string) {
+	var pauseMsg PauseMsg
+	pauseMsg.Type = "pause"
+	pauseMsg.Action = action
+	pauseMsg.SelfTime = g.GetTime(g.Player.Color)
+	pauseMsg.OpTime = g.GetTime(1 - g.Player.Color)
+
+	if err := g.Player.Wsc.WriteJSON(pauseMsg); err != nil {
+		log.Println("Error sending pause msg:", err)
+	}
+}
+
+// checkPauseLimit resumes the game once the total pause time allowed for it
+// is used up.
+func checkPauseLimit(g *Game) {
+	if !g.Paused || g.AwaitingResume || g.GetPauseTime() < MAX_PAUSE_TIME {
+		return
+	}
+
+	resumeGame(g)
+	sendToPubsub(g, PauseMsg{Type: "pause", Action: "resumed"}, "pause")
+	log.Println("Pause limit reached, game resumed", g.Id)
+}
+
+// resumeGame starts the clocks of a paused game again and tells the client.
+func resumeGame(g *Game) {
+	g.Offer = ""
+	g.OpOffer = ""
+	resumeClocks(g)
+	updateStateInRedis(g)
+	sendPauseState(g, "resumed")
+}
+
+// handlePause handles the pause messages of the player. Pausing and
+// resuming both need the consent of the opponent: offer, accept and decline
+// are about pausing the game, resume, resumeaccept and resumedecline about
+// resuming it.
+func handlePause(g *Game, pauseMsg *PauseMsg) {
+	switch pauseMsg.Action {
+	case "offer":
+		if g.Paused || g.GetPauseTime() >= MAX_PAUSE_TIME {
+			return
+		}
+		g.Offer = "pause"
+
+	case "accept":
+		if g.OpOffer != "pause" {
+			return
+		}
+		g.OpOffer = ""
+		pauseClocks(g)
+		updateStateInRedis(g)
+		sendPauseState(g, "accept")
+
+	case "decline":
+		if g.OpOffer != "pause" {
+			return
+		}
+		g.OpOffer = ""
+
+	case "resume":
+		if !g.Paused || g.AwaitingResume {
+			return
+		}
+		g.Offer = "resume"
+
+	case "resumeaccept":
+		if g.OpOffer != "resume" {
+			return
+		}
+		resumeGame(g)
+
+	case "resumedecline":
+		if g.OpOffer != "resume" {
+			return
+		}
+		g.OpOffer = ""
+
+	default:
+		return
+	}
+
+	sendToPubsub(g, PauseMsg{Type: "pause", Action: pauseMsg.Action}, "pause")
+}
+
+func handlePausePubsub(g *Game, msgBytes []byte) {
+	var pauseMsg PauseMsg
+	if err := json.Unmarshal(msgBytes, &pauseMsg); err != nil {
+		log.Println("Error unmarshaling pause msg:", err)
+		return
+	}
+
+	switch pauseMsg.Action {
+	case "offer":
+		g.OpOffer = "pause"
+
+	case "accept":
+		if g.Offer != "pause" {
+			return
+		}
+		g.Offer = ""
+		pauseClocks(g)
+
+	case "decline":
+		g.Offer = ""
+
+	case "resume":
+		g.OpOffer = "resume"
+
+	case "resumeaccept":
+		if g.Offer != "resume" {
+			return
+		}
+		resumeGame(g)
+		return
+
+	case "resumedecline":
+		g.Offer = ""
+
+	case "resumed":
+		// the pause limit was reached on the opponent's side
+		if g.Paused && !g.AwaitingResume {
+			resumeGame(g)
+		}
+		return
+
+	default:
+		return
+	}
+
+	sendPauseState(g, pauseMsg.Action)
+}
+
+func saveAdjourned(g *Game) error {
+	db := database.GetDatabase()
+	updateQuery := `
+		UPDATE games SET
+		adjourned = true, moves = $2, btime = $3, wtime = $4
+		WHERE gameid = $1
+	`
+	if _, err := db.Exec(
+		updateQuery,
+		g.Id,
+		strings.Join(g.History, "/"),
+		g.GetTime(BlackCell),
+		g.GetTime(WhiteCell),
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+func markResumed(g *Game) {
+	db := database.GetDatabase()
+	updateQuery := `UPDATE games SET adjourned = false WHERE gameid = $1`
+	if _, err := db.Exec(updateQuery, g.Id); err != nil {
+		log.Println("Error marking adjourned game as resumed:", err)
+	}
+}
+
+func adjournGame(g *Game, save bool) {
+	pauseClocks(g)
+	if save {
+		if err := saveAdjourned(g); err != nil {
+			log.Println("Error saving adjourned game:", err)
+		}
+	}
+
+	adjournedMsg := AdjournedMsg{Type: "adjourned", GameId: g.Id}
+	if err := g.Player.Wsc.WriteJSON(adjournedMsg); err != nil {
+		log.Println("Error sending adjourned msg:", err)
+	}
+
+	if err := g.Player.Wsc.Close(); err != nil {
+		log.Println("Error closing conn after adjournment:", err)
+	}
+
+	RemoveGame(g.Player.Username)
+	deleteFromRedis(g.Player.Username)
+	deleteFromRedis(g.Id)
+	runGameAdjournedHooks(g)
+	close(g.Over)
+}
+
+// abandonResume drops a restored game whose player left before the opponent
+// came back. The game stays adjourned in the database.
+func abandonResume(g *Game) {
+	RemoveGame(g.Player.Username)
+	deleteFromRedis(g.Player.Username)
+	close(g.Over)
+}
+
+func handleAdjourn(g *Game, pauseMsg *PauseMsg) {
+	switch pauseMsg.Action {
+	case "offer":
+		if g.AwaitingResume {
+			return
+		}
+		g.Offer = "adjourn"
+		sendToPubsub(g, PauseMsg{Type: "adjourn", Action: "offer"}, "adjourn")
+
+	case "decline":
+		if g.OpOffer != "adjourn" {
+			return
+		}
+		g.OpOffer = ""
+		sendToPubsub(g, PauseMsg{Type: "adjourn", Action: "decline"}, "adjourn")
+
+	case "accept":
+		if g.OpOffer != "adjourn" {
+			return
+		}
+		g.OpOffer = ""
+		sendToPubsub(g, PauseMsg{Type: "adjourn", Action: "accept"}, "adjourn")
+		adjournGame(g, true)
+	}
+}
+
+// handleAdjournPubsub handles the adjourn messages of the opponent. It
+// returns true when the game has been adjourned.
+func handleAdjournPubsub(g *Game, msgBytes []byte) bool {
+	var pauseMsg PauseMsg
+	if err := json.Unmarshal(msgBytes, &pauseMsg); err != nil {
+		log.Println("Error unmarshaling adjourn msg:", err)
+		return false
+	}
+
+	switch pauseMsg.Action {
+	case "offer":
+		g.OpOffer = "adjourn"
+		sendToClient(g, msgBytes)
+
+	case "decline":
+		g.Offer = ""
+		sendToClient(g, msgBytes)
+
+	case "accept":
+		if g.Offer != "adjourn" {
+			return false
+		}
+		g.Offer = ""
+		adjournGame(g, false)
+		return true
+
+	case "rejoin":
+		if !g.AwaitingResume {
+			return false
+		}
+		resumeClocks(g)
+		g.AwaitingResume = false
+		markResumed(g)
+		updateStateInRedis(g)
+		sendPauseState(g, "resumed")
+
+		// answer so that the opponent, who may have announced itself first,
+		// starts its clocks as well
+		sendToPubsub(g, PauseMsg{Type: "adjourn", Action: "rejoin"}, "adjourn")
+	}
+
+	return false
+}
+
+// StartAdjourned starts a game restored from an adjournment. Its clocks stay
+// frozen until the opponent has rejoined as well.
+func StartAdjourned(g *Game) {
+	g.Paused = true
+	g.PauseStart = time.Now()
+	g.AwaitingResume = true
+	g.Over = make(chan bool)
+
+	AddGame(g.Player.Username, g)
+	updateStateInRedis(g)
+	handleSyncState(g)
+
+	go PlayGame(g)
+	go MonitorTimeout(g)
+}
@@ -1,20 +1,64 @@
 package core
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
+	"github.com/vanshjangir/rapid-go/server/internal/protocol"
 	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
 )
 
-var Pmap map[string]*Game
+// pmap holds the games running on this instance by player. It is shared by
+// the handlers and the games themselves, so it is only used through the
+// functions below.
+var (
+	pmap   = make(map[string]*Game)
+	pmapMu sync.RWMutex
+)
+
+func AddGame(username string, g *Game) {
+	pmapMu.Lock()
+	defer pmapMu.Unlock()
+	pmap[username] = g
+}
+
+func GetGame(username string) (*Game, bool) {
+	pmapMu.RLock()
+	defer pmapMu.RUnlock()
+	g, ok := pmap[username]
+	return g, ok && g != nil
+}
+
+func RemoveGame(username string) {
+	pmapMu.Lock()
+	defer pmapMu.Unlock()
+	delete(pmap, username)
+}
+
+// Games returns a copy of the games running on this instance.
+func Games() []*Game {
+	pmapMu.RLock()
+	defer pmapMu.RUnlock()
+	games := make([]*Game, 0, len(pmap))
+	for _, g := range pmap {
+		games = append(games, g)
+	}
+	return games
+}
+
+func GameCount() int {
+	pmapMu.RLock()
+	defer pmapMu.RUnlock()
+	return len(pmap)
+}
 
 func MonitorTimeout(g *Game) {
 	for {
@@ -22,14 +66,29 @@ func MonitorTimeout(g *Game) {
 		case <-g.Over:
 			return
 		default:
+			if g.AwaitingResume {
+				if g.Player.DisConn {
+					abandonResume(g)
+					log.Println("Player left before adjourned game resumed")
+					return
+				}
+				time.Sleep(1 * time.Second)
+				continue
+			}
+			g.Mu.Lock()
+			checkPauseLimit(g)
+			timedOut := g.CheckTimeout()
+			turn := g.Turn
+			g.Mu.Unlock()
+
 			if g.Player.DisConn && g.Player.CheckDisConnTime() {
 				winner := 1 - g.Player.Color
 				handleGameOver(g, winner, "discn")
 				log.Println("Game over by disconnection")
 				return
 			}
-			if g.CheckTimeout() {
-				winner := 1 - g.Turn
+			if timedOut {
+				winner := 1 - turn
 				handleGameOver(g, winner, "time")
 				log.Println("Game over by timeout")
 				return
@@ -58,51 +117,21 @@ func saveGame(g *Game, winner int, wonby string) error {
 	return nil
 }
 
-func getNewRating(pr int, opr int, won bool) int {
-	score := 1.0
-	if won == false {
-		score = 0
-	}
-	expectedScore := 1 / (1 + math.Pow(10, float64((pr-opr)/400)))
-	var k float64 = 20
-	newRating := float64(pr) + k*(score-expectedScore)
-	return int(newRating)
-}
-
-func getOpRating(db *sql.DB, g *Game) int {
-	query := `SELECT rating FROM users WHERE username = $1`
-	opRating := 400
-	if err := db.QueryRow(query, g.OpName).Scan(&opRating); err != nil {
-		log.Println("Error fetching op rating", err)
-	}
-	return opRating
+func handleChat(g *Game, chatMsg *ChatMsg) {
+	sendToPubsub(g, chatMsg, "chat")
 }
 
-func updateRating(g *Game, winner int) error {
-	db := database.GetDatabase()
-	opRating := getOpRating(db, g)
-	newRating := g.Player.Rating
-	if winner == g.Player.Color {
-		newRating = getNewRating(g.Player.Rating, opRating, true)
-	} else {
-		newRating = getNewRating(g.Player.Rating, opRating, false)
+// sendError tells the client why its message was refused.
+func sendError(g *Game, err error) {
+	var protoErr *protocol.Error
+	if !errors.As(err, &protoErr) {
+		protoErr = &protocol.Error{
+			Code: protocol.ERR_INVALID_MESSAGE, Message: err.Error(),
+		}
 	}
-	query := "UPDATE users SET rating = $1 WHERE username = $2"
-	if _, err := db.Exec(query, newRating, g.Player.Username); err != nil {
-		return err
+	if err := g.Player.Wsc.WriteJSON(protoErr.Frame()); err != nil {
+		log.Println("Error sending error msg:", err)
 	}
-
-	return nil
-}
-
-func handleChat(g *Game, msgBytes []byte) error {
-	jsonData := make(map[string]any)
-	if err := json.Unmarshal(msgBytes, &jsonData); err != nil {
-		log.Println("Error unmarshaling chat message", err)
-		return err
-	}
-	sendToPubsub(g, jsonData, "chat")
-	return nil
 }
 
 func handleSyncState(g *Game) {
@@ -115,6 +144,8 @@ func handleSyncState(g *Game) {
 	syncMsg.History = g.History
 	syncMsg.SelfTime = g.GetTime(g.Player.Color)
 	syncMsg.OpTime = g.GetTime(1 - g.Player.Color)
+	syncMsg.Rank = RankString(g.Player.Rating, g.Player.Provisional)
+	syncMsg.OpRank = RankString(g.OpRating, g.OpProvisional)
 
 	if g.Player.Game.Turn == g.Player.Color {
 		syncMsg.Turn = true
@@ -158,31 +189,44 @@ func handleGameOver(g *Game, winner int, wonby string) {
 		log.Println("Error sending gameOverMsg msg to p:", err)
 	}
 
-	if err := g.Player.Wsc.Close(); err != nil {
-		log.Println("Error closing conn loser:", err)
-	}
+	waitForRematch(g)
 
 	sendToPubsub(g, gameOverMsg, "gameover")
 
 	if err := saveGame(g, winner, wonby); err != nil {
 		log.Println("Error saving game state:", err)
 	}
+	runGameOverHooks(g, winner, wonby)
 
 	if err := updateRating(g, winner); err != nil {
 		log.Println("Error saving game state:", err)
 	}
 
-	delete(Pmap, g.Player.Username)
+	RemoveGame(g.Player.Username)
 	deleteFromRedis(g.Player.Username)
 	deleteFromRedis(g.Id)
+	instance.ForgetGame(g.Id)
 	close(g.Over)
 }
 
+// PubsubMoveMsg is a move as it is published on the game's channel. MoveNo
+// counts the moves played with it, spectators who read the game from redis
+// use it to skip the moves they already have.
+type PubsubMoveMsg struct {
+	MoveMsg
+	MoveNo int `json:"moveNo"`
+}
+
 func sendToPubsub(g *Game, jsonData any, msgType string) {
+	publishToGame(g, g.Player.Username, jsonData, msgType)
+}
+
+// publishToGame sends a message on the game's channel on behalf of player.
+func publishToGame(g *Game, player string, jsonData any, msgType string) {
 	finalJsonData := make(map[string]any)
 	finalJsonData["data"] = jsonData
 	finalJsonData["type"] = msgType
-	finalJsonData["player"] = g.Player.Username
+	finalJsonData["player"] = player
 
 	finalMsg, err := json.Marshal(finalJsonData)
 	if err != nil {
@@ -215,6 +259,17 @@ func updateStateInRedis(g *Game) {
 	gdr.BTime = g.GetTime(BlackCell)
 	gdr.WTime = g.GetTime(WhiteCell)
 	gdr.LastUpdated = time.Now()
+	for len(gdr.Clocks) < len(gdr.History) {
+		gdr.Clocks = append(gdr.Clocks, MoveClock{
+			At: gdr.LastUpdated, BTime: gdr.BTime, WTime: gdr.WTime,
+		})
+	}
+	gdr.Paused = g.Paused
+	gdr.HandedOff = g.HandedOff
+	gdr.AgainstBot = g.AgainstBot
+	gdr.Exhibition = g.Exhibition
+	gdr.BotLevel = g.BotLevel
+	gdr.BlackLevel = g.BlackLevel
 	if state, err := g.Board.Encode(); err != nil {
 		log.Println("Error encoding board state:", err)
 	} else {
@@ -238,16 +293,10 @@ func updateStateInRedis(g *Game) {
 	}
 }
 
-func handleMove(g *Game, msgBytes []byte) error {
-	var moveMsg MoveMsg
+func handleMove(g *Game, moveMsg *MoveMsg) error {
 	var moveStatus MoveStatusMsg
-	moveMsg.Type = "move"
 	moveStatus.Type = "movestatus"
 
-	if err := json.Unmarshal(msgBytes, &moveMsg); err != nil {
-		return fmt.Errorf("Error unmarshing move msg: %v", err)
-	}
-
 	if ok := g.CheckTurn(g.Player.Color); !ok {
 		moveStatus.MoveStatus = false
 		moveStatus.TurnStatus = false
@@ -269,6 +318,16 @@ func handleMove(g *Game, msgBytes []byte) error {
 		return nil
 	}
 
+	return playOwnMove(g, moveMsg.Move)
+}
+
+// playOwnMove finishes a move of the player that is already placed on the
+// board: it taps the clock, acknowledges the move to the client and
+// forwards it to the opponent.
+func playOwnMove(g *Game, move string) error {
+	var moveStatus MoveStatusMsg
+	moveStatus.Type = "movestatus"
+
 	g.TapClock(g.Player.Color)
 	g.Turn = 1 - g.Player.Color
 
@@ -277,7 +336,8 @@ func handleMove(g *Game, msgBytes []byte) error {
 	moveStatus.MoveStatus = true
 	moveStatus.TurnStatus = true
 	moveStatus.State, _ = g.Board.Encode()
-	moveStatus.Move = moveMsg.Move
+	moveStatus.Move = move
+	moveStatus.Captures = g.Captures
 	moveStatus.SelfTime = g.GetTime(g.Player.Color)
 	moveStatus.OpTime = g.GetTime(1 - g.Player.Color)
 
@@ -286,11 +346,12 @@ func handleMove(g *Game, msgBytes []byte) error {
 	}
 
 	jsonData := make(map[string]any)
-	jsonData["type"] = moveMsg.Type
-	jsonData["move"] = moveMsg.Move
+	jsonData["type"] = "move"
+	jsonData["move"] = move
 	jsonData["state"] = moveStatus.State
 	jsonData["selfTime"] = moveStatus.SelfTime
 	jsonData["opTime"] = moveStatus.OpTime
+	jsonData["moveNo"] = len(g.History)
 
 	sendToPubsub(g, jsonData, "move")
 	return nil
@@ -304,18 +365,31 @@ func handleRecv(g *Game) error {
 		return fmt.Errorf("Error in reading on player %v: %v", g.Player.Color, err)
 	}
 
-	var msg MsgType
-	if err := json.Unmarshal(msgBytes, &msg); err != nil {
-		return fmt.Errorf("Error unmarshaling msg type: %v", err)
+	msgType, msg, err := protocol.Decode(msgBytes)
+	if err != nil {
+		// a refused message does not end the game
+		sendError(g, err)
+		return nil
 	}
 
-	switch msg.Type {
+	if g.Ended {
+		if msgType == "rematch" {
+			handleRematch(g, msg.(*RematchMsg))
+		}
+		return nil
+	}
+
+	switch msgType {
 	case "move":
-		if err := handleMove(g, msgBytes); err != nil {
+		g.Mu.Lock()
+		err := handleMove(g, msg.(*MoveMsg))
+		winner := g.IsOver()
+		g.Mu.Unlock()
+		if err != nil {
 			return err
 		}
 
-		if winner := g.Player.Game.IsOver(); winner != -1 {
+		if winner != -1 {
 			handleGameOver(g, winner, "move")
 			return fmt.Errorf("Game over by move")
 		}
@@ -329,7 +403,23 @@ func handleRecv(g *Game) error {
 		handleSyncState(g)
 
 	case "chat":
-		handleChat(g, msgBytes)
+		handleChat(g, msg.(*ChatMsg))
+
+	case "conditional":
+		handleConditional(g, msg.(*ConditionalMsg))
+
+	case "pause":
+		g.Mu.Lock()
+		handlePause(g, msg.(*PauseMsg))
+		g.Mu.Unlock()
+
+	case "adjourn":
+		g.Mu.Lock()
+		handleAdjourn(g, msg.(*PauseMsg))
+		g.Mu.Unlock()
+
+	case "estimate", "hint":
+		handleAnalysis(g, msgType, nil)
 	}
 
 	return nil
@@ -341,20 +431,40 @@ func sendToClient(g *Game, msgBytes []byte) {
 	}
 }
 
+// handlePubsubMove applies the opponent's move and answers it from the
+// conditional move tree if there is a matching reply.
 func handlePubsubMove(g *Game, msgBytes []byte) {
 	var moveMsg MoveMsg
 	if err := json.Unmarshal(msgBytes, &moveMsg); err != nil {
 		log.Println("Error unmarshing move msg:", err)
 	}
 
+	// the reply is played under the same lock as the opponent's move, the
+	// player cannot move in between
+	g.Mu.Lock()
+	if !playPubsubMove(g, moveMsg) {
+		g.Mu.Unlock()
+		return
+	}
+	winner := g.IsOver()
+	g.Mu.Unlock()
+
+	if winner != -1 {
+		handleGameOver(g, winner, "move")
+	}
+}
+
+// playPubsubMove plays the opponent's move and the conditional reply to it,
+// it returns true if a reply was played.
+func playPubsubMove(g *Game, moveMsg MoveMsg) bool {
 	if ok := g.CheckTurn(1 - g.Player.Color); !ok {
 		fmt.Println("Not your turn")
-		return
+		return false
 	}
 
 	if _, err := g.UpdateState(moveMsg.Move, 1-g.Player.Color); err != nil {
 		fmt.Println("Error in updateState", err)
-		return
+		return false
 	}
 
 	g.TapClock(1 - g.Player.Color)
@@ -363,12 +473,15 @@ func handlePubsubMove(g *Game, msgBytes []byte) {
 	// just switch the timing that op has sent, because it has sent the
 	// timings with its perspective, we need to swap it
 	moveMsg.SelfTime, moveMsg.OpTime = moveMsg.OpTime, moveMsg.SelfTime
+	moveMsg.Captures = g.Captures
 
 	if rawjson, err := json.Marshal(moveMsg); err != nil {
 		log.Println("Error marshalling moveMsg in handlePubsubMove:", err)
 	} else {
 		sendToClient(g, rawjson)
 	}
+
+	return playConditional(g, moveMsg.Move)
 }
 
 func handleGameOverPubsub(g *Game, msgBytes []byte) {
@@ -381,17 +494,16 @@ func handleGameOverPubsub(g *Game, msgBytes []byte) {
 		log.Println("Error sending gameOverMsg msg to p:", err)
 	}
 
-	if err := g.Player.Wsc.Close(); err != nil {
-		log.Println("Error closing conn loser:", err)
-	}
+	waitForRematch(g)
 
 	if err := updateRating(g, gameOverMsg.Winner); err != nil {
 		log.Println("Error saving game state:", err)
 	}
 
-	delete(Pmap, g.Player.Username)
+	RemoveGame(g.Player.Username)
 	deleteFromRedis(g.Player.Username)
 	deleteFromRedis(g.Id)
+	instance.ForgetGame(g.Id)
 	close(g.Over)
 }
 
@@ -405,6 +517,10 @@ func PubsubRecv(g *Game) {
 		log.Println("Subscription to redis channel failed")
 	}
 
+	if g.AwaitingResume {
+		sendToPubsub(g, PauseMsg{Type: "adjourn", Action: "rejoin"}, "adjourn")
+	}
+
 	ch := ps.Channel()
 RecvLoop:
 	for msg := range ch {
@@ -422,12 +538,27 @@ RecvLoop:
 		case "move":
 			handlePubsubMove(g, pubsubMsg.Data)
 
-		case "chat":
+		case "chat", "spectators":
 			sendToClient(g, pubsubMsg.Data)
 
+		case "pause":
+			g.Mu.Lock()
+			handlePausePubsub(g, pubsubMsg.Data)
+			g.Mu.Unlock()
+
+		case "adjourn":
+			g.Mu.Lock()
+			adjourned := handleAdjournPubsub(g, pubsubMsg.Data)
+			g.Mu.Unlock()
+			if adjourned {
+				break RecvLoop
+			}
+
 		case "gameover":
 			handleGameOverPubsub(g, pubsubMsg.Data)
-			break RecvLoop
+
+		case "rematch":
+			handleRematchPubsub(g, pubsubMsg.Data)
 		}
 	}
 
@@ -446,7 +577,10 @@ func PlayGame(g *Game) {
 
 		if g.Player.DisConn {
 			log.Println("Player diconnected")
-			if err := g.Player.Ps.Unsubscribe(pubsub.RdbCtx, g.Id); err != nil {
+			if g.Ended {
+				// the rematch window is over, which also ends PubsubRecv
+				g.Player.Ps.Close()
+			} else if err := g.Player.Ps.Unsubscribe(pubsub.RdbCtx, g.Id); err != nil {
 				log.Println("Error Unsubscribing to channel")
 			}
 			break
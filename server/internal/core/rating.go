@@ -0,0 +1,220 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	"github.com/vanshjangir/rapid-go/server/internal/database"
+)
+
+const (
+	DEFAULT_RATING = 400
+
+	// ratings stay provisional, and move faster, for the first games played
+	// in a category
+	PROVISIONAL_GAMES = 20
+	PROVISIONAL_K     = 40
+	ESTABLISHED_K     = 20
+
+	// ranks are 100 rating points apart, 1 dan starts at FIRST_DAN_RATING
+	FIRST_DAN_RATING = 2100
+	MAX_KYU          = 30
+	MAX_DAN          = 9
+
+	SPEED_BLITZ     = "blitz"
+	SPEED_RAPID     = "rapid"
+	SPEED_CLASSICAL = "classical"
+	SPEED_BOT       = "bot"
+)
+
+type Rating struct {
+	Size        int    `json:"size"`
+	Category    string `json:"category"`
+	Rating      int    `json:"rating"`
+	Games       int    `json:"games"`
+	Peak        int    `json:"peak"`
+	Provisional bool   `json:"provisional"`
+	Rank        string `json:"rank"`
+}
+
+// RatingToRank maps a rating to a kyu or dan rank, like "12k" or "3d".
+func RatingToRank(rating int) string {
+	if rating >= FIRST_DAN_RATING {
+		dan := (rating-FIRST_DAN_RATING)/100 + 1
+		if dan > MAX_DAN {
+			dan = MAX_DAN
+		}
+		return fmt.Sprintf("%dd", dan)
+	}
+
+	kyu := (FIRST_DAN_RATING-1-rating)/100 + 1
+	if kyu > MAX_KYU {
+		kyu = MAX_KYU
+	}
+	return fmt.Sprintf("%dk", kyu)
+}
+
+// RankString is the rank shown to players, with a "?" while the rating is
+// provisional.
+func RankString(rating int, provisional bool) string {
+	if provisional {
+		return RatingToRank(rating) + "?"
+	}
+	return RatingToRank(rating)
+}
+
+func (r *Rating) setRank() {
+	r.Provisional = r.Games < PROVISIONAL_GAMES
+	r.Rank = RankString(r.Rating, r.Provisional)
+}
+
+// SpeedCategory groups time controls, given as main time in milliseconds,
+// so that each group is rated on its own.
+func SpeedCategory(mainTime int64) string {
+	if mainTime <= 5*60*1000 {
+		return SPEED_BLITZ
+	} else if mainTime <= 20*60*1000 {
+		return SPEED_RAPID
+	}
+	return SPEED_CLASSICAL
+}
+
+// RatingCategory is the category the game is rated in, games against the
+// bot have one of their own.
+func (g *Game) RatingCategory() string {
+	if g.AgainstBot {
+		return SPEED_BOT
+	}
+	return SpeedCategory(g.Settings.MainTime)
+}
+
+// initialRating is the rating a player starts from in every category. Bots
+// start from the rating of their engine level.
+func initialRating(username string) int {
+	if level, ok := BotLevel(username); ok {
+		return BotRating(level)
+	}
+	return DEFAULT_RATING
+}
+
+// GetRatingInfo returns the rating of a player in a board size and
+// category, or the initial provisional rating if the player has not played
+// there yet.
+func GetRatingInfo(username string, size int, category string) Rating {
+	db := database.GetDatabase()
+	query := `
+	SELECT rating, games, peak FROM ratings
+	WHERE username = $1 AND size = $2 AND category = $3`
+
+	r := Rating{Size: size, Category: category, Rating: initialRating(username)}
+	err := db.QueryRow(query, username, size, category).Scan(
+		&r.Rating, &r.Games, &r.Peak,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Error fetching rating", err)
+	}
+	r.setRank()
+	return r
+}
+
+func GetRating(username string, size int, category string) int {
+	return GetRatingInfo(username, size, category).Rating
+}
+
+// LoadRatings fetches the ratings of both players in the category of the
+// game. The opponent's rating is kept from the start of the game, so the
+// result is rated against it even if the opponent's rating changes first.
+func (g *Game) LoadRatings() {
+	category := g.RatingCategory()
+	self := GetRatingInfo(g.Player.Username, g.Settings.Size, category)
+	op := GetRatingInfo(g.OpName, g.Settings.Size, category)
+
+	g.Player.Rating = self.Rating
+	g.Player.Provisional = self.Provisional
+	g.OpRating = op.Rating
+	g.OpProvisional = op.Provisional
+}
+
+// GetRatings returns all ratings of a player.
+func GetRatings(username string) ([]Rating, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT size, category, rating, games, peak FROM ratings
+	WHERE username = $1 ORDER BY size DESC, category`
+
+	ratings := []Rating{}
+	rows, err := db.Query(query, username)
+	if err != nil {
+		return ratings, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Rating
+		if err := rows.Scan(
+			&r.Size, &r.Category, &r.Rating, &r.Games, &r.Peak,
+		); err != nil {
+			return ratings, err
+		}
+		r.setRank()
+		ratings = append(ratings, r)
+	}
+	return ratings, nil
+}
+
+func getNewRating(pr int, opr int, won bool, provisional bool) int {
+	score := 1.0
+	if won == false {
+		score = 0
+	}
+	expectedScore := 1 / (1 + math.Pow(10, float64(opr-pr)/400))
+	var k float64 = ESTABLISHED_K
+	if provisional {
+		k = PROVISIONAL_K
+	}
+	newRating := float64(pr) + k*(score-expectedScore)
+	return int(math.Round(newRating))
+}
+
+func saveRating(username string, size int, category string, rating int) error {
+	db := database.GetDatabase()
+	query := `
+	INSERT INTO ratings (username, size, category, rating, games, peak)
+	VALUES ($1, $2, $3, $4, 1, $4)
+	ON CONFLICT (username, size, category) DO UPDATE SET
+	rating = $4, games = ratings.games + 1,
+	peak = GREATEST(ratings.peak, $4)`
+	_, err := db.Exec(query, username, size, category, rating)
+	return err
+}
+
+// updateRating saves the player's new rating after a rated game. Against a
+// human each side saves its own, the bot's rating is saved along with the
+// player's when RATE_BOTS is set.
+func updateRating(g *Game, winner int) error {
+	if !g.Settings.Rated {
+		return nil
+	}
+
+	category := g.RatingCategory()
+	won := winner == g.Player.Color
+	newRating := getNewRating(
+		g.Player.Rating, g.OpRating, won, g.Player.Provisional,
+	)
+	if err := saveRating(
+		g.Player.Username, g.Settings.Size, category, newRating,
+	); err != nil {
+		return err
+	}
+
+	if g.AgainstBot && os.Getenv("RATE_BOTS") == "true" {
+		botRating := getNewRating(
+			g.OpRating, g.Player.Rating, !won, g.OpProvisional,
+		)
+		return saveRating(g.OpName, g.Settings.Size, category, botRating)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package core
+
+import "testing"
+
+func TestGetNewRating(t *testing.T) {
+	tests := []struct {
+		name        string
+		pr, opr     int
+		won         bool
+		provisional bool
+		want        int
+	}{
+		{name: "even win", pr: 1500, opr: 1500, won: true, want: 1510},
+		{name: "even loss", pr: 1500, opr: 1500, won: false, want: 1490},
+		{
+			name: "even provisional win", pr: 1500, opr: 1500, won: true,
+			provisional: true, want: 1520,
+		},
+		{name: "upset win", pr: 1500, opr: 1900, won: true, want: 1518},
+		{name: "expected win", pr: 1900, opr: 1500, won: true, want: 1902},
+		{name: "upset loss", pr: 1900, opr: 1500, won: false, want: 1882},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getNewRating(tt.pr, tt.opr, tt.won, tt.provisional)
+			if got != tt.want {
+				t.Errorf("getNewRating(%d, %d, %v, %v) = %d, want %d",
+					tt.pr, tt.opr, tt.won, tt.provisional, got, tt.want)
+			}
+		})
+	}
+}
+
+// both sides rate the game against the other's rating from its start, so
+// established players exchange the same points.
+func TestGetNewRatingSymmetric(t *testing.T) {
+	for _, pair := range [][2]int{{1500, 1500}, {1234, 1876}, {400, 2400}} {
+		a, b := pair[0], pair[1]
+		gain := getNewRating(a, b, true, false) - a
+		loss := b - getNewRating(b, a, false, false)
+		if diff := gain - loss; diff < -1 || diff > 1 {
+			t.Errorf("%d beating %d gains %d, loser drops %d", a, b, gain, loss)
+		}
+	}
+}
+
+func TestRatingToRank(t *testing.T) {
+	tests := []struct {
+		rating int
+		want   string
+	}{
+		{rating: FIRST_DAN_RATING, want: "1d"},
+		{rating: FIRST_DAN_RATING - 1, want: "1k"},
+		{rating: FIRST_DAN_RATING - 100, want: "1k"},
+		{rating: FIRST_DAN_RATING - 101, want: "2k"},
+		{rating: FIRST_DAN_RATING + 99, want: "1d"},
+		{rating: FIRST_DAN_RATING + 100, want: "2d"},
+		{rating: DEFAULT_RATING, want: "17k"},
+		{rating: 5000, want: "9d"},
+		{rating: -1000, want: "30k"},
+	}
+
+	for _, tt := range tests {
+		if got := RatingToRank(tt.rating); got != tt.want {
+			t.Errorf("RatingToRank(%d) = %q, want %q", tt.rating, got, tt.want)
+		}
+	}
+}
+
+func TestRankString(t *testing.T) {
+	if got := RankString(2250, true); got != "2d?" {
+		t.Errorf("RankString(2250, true) = %q, want %q", got, "2d?")
+	}
+	if got := RankString(2250, false); got != "2d" {
+		t.Errorf("RankString(2250, false) = %q, want %q", got, "2d")
+	}
+}
+
+func TestSetRank(t *testing.T) {
+	r := Rating{Rating: 1000, Games: PROVISIONAL_GAMES - 1}
+	r.setRank()
+	if !r.Provisional || r.Rank != "11k?" {
+		t.Errorf("after %d games got %q, provisional %v",
+			r.Games, r.Rank, r.Provisional)
+	}
+
+	r.Games = PROVISIONAL_GAMES
+	r.setRank()
+	if r.Provisional || r.Rank != "11k" {
+		t.Errorf("after %d games got %q, provisional %v",
+			r.Games, r.Rank, r.Provisional)
+	}
+}
+
+func TestSpeedCategory(t *testing.T) {
+	tests := []struct {
+		mainTime int64
+		want     string
+	}{
+		{mainTime: 60 * 1000, want: SPEED_BLITZ},
+		{mainTime: 5 * 60 * 1000, want: SPEED_BLITZ},
+		{mainTime: 5*60*1000 + 1, want: SPEED_RAPID},
+		{mainTime: 20 * 60 * 1000, want: SPEED_RAPID},
+		{mainTime: 30 * 60 * 1000, want: SPEED_CLASSICAL},
+	}
+
+	for _, tt := range tests {
+		if got := SpeedCategory(tt.mainTime); got != tt.want {
+			t.Errorf("SpeedCategory(%d) = %q, want %q", tt.mainTime, got, tt.want)
+		}
+	}
+}
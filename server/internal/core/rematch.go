@@ -0,0 +1,125 @@
+package core
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
+)
+
+const REMATCH_WINDOW = 30 * time.Second
+
+// RegisterGame sets up a new game between two players in the same way the
+// matchmaker does. It is provided by the routes package.
+var RegisterGame func(
+	gameId string, black string, white string, settings GameSettings,
+)
+
+// waitForRematch keeps the connection of a finished game open for a short
+// while, in which the players can only offer and accept a rematch. Once the
+// read deadline passes PlayGame closes the connection.
+func waitForRematch(g *Game) {
+	g.Ended = true
+	g.Offer = ""
+	g.OpOffer = ""
+	if err := g.Player.Wsc.SetReadDeadline(time.Now().Add(REMATCH_WINDOW)); err != nil {
+		log.Println("Error setting rematch deadline:", err)
+	}
+}
+
+func sendRematchMsg(g *Game, rematchMsg RematchMsg) {
+	if err := g.Player.Wsc.WriteJSON(rematchMsg); err != nil {
+		log.Println("Error sending rematch msg:", err)
+	}
+}
+
+// claimRematch makes sure only one rematch is started from a game, when both
+// players accept at once. Only the caller for which it returns true may
+// start it, the other player hears about it from the start message.
+func claimRematch(g *Game) bool {
+	claimed, err := pubsub.Rdb.SetNX(
+		pubsub.RdbCtx, "rematch:"+g.Id, g.Player.Username, 2*REMATCH_WINDOW,
+	).Result()
+	if err != nil {
+		log.Println("Error claiming rematch:", err)
+		return false
+	}
+	return claimed
+}
+
+// startRematch creates the new game with swapped colors and the settings of
+// the finished one.
+func startRematch(g *Game) string {
+	gameId := GetUniqueId()
+	black, white := g.OpName, g.Player.Username
+	if g.Player.Color == WhiteCell {
+		black, white = white, black
+	}
+
+	RegisterGame(gameId, black, white, g.Settings)
+	return gameId
+}
+
+func handleRematch(g *Game, rematchMsg *RematchMsg) {
+	switch rematchMsg.Action {
+	case "offer":
+		g.Offer = "rematch"
+		sendToPubsub(g, RematchMsg{Type: "rematch", Action: "offer"}, "rematch")
+
+	case "decline":
+		if g.OpOffer != "rematch" {
+			return
+		}
+		g.OpOffer = ""
+		sendToPubsub(g, RematchMsg{Type: "rematch", Action: "decline"}, "rematch")
+
+	case "accept":
+		if g.OpOffer != "rematch" || RegisterGame == nil {
+			return
+		}
+		g.OpOffer = ""
+		if !claimRematch(g) {
+			return
+		}
+
+		startMsg := RematchMsg{
+			Type:   "rematch",
+			Action: "start",
+			GameId: startRematch(g),
+		}
+		sendToPubsub(g, startMsg, "rematch")
+		sendRematchMsg(g, startMsg)
+	}
+}
+
+func handleRematchPubsub(g *Game, msgBytes []byte) {
+	if !g.Ended {
+		return
+	}
+
+	var rematchMsg RematchMsg
+	if err := json.Unmarshal(msgBytes, &rematchMsg); err != nil {
+		log.Println("Error unmarshaling rematch msg:", err)
+		return
+	}
+
+	switch rematchMsg.Action {
+	case "offer":
+		g.OpOffer = "rematch"
+
+	case "decline":
+		g.Offer = ""
+
+	case "start":
+		if g.Offer != "rematch" {
+			return
+		}
+		g.Offer = ""
+
+	default:
+		return
+	}
+
+	sendRematchMsg(g, rematchMsg)
+}
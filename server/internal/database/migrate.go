@@ -0,0 +1,76 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+)
+
+// The schema is kept as numbered migrations, applied in order by Migrate.
+// Migrations are written to also run on databases created before they
+// existed, with IF NOT EXISTS.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// MIGRATION_LOCK is the advisory lock held while migrating, both servers
+// migrate when they start.
+const MIGRATION_LOCK = 7301
+
+// Migrate applies the migrations that have not been applied yet.
+func Migrate() error {
+	db := GetDatabase()
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"SELECT pg_advisory_xact_lock($1)", MIGRATION_LOCK,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		name TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		var applied bool
+		query := "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE name = $1)"
+		if err := tx.QueryRow(query, name).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		stmt, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(stmt)); err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		insertQuery := "INSERT INTO schema_migrations (name) VALUES ($1)"
+		if _, err := tx.Exec(insertQuery, name); err != nil {
+			return err
+		}
+		log.Println("Applied migration", name)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,20 @@
+-- The tables the first version of the server was written against.
+
+CREATE TABLE IF NOT EXISTS users (
+	username TEXT PRIMARY KEY,
+	email TEXT UNIQUE,
+	password TEXT,
+	rating INTEGER NOT NULL DEFAULT 400,
+	highestrating INTEGER NOT NULL DEFAULT 400,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS games (
+	gameid TEXT PRIMARY KEY,
+	black TEXT,
+	white TEXT,
+	winner INTEGER,
+	wonby TEXT,
+	moves TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
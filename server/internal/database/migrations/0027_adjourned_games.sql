@@ -0,0 +1,7 @@
+-- Adjourned games keep their moves and clocks until they are resumed.
+
+ALTER TABLE games ADD COLUMN IF NOT EXISTS adjourned BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS btime BIGINT;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS wtime BIGINT;
+
+CREATE INDEX IF NOT EXISTS games_adjourned ON games (adjourned) WHERE adjourned;
@@ -0,0 +1,41 @@
+-- Tournaments, their players and the games of every round. A bye is a game
+-- without a white player, a double forfeit a finished game without a winner.
+
+CREATE TABLE IF NOT EXISTS tournaments (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL DEFAULT '',
+	format TEXT NOT NULL,
+	rounds INTEGER NOT NULL DEFAULT 0,
+	mcmahonbar INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL,
+	currentround INTEGER NOT NULL DEFAULT 0,
+	createdby TEXT NOT NULL REFERENCES users (username),
+	size INTEGER NOT NULL,
+	maintime BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS tournament_players (
+	tournamentid TEXT NOT NULL REFERENCES tournaments (id),
+	username TEXT NOT NULL REFERENCES users (username),
+	rating INTEGER NOT NULL,
+	joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (tournamentid, username)
+);
+
+CREATE TABLE IF NOT EXISTS tournament_games (
+	tournamentid TEXT NOT NULL REFERENCES tournaments (id),
+	round INTEGER NOT NULL,
+	board INTEGER NOT NULL,
+	gameid TEXT PRIMARY KEY,
+	black TEXT NOT NULL,
+	white TEXT NOT NULL DEFAULT '',
+	winner INTEGER,
+	done BOOLEAN NOT NULL DEFAULT false,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS tournament_games_round
+	ON tournament_games (tournamentid, round);
+CREATE INDEX IF NOT EXISTS tournament_games_pending
+	ON tournament_games (created_at) WHERE NOT done;
@@ -0,0 +1,28 @@
+-- Arenas, their players' scores and the games played in them. done marks the
+-- games that have been scored, so that a result is only scored once.
+
+CREATE TABLE IF NOT EXISTS arenas (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL DEFAULT '',
+	startsat TIMESTAMPTZ NOT NULL,
+	duration INTEGER NOT NULL,
+	createdby TEXT NOT NULL REFERENCES users (username),
+	size INTEGER NOT NULL,
+	maintime BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS arena_players (
+	arenaid TEXT NOT NULL REFERENCES arenas (id),
+	username TEXT NOT NULL REFERENCES users (username),
+	score INTEGER NOT NULL DEFAULT 0,
+	games INTEGER NOT NULL DEFAULT 0,
+	wins INTEGER NOT NULL DEFAULT 0,
+	streak INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (arenaid, username)
+);
+
+CREATE TABLE IF NOT EXISTS arena_games (
+	arenaid TEXT NOT NULL REFERENCES arenas (id),
+	gameid TEXT PRIMARY KEY,
+	done BOOLEAN NOT NULL DEFAULT false
+);
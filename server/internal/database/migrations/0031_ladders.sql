@@ -0,0 +1,40 @@
+-- Ladders, their players' positions and the challenges between them.
+
+CREATE TABLE IF NOT EXISTS ladders (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL DEFAULT '',
+	maxchallenge INTEGER NOT NULL,
+	timeout INTEGER NOT NULL,
+	createdby TEXT NOT NULL REFERENCES users (username),
+	size INTEGER NOT NULL,
+	maintime BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ladder_players (
+	ladderid TEXT NOT NULL REFERENCES ladders (id),
+	username TEXT NOT NULL REFERENCES users (username),
+	position INTEGER NOT NULL,
+	PRIMARY KEY (ladderid, username)
+);
+
+CREATE TABLE IF NOT EXISTS ladder_challenges (
+	id TEXT PRIMARY KEY,
+	ladderid TEXT NOT NULL REFERENCES ladders (id),
+	challenger TEXT NOT NULL,
+	defender TEXT NOT NULL,
+	gameid TEXT,
+	status TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	accepted_at TIMESTAMPTZ
+);
+
+-- A player has at most one open challenge on a ladder. The indexes hold it
+-- for each side of a challenge, insertChallenge also checks across sides.
+CREATE UNIQUE INDEX IF NOT EXISTS ladder_challenges_open_challenger
+	ON ladder_challenges (ladderid, challenger)
+	WHERE status IN ('pending', 'playing');
+CREATE UNIQUE INDEX IF NOT EXISTS ladder_challenges_open_defender
+	ON ladder_challenges (ladderid, defender)
+	WHERE status IN ('pending', 'playing');
+CREATE INDEX IF NOT EXISTS ladder_challenges_gameid
+	ON ladder_challenges (gameid);
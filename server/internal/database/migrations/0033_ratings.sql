@@ -0,0 +1,36 @@
+-- Ratings are kept per board size and speed category. Games remember the
+-- settings they were played with, older games have none.
+
+CREATE TABLE IF NOT EXISTS ratings (
+	username TEXT NOT NULL REFERENCES users (username),
+	size INTEGER NOT NULL,
+	category TEXT NOT NULL,
+	rating INTEGER NOT NULL,
+	games INTEGER NOT NULL DEFAULT 0,
+	peak INTEGER NOT NULL,
+	PRIMARY KEY (username, size, category)
+);
+
+CREATE INDEX IF NOT EXISTS ratings_category
+	ON ratings (size, category, rating DESC);
+
+ALTER TABLE games ADD COLUMN IF NOT EXISTS size INTEGER;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS maintime BIGINT;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS category TEXT;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS rated BOOLEAN;
+
+-- The single rating players had until now was earned with the default
+-- settings, 19x19 with 15 minutes, and carries over to that category along
+-- with the games it was earned in. Older games against the bot have it
+-- playing white.
+WITH played AS (
+	SELECT u.username, u.rating, GREATEST(u.rating, u.highestrating) AS peak,
+	(SELECT COUNT(*) FROM games g
+	WHERE (g.black = u.username OR g.white = u.username)
+	AND g.winner IS NOT NULL AND g.white <> 'bot') AS games
+	FROM users u
+)
+INSERT INTO ratings (username, size, category, rating, games, peak)
+SELECT username, 19, 'rapid', rating, games, peak
+FROM played WHERE games > 0 OR rating <> 400
+ON CONFLICT (username, size, category) DO NOTHING;
@@ -0,0 +1,14 @@
+-- Daily copies of the ratings, which the leaderboard movers are compared
+-- against.
+
+CREATE TABLE IF NOT EXISTS leaderboard_snapshots (
+	taken_at TIMESTAMPTZ NOT NULL,
+	size INTEGER NOT NULL,
+	category TEXT NOT NULL,
+	username TEXT NOT NULL,
+	rating INTEGER NOT NULL,
+	PRIMARY KEY (size, category, taken_at, username)
+);
+
+CREATE INDEX IF NOT EXISTS games_black ON games (black, created_at);
+CREATE INDEX IF NOT EXISTS games_white ON games (white, created_at);
@@ -0,0 +1,11 @@
+-- Engine analysis of finished games, moves holds one entry per move.
+
+CREATE TABLE IF NOT EXISTS game_analysis (
+	gameid TEXT PRIMARY KEY,
+	status TEXT NOT NULL,
+	moves JSONB NOT NULL DEFAULT '[]',
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS game_analysis_pending
+	ON game_analysis (updated_at) WHERE status = 'pending';
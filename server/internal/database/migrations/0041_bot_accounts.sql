@@ -0,0 +1,13 @@
+-- Bot accounts are users owned by a player, they sign in with API keys of
+-- which only the hash is kept.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS isbot BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS owner TEXT REFERENCES users (username);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+	keyhash TEXT PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES users (username),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_username ON api_keys (username);
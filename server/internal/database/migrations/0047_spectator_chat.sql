@@ -0,0 +1,12 @@
+-- Chat of the spectators of a game, shown to the players once it is over.
+
+CREATE TABLE IF NOT EXISTS spectator_chat (
+	id BIGSERIAL PRIMARY KEY,
+	gameid TEXT NOT NULL,
+	username TEXT NOT NULL,
+	message TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS spectator_chat_game
+	ON spectator_chat (gameid, created_at);
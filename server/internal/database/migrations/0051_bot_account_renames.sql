@@ -0,0 +1,9 @@
+-- Renaming a user carries over to the bots they own and to their API keys.
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_owner_fkey;
+ALTER TABLE users ADD CONSTRAINT users_owner_fkey
+	FOREIGN KEY (owner) REFERENCES users (username) ON UPDATE CASCADE;
+
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS api_keys_username_fkey;
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_username_fkey
+	FOREIGN KEY (username) REFERENCES users (username) ON UPDATE CASCADE;
@@ -0,0 +1,12 @@
+-- Guests have no row in users, yet they can be rated and play in
+-- tournaments, arenas and ladders, so usernames there are not foreign keys
+-- to users.
+
+ALTER TABLE ratings DROP CONSTRAINT IF EXISTS ratings_username_fkey;
+ALTER TABLE tournaments DROP CONSTRAINT IF EXISTS tournaments_createdby_fkey;
+ALTER TABLE tournament_players
+	DROP CONSTRAINT IF EXISTS tournament_players_username_fkey;
+ALTER TABLE arenas DROP CONSTRAINT IF EXISTS arenas_createdby_fkey;
+ALTER TABLE arena_players DROP CONSTRAINT IF EXISTS arena_players_username_fkey;
+ALTER TABLE ladders DROP CONSTRAINT IF EXISTS ladders_createdby_fkey;
+ALTER TABLE ladder_players DROP CONSTRAINT IF EXISTS ladder_players_username_fkey;
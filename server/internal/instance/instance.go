@@ -0,0 +1,210 @@
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
+)
+
+const (
+	INSTANCE_HASH      = "ws_instances"
+	GAME_INSTANCE_HASH = "game_instance"
+	HEARTBEAT_INTERVAL = 5 * time.Second
+	INSTANCE_TIMEOUT   = 3 * HEARTBEAT_INTERVAL
+)
+
+// Instance is a websocket server. Its Url is what clients connect to, the
+// WSURL of that server, and doubles as its id.
+type Instance struct {
+	Url      string    `json:"url"`
+	Games    int       `json:"games"`
+	Draining bool      `json:"draining"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Self is this websocket server, it is nil in the backend. Its Url does not
+// change once registered, the other fields are only used under selfMu,
+// which is held while they are saved so that an older copy never overwrites
+// a newer one.
+var (
+	Self   *Instance
+	selfMu sync.Mutex
+)
+
+func (inst Instance) alive() bool {
+	return time.Since(inst.LastSeen) < INSTANCE_TIMEOUT
+}
+
+func save(inst Instance) error {
+	jsondata, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	return pubsub.Rdb.HSet(
+		pubsub.RdbCtx, INSTANCE_HASH, inst.Url, jsondata,
+	).Err()
+}
+
+// Register adds this server to the registry, RunHeartbeat keeps it there.
+func Register(url string) {
+	selfMu.Lock()
+	defer selfMu.Unlock()
+	Self = &Instance{Url: url, LastSeen: time.Now()}
+	if err := save(*Self); err != nil {
+		log.Println("Error registering instance:", err)
+	}
+}
+
+// RunHeartbeat refreshes this server's entry with its number of games.
+// Entries that miss three heartbeats are treated as gone.
+func RunHeartbeat(games func() int) {
+	for {
+		count := games()
+		selfMu.Lock()
+		Self.Games = count
+		Self.LastSeen = time.Now()
+		if err := save(*Self); err != nil {
+			log.Println("Error sending heartbeat:", err)
+		}
+		selfMu.Unlock()
+		time.Sleep(HEARTBEAT_INTERVAL)
+	}
+}
+
+// SetDraining stops new games from being placed on this server and moves
+// the games it owns to other instances.
+func SetDraining(draining bool) {
+	selfMu.Lock()
+	defer selfMu.Unlock()
+	Self.Draining = draining
+	if err := save(*Self); err != nil {
+		log.Println("Error updating instance:", err)
+	}
+}
+
+// Unregister removes this server from the registry.
+func Unregister() {
+	err := pubsub.Rdb.HDel(pubsub.RdbCtx, INSTANCE_HASH, Self.Url).Err()
+	if err != nil {
+		log.Println("Error removing instance:", err)
+	}
+}
+
+func get(url string) (Instance, bool) {
+	var inst Instance
+	jsondata, err := pubsub.Rdb.HGet(pubsub.RdbCtx, INSTANCE_HASH, url).Result()
+	if err != nil {
+		return inst, false
+	}
+	if err := json.Unmarshal([]byte(jsondata), &inst); err != nil {
+		return inst, false
+	}
+	return inst, true
+}
+
+// Available returns the instances that can take new games.
+func Available() ([]Instance, error) {
+	entries, err := pubsub.Rdb.HGetAll(pubsub.RdbCtx, INSTANCE_HASH).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []Instance{}
+	for _, jsondata := range entries {
+		var inst Instance
+		if err := json.Unmarshal([]byte(jsondata), &inst); err != nil {
+			log.Println("Error unmarshalling instance:", err)
+			continue
+		}
+		if inst.alive() && !inst.Draining {
+			instances = append(instances, inst)
+		}
+	}
+	return instances, nil
+}
+
+// Url returns the least loaded instance, for connections that are not tied
+// to a game. Without a registry, as in development, it is WSURL.
+func Url() string {
+	instances, err := Available()
+	if err != nil || len(instances) == 0 {
+		return os.Getenv("WSURL")
+	}
+
+	best := instances[0]
+	for _, inst := range instances[1:] {
+		if inst.Games < best.Games {
+			best = inst
+		}
+	}
+	return best.Url
+}
+
+func weight(gameId string, url string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(gameId + "/" + url))
+	return h.Sum64()
+}
+
+// pick chooses the instance for a game by rendezvous hashing, so servers
+// placing the same game at the same time agree on where it goes.
+func pick(gameId string) (string, error) {
+	instances, err := Available()
+	if err != nil {
+		return "", err
+	}
+	if len(instances) == 0 {
+		return "", fmt.Errorf("no websocket instance available")
+	}
+
+	best := instances[0].Url
+	for _, inst := range instances[1:] {
+		if weight(gameId, inst.Url) > weight(gameId, best) {
+			best = inst.Url
+		}
+	}
+	return best, nil
+}
+
+// GameUrl returns the instance that owns the game. A game is placed on an
+// instance the first time it is asked for, and moved to another one when
+// its instance is draining or has stopped sending heartbeats.
+func GameUrl(gameId string) string {
+	url, err := pubsub.Rdb.HGet(
+		pubsub.RdbCtx, GAME_INSTANCE_HASH, gameId,
+	).Result()
+	if err != nil && err != redis.Nil {
+		log.Println("Error fetching game instance:", err)
+	}
+	if err == nil {
+		if inst, ok := get(url); ok && inst.alive() && !inst.Draining {
+			return inst.Url
+		}
+	}
+
+	url, err = pick(gameId)
+	if err != nil {
+		return os.Getenv("WSURL")
+	}
+
+	err = pubsub.Rdb.HSet(pubsub.RdbCtx, GAME_INSTANCE_HASH, gameId, url).Err()
+	if err != nil {
+		log.Println("Error placing game:", err)
+	}
+	return url
+}
+
+// ForgetGame removes the placement of a game that has ended.
+func ForgetGame(gameId string) {
+	err := pubsub.Rdb.HDel(pubsub.RdbCtx, GAME_INSTANCE_HASH, gameId).Err()
+	if err != nil {
+		log.Println("Error removing game placement:", err)
+	}
+}
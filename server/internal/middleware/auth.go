@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -11,12 +13,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 )
 
 const (
 	TOKEN_TYPE_JWT   = "1"
 	TOKEN_TYPE_OAUTH = "2"
 	TOKEN_TYPE_GUEST = "3"
+	TOKEN_TYPE_BOT   = "4"
 )
 
 func verifyToken(tokenString string) (*jwt.Token, error) {
@@ -63,6 +67,27 @@ func verifyGoogleToken(ctx context.Context, token string) (
 	return tokenInfo, nil
 }
 
+// HashApiKey is how API keys are stored, the key itself is only shown to
+// the owner of the bot once.
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func verifyApiKey(key string) (string, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT k.username FROM api_keys k
+	JOIN users u ON u.username = k.username
+	WHERE k.keyhash = $1 AND u.isbot = true`
+
+	var username string
+	if err := db.QueryRow(query, HashApiKey(key)).Scan(&username); err != nil {
+		return "", err
+	}
+	return username, nil
+}
+
 func auth(ctx *gin.Context, token string) {
 	if token == "" {
 		ctx.JSON(
@@ -136,6 +161,18 @@ func auth(ctx *gin.Context, token string) {
 		ctx.Set("username", claims["username"])
 		ctx.Next()
 
+	case TOKEN_TYPE_BOT:
+		username, err := verifyApiKey(token[1:])
+		if err != nil {
+			log.Println("API key verification failed:", err)
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			ctx.Abort()
+			return
+		}
+		ctx.Set("username", username)
+		ctx.Set("isbot", true)
+		ctx.Next()
+
 	default:
 		fmt.Printf("Unknown token type: %v\n", token[:1])
 		ctx.JSON(
@@ -162,3 +199,18 @@ func WsAuth(ctx *gin.Context) {
 	token := ctx.DefaultQuery("token", "")
 	auth(ctx, token)
 }
+
+// AdminAuth lets through only the users listed in ADMIN_USERNAMES, it has
+// to run after HttpAuth or WsAuth.
+func AdminAuth(ctx *gin.Context) {
+	username, _ := ctx.Get("username")
+	for _, admin := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		if admin != "" && strings.TrimSpace(admin) == username {
+			ctx.Next()
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+	ctx.Abort()
+}
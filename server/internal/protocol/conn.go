@@ -0,0 +1,133 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Clients pick the encoding with the Sec-WebSocket-Protocol header. A client
+// that asks for neither gets JSON.
+const (
+	SUBPROTOCOL_JSON  = "rapidgo.json"
+	SUBPROTOCOL_PROTO = "rapidgo.proto"
+)
+
+var Subprotocols = []string{SUBPROTOCOL_JSON, SUBPROTOCOL_PROTO}
+
+// protoAppender is a message, passed by value or by pointer.
+type protoAppender interface {
+	AppendProto(b []byte) []byte
+}
+
+// Conn is a game connection. The server deals in JSON messages everywhere,
+// also over pubsub, so on a binary connection the messages are converted to
+// and from protobuf here, as they are written and read. Writes are
+// serialised, the game, its pubsub and its clock all write to the player.
+type Conn struct {
+	*websocket.Conn
+	Binary bool
+
+	writeMu sync.Mutex
+}
+
+func NewConn(c *websocket.Conn) *Conn {
+	return &Conn{Conn: c, Binary: c.Subprotocol() == SUBPROTOCOL_PROTO}
+}
+
+// ToProto converts a JSON message sent by the server to protobuf.
+func ToProto(msgBytes []byte) ([]byte, error) {
+	var msgType MsgType
+	if err := json.Unmarshal(msgBytes, &msgType); err != nil {
+		return nil, err
+	}
+
+	newMsg, ok := serverMessages[msgType.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %q", msgType.Type)
+	}
+
+	msg := newMsg()
+	if err := json.Unmarshal(msgBytes, msg); err != nil {
+		return nil, err
+	}
+	return msg.AppendProto(nil), nil
+}
+
+// FromProto converts a protobuf message sent by a client to JSON, for
+// Decode to read.
+func FromProto(msgBytes []byte) ([]byte, error) {
+	msgType, err := typeOf(msgBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	newMsg, ok := clientMessages[msgType]
+	if !ok {
+		return nil, &Error{
+			Code:    ERR_UNKNOWN_TYPE,
+			Message: fmt.Sprintf("unknown message type %q", msgType),
+		}
+	}
+
+	msg := newMsg()
+	if err := msg.UnmarshalProto(msgBytes); err != nil {
+		return nil, &Error{Code: ERR_INVALID_MESSAGE, Message: err.Error()}
+	}
+	return json.Marshal(msg)
+}
+
+func (c *Conn) WriteJSON(v any) error {
+	if !c.Binary {
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+		return c.Conn.WriteJSON(v)
+	}
+
+	if msg, ok := v.(protoAppender); ok {
+		return c.write(websocket.BinaryMessage, msg.AppendProto(nil))
+	}
+
+	msgBytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, msgBytes)
+}
+
+// WriteMessage converts JSON text messages on binary connections.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if !c.Binary || messageType != websocket.TextMessage {
+		return c.write(messageType, data)
+	}
+
+	protoBytes, err := ToProto(data)
+	if err != nil {
+		return err
+	}
+	return c.write(websocket.BinaryMessage, protoBytes)
+}
+
+func (c *Conn) write(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// ReadMessage returns the messages of binary connections as JSON. A binary
+// message that cannot be converted is returned as it is, and refused by
+// Decode.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := c.Conn.ReadMessage()
+	if err != nil || !c.Binary || messageType != websocket.BinaryMessage {
+		return messageType, data, err
+	}
+
+	jsonBytes, err := FromProto(data)
+	if err != nil {
+		return messageType, data, nil
+	}
+	return websocket.TextMessage, jsonBytes, nil
+}
@@ -0,0 +1,139 @@
+package protocol
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestConn connects a client asking for the given subprotocols to a
+// server Conn, which is returned along with the client's end.
+func newTestConn(
+	t *testing.T, subprotocols []string,
+) (*Conn, *websocket.Conn) {
+	upgrader := websocket.Upgrader{Subprotocols: Subprotocols}
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			c, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conns <- c
+		},
+	))
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{Subprotocols: subprotocols}
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	client, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	wsc := <-conns
+	t.Cleanup(func() { wsc.Close() })
+	return NewConn(wsc), client
+}
+
+func TestConnNegotiation(t *testing.T) {
+	tests := []struct {
+		name         string
+		subprotocols []string
+		binary       bool
+	}{
+		{name: "none", binary: false},
+		{name: "json", subprotocols: []string{SUBPROTOCOL_JSON}, binary: false},
+		{name: "proto", subprotocols: []string{SUBPROTOCOL_PROTO}, binary: true},
+		{name: "unknown", subprotocols: []string{"other"}, binary: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestConn(t, tt.subprotocols)
+			if c.Binary != tt.binary {
+				t.Errorf("Binary = %v, want %v", c.Binary, tt.binary)
+			}
+		})
+	}
+}
+
+func TestConnWritesProto(t *testing.T) {
+	c, client := newTestConn(t, []string{SUBPROTOCOL_PROTO})
+	want := MoveMsg{Type: "move", Move: "q16", State: "b", SelfTime: 1000}
+
+	// pubsub messages arrive as JSON text
+	msgBytes, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteMessage(websocket.TextMessage, msgBytes); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteJSON(want); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		messageType, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messageType != websocket.BinaryMessage {
+			t.Fatalf("message %d sent as type %d, want binary", i, messageType)
+		}
+		var got MoveMsg
+		if err := got.UnmarshalProto(data); err != nil {
+			t.Fatal(err)
+		}
+		// the board state is JSON only, binary clients follow the moves
+		assertSame(t, &got, &MoveMsg{Type: "move", Move: "q16", SelfTime: 1000})
+	}
+}
+
+func TestConnReadsProto(t *testing.T) {
+	c, client := newTestConn(t, []string{SUBPROTOCOL_PROTO})
+	want := MoveMsg{Type: "move", Move: "d4"}
+	err := client.WriteMessage(websocket.BinaryMessage, want.AppendProto(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messageType, data, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != websocket.TextMessage {
+		t.Fatalf("message read as type %d, want text", messageType)
+	}
+	var got MoveMsg
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	assertSame(t, &got, &want)
+}
+
+func TestConnWritesJSON(t *testing.T) {
+	c, client := newTestConn(t, nil)
+	if err := c.WriteJSON(MoveMsg{Type: "move", Move: "d4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messageType, data, err := client.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != websocket.TextMessage {
+		t.Fatalf("message sent as type %d, want text", messageType)
+	}
+	var got MoveMsg
+	if err := json.Unmarshal(data, &got); err != nil || got.Move != "d4" {
+		t.Errorf("client read %s, %v", data, err)
+	}
+}
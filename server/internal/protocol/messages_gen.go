@@ -0,0 +1,1111 @@
+// Code generated by protogen from protocol.json. DO NOT EDIT.
+
+package protocol
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// VERSION is the newest version of the protocol.
+const VERSION = 2
+
+// ConditionalNode is one step of a conditional move tree. Reply is played as
+// soon as the opponent plays the move this node is keyed by, and Next holds
+// the replies to the opponent's following moves.
+type ConditionalNode struct {
+	Reply string                      `json:"reply"`
+	Next  map[string]*ConditionalNode `json:"next"`
+}
+
+func (m *ConditionalNode) Validate() error {
+	if utf8.RuneCountInString(m.Reply) > 4 {
+		return fmt.Errorf("reply is longer than 4 characters")
+	}
+	for _, v := range m.Next {
+		if v == nil {
+			continue
+		}
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m ConditionalNode) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Reply)
+	for k, v := range m.Next {
+		entry := appendString(nil, 1, k)
+		if v != nil {
+			entry = appendMessage(entry, 2, v.AppendProto(nil))
+		}
+		b = appendMessage(b, 2, entry)
+	}
+	return b
+}
+
+func (m *ConditionalNode) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Reply)
+		case 2:
+			return consumeEntry(b, typ, func(key string, value []byte) error {
+				v := new(ConditionalNode)
+				if err := v.UnmarshalProto(value); err != nil {
+					return err
+				}
+				if m.Next == nil {
+					m.Next = map[string]*ConditionalNode{}
+				}
+				m.Next[key] = v
+				return nil
+			})
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// HelloMsg is the first message of a connection that asked for a protocol
+// version, it carries the version the server speaks on it.
+type HelloMsg struct {
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+}
+
+func (m *HelloMsg) Validate() error {
+	return nil
+}
+
+func (m HelloMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendSint(b, 2, m.Version)
+	return b
+}
+
+func (m *HelloMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeSint(b, typ, &m.Version)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// ErrorMsg reports a failed request or a message the server refused.
+type ErrorMsg struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (m *ErrorMsg) Validate() error {
+	return nil
+}
+
+func (m ErrorMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Code)
+	b = appendString(b, 3, m.Message)
+	return b
+}
+
+func (m *ErrorMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Code)
+		case 3:
+			return consumeString(b, typ, &m.Message)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type StartMsg struct {
+	Type     string `json:"type"`
+	Start    int    `json:"start"`
+	Color    int    `json:"color"`
+	GameId   string `json:"gameId"`
+	OpName   string `json:"opname"`
+	OpRating int    `json:"opRating"`
+	OpRank   string `json:"opRank"`
+}
+
+func (m *StartMsg) Validate() error {
+	return nil
+}
+
+func (m StartMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendSint(b, 2, m.Start)
+	b = appendSint(b, 3, m.Color)
+	b = appendString(b, 4, m.GameId)
+	b = appendString(b, 5, m.OpName)
+	b = appendSint(b, 6, m.OpRating)
+	b = appendString(b, 7, m.OpRank)
+	return b
+}
+
+func (m *StartMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeSint(b, typ, &m.Start)
+		case 3:
+			return consumeSint(b, typ, &m.Color)
+		case 4:
+			return consumeString(b, typ, &m.GameId)
+		case 5:
+			return consumeString(b, typ, &m.OpName)
+		case 6:
+			return consumeSint(b, typ, &m.OpRating)
+		case 7:
+			return consumeString(b, typ, &m.OpRank)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// MoveMsg is a move played on the board. Binary connections get the stones
+// it captured instead of the whole board state.
+type MoveMsg struct {
+	Type     string   `json:"type"`
+	Move     string   `json:"move"`
+	State    string   `json:"state"`
+	SelfTime int64    `json:"selfTime"`
+	OpTime   int64    `json:"opTime"`
+	Captures []string `json:"captures,omitempty"`
+}
+
+func (m *MoveMsg) Validate() error {
+	if utf8.RuneCountInString(m.Move) > 4 {
+		return fmt.Errorf("move is longer than 4 characters")
+	}
+	if !ValidMove(m.Move) {
+		return fmt.Errorf("move is not a point or a pass")
+	}
+	return nil
+}
+
+func (m MoveMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Move)
+	b = appendInt(b, 4, m.SelfTime)
+	b = appendInt(b, 5, m.OpTime)
+	b = appendStrings(b, 6, m.Captures)
+	return b
+}
+
+func (m *MoveMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Move)
+		case 4:
+			return consumeInt(b, typ, &m.SelfTime)
+		case 5:
+			return consumeInt(b, typ, &m.OpTime)
+		case 6:
+			return consumeStrings(b, typ, &m.Captures)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type AbortMsg struct {
+	Type string `json:"type"`
+}
+
+func (m *AbortMsg) Validate() error {
+	return nil
+}
+
+func (m AbortMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	return b
+}
+
+func (m *AbortMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type GameOverMsg struct {
+	Type    string `json:"type"`
+	Winner  int    `json:"winner"`
+	Message string `json:"message"`
+}
+
+func (m *GameOverMsg) Validate() error {
+	return nil
+}
+
+func (m GameOverMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendSint(b, 2, m.Winner)
+	b = appendString(b, 3, m.Message)
+	return b
+}
+
+func (m *GameOverMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeSint(b, typ, &m.Winner)
+		case 3:
+			return consumeString(b, typ, &m.Message)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// MoveStatusMsg answers a move of the player. Binary connections get the
+// stones it captured instead of the whole board state.
+type MoveStatusMsg struct {
+	Type       string   `json:"type"`
+	TurnStatus bool     `json:"turnStatus"`
+	MoveStatus bool     `json:"moveStatus"`
+	State      string   `json:"state"`
+	SelfTime   int64    `json:"selfTime"`
+	OpTime     int64    `json:"opTime"`
+	Move       string   `json:"move"`
+	Captures   []string `json:"captures,omitempty"`
+}
+
+func (m *MoveStatusMsg) Validate() error {
+	return nil
+}
+
+func (m MoveStatusMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendBool(b, 2, m.TurnStatus)
+	b = appendBool(b, 3, m.MoveStatus)
+	b = appendInt(b, 5, m.SelfTime)
+	b = appendInt(b, 6, m.OpTime)
+	b = appendString(b, 7, m.Move)
+	b = appendStrings(b, 8, m.Captures)
+	return b
+}
+
+func (m *MoveStatusMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeBool(b, typ, &m.TurnStatus)
+		case 3:
+			return consumeBool(b, typ, &m.MoveStatus)
+		case 5:
+			return consumeInt(b, typ, &m.SelfTime)
+		case 6:
+			return consumeInt(b, typ, &m.OpTime)
+		case 7:
+			return consumeString(b, typ, &m.Move)
+		case 8:
+			return consumeStrings(b, typ, &m.Captures)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type ReqStateMsg struct {
+	Type string `json:"type"`
+}
+
+func (m *ReqStateMsg) Validate() error {
+	return nil
+}
+
+func (m ReqStateMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	return b
+}
+
+func (m *ReqStateMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type SyncMsg struct {
+	Type     string   `json:"type"`
+	GameId   string   `json:"gameId"`
+	PName    string   `json:"pname"`
+	OpName   string   `json:"opname"`
+	Color    int      `json:"color"`
+	Turn     bool     `json:"turn"`
+	State    string   `json:"state"`
+	History  []string `json:"history"`
+	SelfTime int64    `json:"selfTime"`
+	OpTime   int64    `json:"opTime"`
+	Rank     string   `json:"rank"`
+	OpRank   string   `json:"opRank"`
+}
+
+func (m *SyncMsg) Validate() error {
+	return nil
+}
+
+func (m SyncMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.GameId)
+	b = appendString(b, 3, m.PName)
+	b = appendString(b, 4, m.OpName)
+	b = appendSint(b, 5, m.Color)
+	b = appendBool(b, 6, m.Turn)
+	b = appendString(b, 7, m.State)
+	b = appendStrings(b, 8, m.History)
+	b = appendInt(b, 9, m.SelfTime)
+	b = appendInt(b, 10, m.OpTime)
+	b = appendString(b, 11, m.Rank)
+	b = appendString(b, 12, m.OpRank)
+	return b
+}
+
+func (m *SyncMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.GameId)
+		case 3:
+			return consumeString(b, typ, &m.PName)
+		case 4:
+			return consumeString(b, typ, &m.OpName)
+		case 5:
+			return consumeSint(b, typ, &m.Color)
+		case 6:
+			return consumeBool(b, typ, &m.Turn)
+		case 7:
+			return consumeString(b, typ, &m.State)
+		case 8:
+			return consumeStrings(b, typ, &m.History)
+		case 9:
+			return consumeInt(b, typ, &m.SelfTime)
+		case 10:
+			return consumeInt(b, typ, &m.OpTime)
+		case 11:
+			return consumeString(b, typ, &m.Rank)
+		case 12:
+			return consumeString(b, typ, &m.OpRank)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type ConditionalMsg struct {
+	Type string                      `json:"type"`
+	Tree map[string]*ConditionalNode `json:"tree"`
+}
+
+func (m *ConditionalMsg) Validate() error {
+	for _, v := range m.Tree {
+		if v == nil {
+			continue
+		}
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m ConditionalMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	for k, v := range m.Tree {
+		entry := appendString(nil, 1, k)
+		if v != nil {
+			entry = appendMessage(entry, 2, v.AppendProto(nil))
+		}
+		b = appendMessage(b, 2, entry)
+	}
+	return b
+}
+
+func (m *ConditionalMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeEntry(b, typ, func(key string, value []byte) error {
+				v := new(ConditionalNode)
+				if err := v.UnmarshalProto(value); err != nil {
+					return err
+				}
+				if m.Tree == nil {
+					m.Tree = map[string]*ConditionalNode{}
+				}
+				m.Tree[key] = v
+				return nil
+			})
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type ConditionalStatusMsg struct {
+	Type     string `json:"type"`
+	Accepted bool   `json:"accepted"`
+	Message  string `json:"message"`
+}
+
+func (m *ConditionalStatusMsg) Validate() error {
+	return nil
+}
+
+func (m ConditionalStatusMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendBool(b, 2, m.Accepted)
+	b = appendString(b, 3, m.Message)
+	return b
+}
+
+func (m *ConditionalStatusMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeBool(b, typ, &m.Accepted)
+		case 3:
+			return consumeString(b, typ, &m.Message)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// AnalysisReqMsg asks for a score estimate or a move hint.
+type AnalysisReqMsg struct {
+	Type string `json:"type"`
+}
+
+func (m *AnalysisReqMsg) Validate() error {
+	return nil
+}
+
+func (m AnalysisReqMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	return b
+}
+
+func (m *AnalysisReqMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// EstimateMsg gives the ownership of every point, indexed by row*size+col,
+// as 1 for black, -1 for white and 0 for neutral. Margin is positive when
+// black is ahead.
+type EstimateMsg struct {
+	Type      string  `json:"type"`
+	Score     string  `json:"score"`
+	Margin    float64 `json:"margin"`
+	Ownership []int   `json:"ownership"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func (m *EstimateMsg) Validate() error {
+	return nil
+}
+
+func (m EstimateMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Score)
+	b = appendDouble(b, 3, m.Margin)
+	b = appendSints(b, 4, m.Ownership)
+	b = appendString(b, 5, m.Error)
+	return b
+}
+
+func (m *EstimateMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Score)
+		case 3:
+			return consumeDouble(b, typ, &m.Margin)
+		case 4:
+			return consumeSints(b, typ, &m.Ownership)
+		case 5:
+			return consumeString(b, typ, &m.Error)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type HintMsg struct {
+	Type  string `json:"type"`
+	Move  string `json:"move"`
+	Error string `json:"error,omitempty"`
+}
+
+func (m *HintMsg) Validate() error {
+	return nil
+}
+
+func (m HintMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Move)
+	b = appendString(b, 3, m.Error)
+	return b
+}
+
+func (m *HintMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Move)
+		case 3:
+			return consumeString(b, typ, &m.Error)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type MaintenanceMsg struct {
+	Type     string    `json:"type"`
+	Message  string    `json:"message"`
+	Deadline time.Time `json:"deadline"`
+}
+
+func (m *MaintenanceMsg) Validate() error {
+	return nil
+}
+
+func (m MaintenanceMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Message)
+	b = appendTime(b, 3, m.Deadline)
+	return b
+}
+
+func (m *MaintenanceMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Message)
+		case 3:
+			return consumeTime(b, typ, &m.Deadline)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// HandoffMsg tells the client that its game has moved to another websocket
+// server, where it reconnects.
+type HandoffMsg struct {
+	Type   string `json:"type"`
+	GameId string `json:"gameId"`
+	Wsurl  string `json:"wsurl"`
+}
+
+func (m *HandoffMsg) Validate() error {
+	return nil
+}
+
+func (m HandoffMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.GameId)
+	b = appendString(b, 3, m.Wsurl)
+	return b
+}
+
+func (m *HandoffMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.GameId)
+		case 3:
+			return consumeString(b, typ, &m.Wsurl)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// PauseMsg offers, accepts or declines a pause or an adjournment. A paused
+// game is resumed in the same way, with the resume, resumeaccept and
+// resumedecline actions, and the server sends resumed once the clocks run
+// again.
+type PauseMsg struct {
+	Type     string `json:"type"`
+	Action   string `json:"action"`
+	SelfTime int64  `json:"selfTime"`
+	OpTime   int64  `json:"opTime"`
+}
+
+func (m *PauseMsg) Validate() error {
+	if utf8.RuneCountInString(m.Action) > 16 {
+		return fmt.Errorf("action is longer than 16 characters")
+	}
+	return nil
+}
+
+func (m PauseMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Action)
+	b = appendInt(b, 3, m.SelfTime)
+	b = appendInt(b, 4, m.OpTime)
+	return b
+}
+
+func (m *PauseMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Action)
+		case 3:
+			return consumeInt(b, typ, &m.SelfTime)
+		case 4:
+			return consumeInt(b, typ, &m.OpTime)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type AdjournedMsg struct {
+	Type   string `json:"type"`
+	GameId string `json:"gameId"`
+}
+
+func (m *AdjournedMsg) Validate() error {
+	return nil
+}
+
+func (m AdjournedMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.GameId)
+	return b
+}
+
+func (m *AdjournedMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.GameId)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type RematchMsg struct {
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	GameId string `json:"gameId"`
+}
+
+func (m *RematchMsg) Validate() error {
+	if utf8.RuneCountInString(m.Action) > 16 {
+		return fmt.Errorf("action is longer than 16 characters")
+	}
+	if utf8.RuneCountInString(m.GameId) > 64 {
+		return fmt.Errorf("gameId is longer than 64 characters")
+	}
+	return nil
+}
+
+func (m RematchMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Action)
+	b = appendString(b, 3, m.GameId)
+	return b
+}
+
+func (m *RematchMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Action)
+		case 3:
+			return consumeString(b, typ, &m.GameId)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+type ChatMsg struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func (m *ChatMsg) Validate() error {
+	if m.Message == "" {
+		return fmt.Errorf("message is empty")
+	}
+	if utf8.RuneCountInString(m.Message) > 500 {
+		return fmt.Errorf("message is longer than 500 characters")
+	}
+	return nil
+}
+
+func (m ChatMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Message)
+	return b
+}
+
+func (m *ChatMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Message)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// SpectatorsMsg is sent to the players and spectators of a game when someone
+// starts or stops watching it. Viewers leaves out the spectators who watch
+// anonymously.
+type SpectatorsMsg struct {
+	Type    string   `json:"type"`
+	Count   int      `json:"count"`
+	Viewers []string `json:"viewers"`
+}
+
+func (m *SpectatorsMsg) Validate() error {
+	return nil
+}
+
+func (m SpectatorsMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendSint(b, 2, m.Count)
+	b = appendStrings(b, 3, m.Viewers)
+	return b
+}
+
+func (m *SpectatorsMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeSint(b, typ, &m.Count)
+		case 3:
+			return consumeStrings(b, typ, &m.Viewers)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// SpectatorChatMsg is a chat message between spectators, the players do not
+// get it. Spectators of games with public chat also get the players' chat as
+// playerchat.
+type SpectatorChatMsg struct {
+	Type     string `json:"type"`
+	Username string `json:"username"`
+	Message  string `json:"message"`
+}
+
+func (m *SpectatorChatMsg) Validate() error {
+	return nil
+}
+
+func (m SpectatorChatMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Username)
+	b = appendString(b, 3, m.Message)
+	return b
+}
+
+func (m *SpectatorChatMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Username)
+		case 3:
+			return consumeString(b, typ, &m.Message)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// SpectatorSyncMsg is the state of a game as spectators see it, behind by
+// the broadcast delay of the game. Side is the color the spectator chose to
+// watch from.
+type SpectatorSyncMsg struct {
+	Type         string   `json:"type"`
+	GameId       string   `json:"gameId"`
+	Black        string   `json:"black"`
+	White        string   `json:"white"`
+	Side         int      `json:"side"`
+	Turn         int      `json:"turn"`
+	State        string   `json:"state"`
+	History      []string `json:"history"`
+	BlackTime    int64    `json:"blackTime"`
+	WhiteTime    int64    `json:"whiteTime"`
+	Paused       bool     `json:"paused"`
+	DelayMoves   int      `json:"delayMoves,omitempty"`
+	DelaySeconds int      `json:"delaySeconds,omitempty"`
+}
+
+func (m *SpectatorSyncMsg) Validate() error {
+	return nil
+}
+
+func (m SpectatorSyncMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.GameId)
+	b = appendString(b, 3, m.Black)
+	b = appendString(b, 4, m.White)
+	b = appendSint(b, 5, m.Side)
+	b = appendSint(b, 6, m.Turn)
+	b = appendString(b, 7, m.State)
+	b = appendStrings(b, 8, m.History)
+	b = appendInt(b, 9, m.BlackTime)
+	b = appendInt(b, 10, m.WhiteTime)
+	b = appendBool(b, 11, m.Paused)
+	b = appendSint(b, 12, m.DelayMoves)
+	b = appendSint(b, 13, m.DelaySeconds)
+	return b
+}
+
+func (m *SpectatorSyncMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.GameId)
+		case 3:
+			return consumeString(b, typ, &m.Black)
+		case 4:
+			return consumeString(b, typ, &m.White)
+		case 5:
+			return consumeSint(b, typ, &m.Side)
+		case 6:
+			return consumeSint(b, typ, &m.Turn)
+		case 7:
+			return consumeString(b, typ, &m.State)
+		case 8:
+			return consumeStrings(b, typ, &m.History)
+		case 9:
+			return consumeInt(b, typ, &m.BlackTime)
+		case 10:
+			return consumeInt(b, typ, &m.WhiteTime)
+		case 11:
+			return consumeBool(b, typ, &m.Paused)
+		case 12:
+			return consumeSint(b, typ, &m.DelayMoves)
+		case 13:
+			return consumeSint(b, typ, &m.DelaySeconds)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// SpectatorMoveMsg is a move or a pass, with the clocks of both players
+// after it.
+type SpectatorMoveMsg struct {
+	Type      string   `json:"type"`
+	Move      string   `json:"move"`
+	Color     int      `json:"color"`
+	Pass      bool     `json:"pass"`
+	State     string   `json:"state"`
+	Captures  []string `json:"captures,omitempty"`
+	BlackTime int64    `json:"blackTime"`
+	WhiteTime int64    `json:"whiteTime"`
+}
+
+func (m *SpectatorMoveMsg) Validate() error {
+	return nil
+}
+
+func (m SpectatorMoveMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Move)
+	b = appendSint(b, 3, m.Color)
+	b = appendBool(b, 4, m.Pass)
+	b = appendStrings(b, 6, m.Captures)
+	b = appendInt(b, 7, m.BlackTime)
+	b = appendInt(b, 8, m.WhiteTime)
+	return b
+}
+
+func (m *SpectatorMoveMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Move)
+		case 3:
+			return consumeSint(b, typ, &m.Color)
+		case 4:
+			return consumeBool(b, typ, &m.Pass)
+		case 6:
+			return consumeStrings(b, typ, &m.Captures)
+		case 7:
+			return consumeInt(b, typ, &m.BlackTime)
+		case 8:
+			return consumeInt(b, typ, &m.WhiteTime)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// SpectatorPauseMsg tells spectators that a game was paused or adjourned,
+// Kind being pause or adjourn, and that it went on again.
+type SpectatorPauseMsg struct {
+	Type   string `json:"type"`
+	Kind   string `json:"kind"`
+	Action string `json:"action"`
+}
+
+func (m *SpectatorPauseMsg) Validate() error {
+	return nil
+}
+
+func (m SpectatorPauseMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Kind)
+	b = appendString(b, 3, m.Action)
+	return b
+}
+
+func (m *SpectatorPauseMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeString(b, typ, &m.Kind)
+		case 3:
+			return consumeString(b, typ, &m.Action)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// SpectatorEndMsg is the end of a game. A game ended by two passes comes
+// with the score of both players, komi included.
+type SpectatorEndMsg struct {
+	Type       string  `json:"type"`
+	Winner     int     `json:"winner"`
+	Message    string  `json:"message"`
+	BlackScore float64 `json:"blackScore,omitempty"`
+	WhiteScore float64 `json:"whiteScore,omitempty"`
+}
+
+func (m *SpectatorEndMsg) Validate() error {
+	return nil
+}
+
+func (m SpectatorEndMsg) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Type)
+	b = appendSint(b, 2, m.Winner)
+	b = appendString(b, 3, m.Message)
+	b = appendDouble(b, 4, m.BlackScore)
+	b = appendDouble(b, 5, m.WhiteScore)
+	return b
+}
+
+func (m *SpectatorEndMsg) UnmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &m.Type)
+		case 2:
+			return consumeSint(b, typ, &m.Winner)
+		case 3:
+			return consumeString(b, typ, &m.Message)
+		case 4:
+			return consumeDouble(b, typ, &m.BlackScore)
+		case 5:
+			return consumeDouble(b, typ, &m.WhiteScore)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// clientMessages are the messages a client can send, by type.
+var clientMessages = map[string]func() Message{
+	"move":        func() Message { return new(MoveMsg) },
+	"abort":       func() Message { return new(AbortMsg) },
+	"reqState":    func() Message { return new(ReqStateMsg) },
+	"conditional": func() Message { return new(ConditionalMsg) },
+	"estimate":    func() Message { return new(AnalysisReqMsg) },
+	"hint":        func() Message { return new(AnalysisReqMsg) },
+	"pause":       func() Message { return new(PauseMsg) },
+	"adjourn":     func() Message { return new(PauseMsg) },
+	"rematch":     func() Message { return new(RematchMsg) },
+	"chat":        func() Message { return new(ChatMsg) },
+}
+
+// serverMessages are the messages the server sends, by type.
+var serverMessages = map[string]func() Message{
+	"hello":             func() Message { return new(HelloMsg) },
+	"error":             func() Message { return new(ErrorMsg) },
+	"start":             func() Message { return new(StartMsg) },
+	"move":              func() Message { return new(MoveMsg) },
+	"gameover":          func() Message { return new(GameOverMsg) },
+	"movestatus":        func() Message { return new(MoveStatusMsg) },
+	"sync":              func() Message { return new(SyncMsg) },
+	"conditionalstatus": func() Message { return new(ConditionalStatusMsg) },
+	"estimate":          func() Message { return new(EstimateMsg) },
+	"hint":              func() Message { return new(HintMsg) },
+	"maintenance":       func() Message { return new(MaintenanceMsg) },
+	"handoff":           func() Message { return new(HandoffMsg) },
+	"pause":             func() Message { return new(PauseMsg) },
+	"adjourn":           func() Message { return new(PauseMsg) },
+	"adjourned":         func() Message { return new(AdjournedMsg) },
+	"rematch":           func() Message { return new(RematchMsg) },
+	"chat":              func() Message { return new(ChatMsg) },
+	"spectators":        func() Message { return new(SpectatorsMsg) },
+	"spectatorchat":     func() Message { return new(SpectatorChatMsg) },
+	"playerchat":        func() Message { return new(SpectatorChatMsg) },
+	"spectatorsync":     func() Message { return new(SpectatorSyncMsg) },
+	"spectatormove":     func() Message { return new(SpectatorMoveMsg) },
+	"spectatorpause":    func() Message { return new(SpectatorPauseMsg) },
+	"spectatorend":      func() Message { return new(SpectatorEndMsg) },
+}
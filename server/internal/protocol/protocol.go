@@ -0,0 +1,155 @@
+// Package protocol defines the messages of the game websocket. The messages
+// are described in protocol.json, from which the Go types in this package,
+// their protobuf encoding and the TypeScript types of the frontend are
+// generated.
+package protocol
+
+//go:generate go run ../../cmd/protogen -in protocol.json -go messages_gen.go -ts ../../../frontend/src/types/protocol.ts -proto protocol.proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// clients that do not ask for a version speak version 1, the protocol
+	// from before it was versioned, and get no hello message
+	MIN_VERSION = 1
+
+	MAX_MESSAGE_SIZE = 64 * 1024
+
+	ERR_UNSUPPORTED_VERSION = "unsupported_version"
+	ERR_TOO_LARGE           = "too_large"
+	ERR_UNKNOWN_TYPE        = "unknown_type"
+	ERR_INVALID_MESSAGE     = "invalid_message"
+	ERR_RECONNECT_FAILED    = "reconnect_failed"
+	ERR_RESUME_FAILED       = "resume_failed"
+	ERR_START_FAILED        = "start_failed"
+)
+
+// Message is a decoded message, Validate checks the limits of its fields.
+type Message interface {
+	Validate() error
+	AppendProto(b []byte) []byte
+	UnmarshalProto(b []byte) error
+}
+
+// MsgType is the part every message has in common.
+type MsgType struct {
+	Type string `json:"type"`
+}
+
+// Error is a refused request or message, it is sent to the client as an
+// ErrorMsg.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Frame() ErrorMsg {
+	return ErrorMsg{Type: "error", Code: e.Code, Message: e.Message}
+}
+
+// Negotiate picks the version of a connection from the one the client asked
+// for, an empty string being version 1.
+func Negotiate(requested string) (int, error) {
+	if requested == "" {
+		return MIN_VERSION, nil
+	}
+
+	version, err := strconv.Atoi(requested)
+	if err != nil || version < MIN_VERSION || version > VERSION {
+		return 0, &Error{
+			Code: ERR_UNSUPPORTED_VERSION,
+			Message: fmt.Sprintf(
+				"version %v is not supported, use %v to %v",
+				requested, MIN_VERSION, VERSION,
+			),
+		}
+	}
+	return version, nil
+}
+
+// ValidMove reports whether move is a pass, ps, or a point of a 19x19 board
+// as the game writes it: the column from a to s and the row from 0 to 18.
+// Whether the point is on the board of the game is checked when it is played.
+func ValidMove(move string) bool {
+	if move == "ps" {
+		return true
+	}
+	if len(move) < 2 || len(move) > 3 || move[0] < 'a' || move[0] > 's' {
+		return false
+	}
+	for _, c := range move[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	if len(move) == 3 && move[1] == '0' {
+		return false
+	}
+	row, _ := strconv.Atoi(move[1:])
+	return row < 19
+}
+
+// Decode reads a message sent by a client. Messages of unknown types, with
+// unknown fields or over MAX_MESSAGE_SIZE are refused with an *Error.
+func Decode(msgBytes []byte) (string, Message, error) {
+	if len(msgBytes) > MAX_MESSAGE_SIZE {
+		return "", nil, &Error{
+			Code:    ERR_TOO_LARGE,
+			Message: fmt.Sprintf("message is over %v bytes", MAX_MESSAGE_SIZE),
+		}
+	}
+
+	var msgType MsgType
+	if err := json.Unmarshal(msgBytes, &msgType); err != nil {
+		return "", nil, &Error{Code: ERR_INVALID_MESSAGE, Message: err.Error()}
+	}
+
+	newMsg, ok := clientMessages[msgType.Type]
+	if !ok {
+		return msgType.Type, nil, &Error{
+			Code:    ERR_UNKNOWN_TYPE,
+			Message: fmt.Sprintf("unknown message type %q", msgType.Type),
+		}
+	}
+
+	msg := newMsg()
+	dec := json.NewDecoder(bytes.NewReader(msgBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(msg); err != nil {
+		return msgType.Type, nil, &Error{
+			Code: ERR_INVALID_MESSAGE, Message: err.Error(),
+		}
+	}
+	if dec.More() {
+		return msgType.Type, nil, &Error{
+			Code: ERR_INVALID_MESSAGE, Message: "data after the message",
+		}
+	}
+	if err := msg.Validate(); err != nil {
+		return msgType.Type, nil, &Error{
+			Code: ERR_INVALID_MESSAGE, Message: err.Error(),
+		}
+	}
+
+	return msgType.Type, msg, nil
+}
+
+// WriteError sends an error message on the connection.
+func WriteError(c *Conn, code string, message string) error {
+	e := Error{Code: code, Message: message}
+	return c.WriteJSON(e.Frame())
+}
+
+// Hello is the first message of a connection that asked for a version.
+func Hello(version int) HelloMsg {
+	return HelloMsg{Type: "hello", Version: version}
+}
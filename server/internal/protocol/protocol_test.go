@@ -0,0 +1,392 @@
+package protocol
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type specField struct {
+	Name     string `json:"name"`
+	JsonOnly bool   `json:"jsonOnly"`
+}
+
+type specMessage struct {
+	Name   string      `json:"name"`
+	Types  []string    `json:"types"`
+	From   string      `json:"from"`
+	Fields []specField `json:"fields"`
+}
+
+type spec struct {
+	Messages []specMessage `json:"messages"`
+}
+
+func loadSpec(t testing.TB) spec {
+	data, err := os.ReadFile("protocol.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// sampleTree has nested map entries, and nodes with and without replies.
+func sampleTree() map[string]*ConditionalNode {
+	return map[string]*ConditionalNode{
+		"D4": {
+			Reply: "Q16",
+			Next: map[string]*ConditionalNode{
+				"C3":  {Reply: "R4"},
+				"K10": {Reply: "pass"},
+			},
+		},
+		"E5": {Reply: "F6"},
+		"ps": {Next: map[string]*ConditionalNode{"A1": {Reply: "B2"}}},
+	}
+}
+
+// fill sets every field of the message to a value that is not the zero
+// value, negative for numbers, so that no field is left out on the wire.
+func fill(t *testing.T, msg Message, msgType string) {
+	v := reflect.ValueOf(msg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		name := v.Type().Field(i).Name
+		if name == "Type" {
+			f.SetString(msgType)
+			continue
+		}
+
+		switch f.Interface().(type) {
+		case string:
+			f.SetString(name + "-é")
+		case int:
+			f.SetInt(-int64(i + 1))
+		case int64:
+			f.SetInt(-int64(i+1) * 1_000_000_007)
+		case bool:
+			f.SetBool(true)
+		case float64:
+			f.SetFloat(-float64(i) - 0.25)
+		case []string:
+			f.Set(reflect.ValueOf([]string{"D4", "", name}))
+		case []int:
+			f.Set(reflect.ValueOf([]int{0, -1, 1, -64, 64, 1 << 20, -(1 << 20)}))
+		case time.Time:
+			f.Set(reflect.ValueOf(time.UnixMilli(1_700_000_000_123)))
+		case map[string]*ConditionalNode:
+			f.Set(reflect.ValueOf(sampleTree()))
+		default:
+			t.Fatalf("%T.%s: no sample value for %s", msg, name, f.Type())
+		}
+	}
+}
+
+// withoutJsonOnly is the message as it is after a trip through protobuf,
+// which leaves out the fields only JSON clients get.
+func withoutJsonOnly(msg Message, m specMessage) Message {
+	v := reflect.New(reflect.TypeOf(msg).Elem())
+	v.Elem().Set(reflect.ValueOf(msg).Elem())
+	for _, f := range m.Fields {
+		if f.JsonOnly {
+			field := v.Elem().FieldByName(f.Name)
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+	return v.Interface().(Message)
+}
+
+func assertSame(t *testing.T, got any, want any) {
+	t.Helper()
+	gotJson, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJson, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotJson) != string(wantJson) {
+		t.Errorf("got %s\nwant %s", gotJson, wantJson)
+	}
+}
+
+type sample struct {
+	name    string
+	msgType string
+	spec    specMessage
+	newMsg  func() Message
+}
+
+// samples lists every message of protocol.json, once for each type it is
+// sent as and each side that sends it.
+func samples(t *testing.T) []sample {
+	var result []sample
+	for _, m := range loadSpec(t).Messages {
+		for _, msgType := range m.Types {
+			var sides []map[string]func() Message
+			switch m.From {
+			case "server":
+				sides = append(sides, serverMessages)
+			case "client":
+				sides = append(sides, clientMessages)
+			case "both":
+				sides = append(sides, serverMessages, clientMessages)
+			}
+
+			for _, side := range sides {
+				newMsg, ok := side[msgType]
+				if !ok {
+					t.Fatalf("%s: type %q is not registered", m.Name, msgType)
+				}
+				if got := reflect.TypeOf(newMsg()).Elem().Name(); got != m.Name {
+					t.Fatalf("type %q makes a %s, want %s", msgType, got, m.Name)
+				}
+				result = append(result, sample{
+					name: m.Name + "/" + msgType, msgType: msgType, spec: m,
+					newMsg: newMsg,
+				})
+			}
+		}
+	}
+	return result
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	for _, s := range samples(t) {
+		t.Run(s.name, func(t *testing.T) {
+			msg := s.newMsg()
+			fill(t, msg, s.msgType)
+
+			got := s.newMsg()
+			if err := got.UnmarshalProto(msg.AppendProto(nil)); err != nil {
+				t.Fatal(err)
+			}
+			assertSame(t, got, withoutJsonOnly(msg, s.spec))
+		})
+	}
+}
+
+func TestToProto(t *testing.T) {
+	for _, s := range samples(t) {
+		if _, ok := serverMessages[s.msgType]; !ok || s.spec.From == "client" {
+			continue
+		}
+		t.Run(s.name, func(t *testing.T) {
+			msg := s.newMsg()
+			fill(t, msg, s.msgType)
+			msgBytes, err := json.Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			protoBytes, err := ToProto(msgBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.newMsg()
+			if err := got.UnmarshalProto(protoBytes); err != nil {
+				t.Fatal(err)
+			}
+			assertSame(t, got, withoutJsonOnly(msg, s.spec))
+		})
+	}
+}
+
+func TestFromProto(t *testing.T) {
+	for _, s := range samples(t) {
+		if _, ok := clientMessages[s.msgType]; !ok || s.spec.From == "server" {
+			continue
+		}
+		t.Run(s.name, func(t *testing.T) {
+			msg := s.newMsg()
+			fill(t, msg, s.msgType)
+
+			jsonBytes, err := FromProto(msg.AppendProto(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.newMsg()
+			if err := json.Unmarshal(jsonBytes, got); err != nil {
+				t.Fatal(err)
+			}
+			assertSame(t, got, withoutJsonOnly(msg, s.spec))
+		})
+	}
+}
+
+func TestFromProtoUnknownType(t *testing.T) {
+	msg := GameOverMsg{Type: "gameover", Winner: 1}
+	if _, err := FromProto(msg.AppendProto(nil)); err == nil {
+		t.Error("a server message was read as a client message")
+	}
+}
+
+func TestDecodeMove(t *testing.T) {
+	tests := []struct {
+		move string
+		ok   bool
+	}{
+		{"ps", true},
+		{"a0", true},
+		{"s18", true},
+		{"j9", true},
+		{"", false},
+		{"a", false},
+		{"aX", false},
+		{"a+1", false},
+		{"a01", false},
+		{"a19", false},
+		{"t3", false},
+		{"D4", false},
+		{"pass", false},
+	}
+
+	for _, tt := range tests {
+		msgBytes, err := json.Marshal(MoveMsg{Type: "move", Move: tt.move})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = Decode(msgBytes)
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("Decode(move %q): err = %v, want ok %v", tt.move, err, tt.ok)
+		}
+	}
+}
+
+func TestSints(t *testing.T) {
+	tests := []struct {
+		name      string
+		ownership []int
+	}{
+		{"empty", nil},
+		{"zero", []int{0}},
+		{"signs", []int{-1, 0, 1}},
+		{"large", []int{1<<31 - 1, -(1 << 31), 300, -300}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := EstimateMsg{Type: "estimate", Ownership: tt.ownership}
+			var got EstimateMsg
+			if err := got.UnmarshalProto(msg.AppendProto(nil)); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Ownership, tt.ownership) {
+				t.Errorf("packed: got %v, want %v", got.Ownership, tt.ownership)
+			}
+
+			// a reader has to accept the values unpacked too
+			b := appendString(nil, 1, "estimate")
+			for _, v := range tt.ownership {
+				b = protowire.AppendTag(b, 4, protowire.VarintType)
+				b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(v)))
+			}
+			got = EstimateMsg{}
+			if err := got.UnmarshalProto(b); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Ownership, tt.ownership) {
+				t.Errorf("unpacked: got %v, want %v", got.Ownership, tt.ownership)
+			}
+		})
+	}
+}
+
+func TestConditionalMapEntries(t *testing.T) {
+	msg := ConditionalMsg{Type: "conditional", Tree: sampleTree()}
+	var got ConditionalMsg
+	if err := got.UnmarshalProto(msg.AppendProto(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("got %+v, want %+v", got, msg)
+	}
+
+	// an entry without a value is an empty node
+	entry := appendString(nil, 1, "D4")
+	b := appendString(nil, 1, "conditional")
+	b = appendMessage(b, 2, entry)
+	got = ConditionalMsg{}
+	if err := got.UnmarshalProto(b); err != nil {
+		t.Fatal(err)
+	}
+	if node, ok := got.Tree["D4"]; !ok || node == nil || node.Reply != "" {
+		t.Errorf("entry without a value: got %+v", got.Tree)
+	}
+}
+
+func benchmarkSync() SyncMsg {
+	history := make([]string, 200)
+	for i := range history {
+		history[i] = "D4"
+	}
+	return SyncMsg{
+		Type: "sync", GameId: "game", OpName: "opponent", Turn: true,
+		State: string(make([]byte, 361)), History: history,
+		SelfTime: 600000, OpTime: 540000, Rank: "3d", OpRank: "2d",
+	}
+}
+
+func BenchmarkMoveJSON(b *testing.B) {
+	msg := MoveMsg{
+		Type: "move", Move: "Q16", State: string(make([]byte, 361)),
+		SelfTime: 600000, OpTime: 540000,
+	}
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMoveProto(b *testing.B) {
+	msg := MoveMsg{
+		Type: "move", Move: "Q16", SelfTime: 600000, OpTime: 540000,
+		Captures: []string{"Q17"},
+	}
+	buf := make([]byte, 0, 64)
+	for i := 0; i < b.N; i++ {
+		buf = msg.AppendProto(buf[:0])
+	}
+}
+
+func BenchmarkSyncToProto(b *testing.B) {
+	msgBytes, err := json.Marshal(benchmarkSync())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ToProto(msgBytes); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeMove(b *testing.B) {
+	msgBytes := []byte(`{"type":"move","move":"q16"}`)
+	for i := 0; i < b.N; i++ {
+		if _, _, err := Decode(msgBytes); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFromProtoMove(b *testing.B) {
+	msg := MoveMsg{Type: "move", Move: "Q16"}
+	protoBytes := msg.AppendProto(nil)
+	for i := 0; i < b.N; i++ {
+		if _, err := FromProto(protoBytes); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Helpers for the generated protobuf encoding. Like proto3, fields with
+// their zero value are left out. The consume functions return the number
+// of bytes read, or a negative number when the field is malformed.
+
+var errField = errors.New("malformed field")
+
+// FIELD_ERROR is returned by the consume functions for a field of the wrong
+// wire type or with a malformed value.
+const FIELD_ERROR = -100
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendSint encodes a sint32, which keeps small negative numbers short.
+func appendSint(b []byte, num protowire.Number, v int) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeZigZag(int64(v)))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+// appendTime encodes a time as milliseconds since the epoch.
+func appendTime(b []byte, num protowire.Number, v time.Time) []byte {
+	if v.IsZero() {
+		return b
+	}
+	return appendInt(b, num, v.UnixMilli())
+}
+
+func appendStrings(b []byte, num protowire.Number, v []string) []byte {
+	for _, s := range v {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	return b
+}
+
+// appendSints encodes a packed repeated sint32.
+func appendSints(b []byte, num protowire.Number, v []int) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, n := range v {
+		packed = protowire.AppendVarint(packed, protowire.EncodeZigZag(int64(n)))
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, packed)
+}
+
+func appendMessage(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// consumeFields calls field for every field of a message.
+func consumeFields(
+	b []byte, field func(protowire.Number, protowire.Type, []byte) int,
+) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n = field(num, typ, b)
+		if n == FIELD_ERROR {
+			return errField
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func consumeString(b []byte, typ protowire.Type, v *string) int {
+	if typ != protowire.BytesType {
+		return FIELD_ERROR
+	}
+	s, n := protowire.ConsumeString(b)
+	*v = s
+	return n
+}
+
+func consumeVarint(b []byte, typ protowire.Type) (uint64, int) {
+	if typ != protowire.VarintType {
+		return 0, FIELD_ERROR
+	}
+	return protowire.ConsumeVarint(b)
+}
+
+func consumeInt(b []byte, typ protowire.Type, v *int64) int {
+	u, n := consumeVarint(b, typ)
+	*v = int64(u)
+	return n
+}
+
+func consumeSint(b []byte, typ protowire.Type, v *int) int {
+	u, n := consumeVarint(b, typ)
+	*v = int(protowire.DecodeZigZag(u))
+	return n
+}
+
+func consumeBool(b []byte, typ protowire.Type, v *bool) int {
+	u, n := consumeVarint(b, typ)
+	*v = u != 0
+	return n
+}
+
+func consumeDouble(b []byte, typ protowire.Type, v *float64) int {
+	if typ != protowire.Fixed64Type {
+		return FIELD_ERROR
+	}
+	u, n := protowire.ConsumeFixed64(b)
+	*v = math.Float64frombits(u)
+	return n
+}
+
+func consumeTime(b []byte, typ protowire.Type, v *time.Time) int {
+	var ms int64
+	n := consumeInt(b, typ, &ms)
+	*v = time.UnixMilli(ms)
+	return n
+}
+
+func consumeStrings(b []byte, typ protowire.Type, v *[]string) int {
+	var s string
+	n := consumeString(b, typ, &s)
+	if n >= 0 {
+		*v = append(*v, s)
+	}
+	return n
+}
+
+// consumeSints reads a repeated sint32, packed or not.
+func consumeSints(b []byte, typ protowire.Type, v *[]int) int {
+	if typ == protowire.VarintType {
+		var i int
+		n := consumeSint(b, typ, &i)
+		if n >= 0 {
+			*v = append(*v, i)
+		}
+		return n
+	}
+
+	if typ != protowire.BytesType {
+		return FIELD_ERROR
+	}
+	packed, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n
+	}
+	for len(packed) > 0 {
+		u, m := protowire.ConsumeVarint(packed)
+		if m < 0 {
+			return m
+		}
+		*v = append(*v, int(protowire.DecodeZigZag(u)))
+		packed = packed[m:]
+	}
+	return n
+}
+
+// consumeEntry reads an entry of a map<string, Message>, whose key is
+// field 1 and value field 2.
+func consumeEntry(
+	b []byte, typ protowire.Type, entry func(string, []byte) error,
+) int {
+	if typ != protowire.BytesType {
+		return FIELD_ERROR
+	}
+	data, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n
+	}
+
+	var key string
+	var value []byte
+	err := consumeFields(data, func(
+		num protowire.Number, typ protowire.Type, b []byte,
+	) int {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &key)
+		case 2:
+			if typ != protowire.BytesType {
+				return FIELD_ERROR
+			}
+			var m int
+			value, m = protowire.ConsumeBytes(b)
+			return m
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	if err != nil || entry(key, value) != nil {
+		return FIELD_ERROR
+	}
+	return n
+}
+
+// typeOf reads the type of a binary message, which is field 1 of all of
+// them.
+func typeOf(b []byte) (string, error) {
+	var msgType string
+	err := consumeFields(b, func(
+		num protowire.Number, typ protowire.Type, b []byte,
+	) int {
+		if num == 1 {
+			return consumeString(b, typ, &msgType)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	return msgType, err
+}
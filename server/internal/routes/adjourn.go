@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/protocol"
+)
+
+type AdjournedGame struct {
+	GameId string `json:"gameId"`
+	Black  string `json:"black"`
+	White  string `json:"white"`
+}
+
+func getAdjournedGames(username string) []AdjournedGame {
+	db := database.GetDatabase()
+	query := `
+	SELECT gameid, black, white
+	FROM games
+	WHERE adjourned = true AND (black = $1 OR white = $1)`
+
+	var games []AdjournedGame
+	rows, err := db.Query(query, username)
+	if err != nil {
+		log.Println("Error fetching adjourned games:", err)
+		return games
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var game AdjournedGame
+		if err := rows.Scan(&game.GameId, &game.Black, &game.White); err != nil {
+			log.Println("Error scanning adjourned game:", err)
+			continue
+		}
+		games = append(games, game)
+	}
+	return games
+}
+
+func loadAdjournedGame(g *core.Game, gameId string) (string, string, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT black, white, moves, btime, wtime, size, maintime, rated
+	FROM games
+	WHERE gameid = $1 AND adjourned = true`
+
+	var black, white, moves string
+	var btime, wtime int64
+	if err := db.QueryRow(query, gameId).Scan(
+		&black, &white, &moves, &btime, &wtime,
+		&g.Settings.Size, &g.Settings.MainTime, &g.Settings.Rated,
+	); err != nil {
+		return "", "", err
+	}
+
+	switch g.Player.Username {
+	case black:
+		g.Player.Color = core.BlackCell
+		g.OpName = white
+	case white:
+		g.Player.Color = core.WhiteCell
+		g.OpName = black
+	default:
+		return "", "", fmt.Errorf(
+			"%v is not a player of game %v", g.Player.Username, gameId,
+		)
+	}
+
+	g.Id = gameId
+	g.InitGame()
+	if err := g.Replay(strings.Split(moves, "/")); err != nil {
+		return "", "", err
+	}
+
+	if g.Player.Color == core.BlackCell {
+		g.Player.Clk.Spent, g.Player.OpClk.Spent = btime, wtime
+	} else {
+		g.Player.Clk.Spent, g.Player.OpClk.Spent = wtime, btime
+	}
+	return black, white, nil
+}
+
+func resumeAdjourned(username string, gameId string, c *protocol.Conn) bool {
+	if _, ok := core.GetGame(username); ok {
+		return false
+	}
+
+	g := new(core.Game)
+	g.Player = new(core.Player)
+	g.Player.Game = g
+	g.Player.Username = username
+	g.Player.Wsc = c
+
+	black, white, err := loadAdjournedGame(g, gameId)
+	if err != nil {
+		log.Println("Error loading adjourned game:", err)
+		return false
+	}
+
+	addGameWithSettings(gameId, black, white, g.Settings)
+	addPlayer(username, UserHashData{GameId: gameId, Color: g.Player.Color})
+
+	g.LoadRatings()
+	g.Player.Wsc.WriteJSON(
+		g.StartMsg(),
+	)
+	core.StartAdjourned(g)
+
+	log.Println("Player resumed adjourned game", username, gameId)
+	return true
+}
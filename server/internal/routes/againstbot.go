@@ -2,88 +2,139 @@ package routes
 
 import (
 	"log"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
 	"github.com/vanshjangir/rapid-go/server/internal/core"
 	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/protocol"
 )
 
 func addBotEntry(g *core.Game) error {
 	db := database.GetDatabase()
 	updateQuery := `UPDATE games SET white = $2 WHERE gameid = $1`
-	if _, err := db.Exec(updateQuery, g.Id, "bot"); err != nil {
+	if _, err := db.Exec(updateQuery, g.Id, g.OpName); err != nil {
 		return err
 	}
 	return nil
 }
 
+// acquireEngine takes an engine from the pool for the game, waiting in the
+// queue if all of them are in use.
+func acquireEngine(g *core.Game) (*core.GnuGo, error) {
+	return core.Engines.Acquire(
+		g.Player.Username, g.BotLevel, g.Settings.Size,
+	)
+}
+
 func startGameBot(g *core.Game) {
 	log.Println("New match has started")
 
 	g.InitGame()
-	g.Player.Rating = getRating(g.Player.Username)
+	engine, err := acquireEngine(g)
+	if err != nil {
+		log.Println("Error acquiring engine:", err)
+		protocol.WriteError(
+			g.Player.Wsc, protocol.ERR_START_FAILED, err.Error(),
+		)
+		g.Player.Wsc.Close()
+		return
+	}
+
+	g.LoadRatings()
 	g.Player.Wsc.WriteJSON(
-		core.StartMsg{Start: 1, Color: 1, GameId: g.Id},
+		g.StartMsg(),
 	)
 
-	core.Pmap[g.Player.Username] = g
-	g.Over = make(chan bool)
+	// the game is only reachable for a reconnect once it is stored
 	if err := addGameToDb(g); err != nil {
 		log.Println("Error occurred in adding Game data:", err)
+		core.Engines.Release(g.Player.Username, engine)
+		g.Player.Wsc.Close()
 		return
 	}
 
 	if err := addBotEntry(g); err != nil {
 		log.Println("Error occurred in adding Bot Entry:", err)
+		core.Engines.Release(g.Player.Username, engine)
+		g.Player.Wsc.Close()
 		return
 	}
 
-	go core.PlayGameBot(g)
+	g.Over = make(chan bool)
+	core.AddGame(g.Player.Username, g)
+	go core.PlayGameBot(g, engine)
 }
 
-func reconnectBot(username string, c *websocket.Conn) bool {
-	game, ok := core.Pmap[username]
+func reconnectBot(username string, c *protocol.Conn) bool {
+	game, ok := core.GetGame(username)
 	if !ok || game == nil {
+		// the game may have been handed off to this instance
+		return restoreGame(username, c)
+	}
+
+	game.Player.Wsc = c
+	engine, err := acquireEngine(game)
+	if err != nil {
+		log.Println("Error acquiring engine:", err)
 		return false
 	}
 
 	game.Player.DisConn = false
-	game.Player.Wsc = c
 	game.Player.Wsc.WriteJSON(
-		core.StartMsg{Start: 1, Color: core.BlackCell, GameId: game.Id},
+		game.StartMsg(),
 	)
-	go core.PlayGameBot(game)
+	go core.PlayGameBot(game, engine)
 
 	log.Println("Player reconnected", username)
 	return true
 }
 
-func setupGameBot(g *core.Game) {
+// EngineMetrics reports how the engine pool is used.
+func EngineMetrics(ctx *gin.Context) {
+	ctx.JSON(200, core.Engines.Metrics())
+}
+
+func setupGameBot(g *core.Game, level int, rated bool) {
 	g.Id = core.GetUniqueId()
 	g.Player.Color = core.BlackCell
+	g.AgainstBot = true
+	g.BotLevel = level
+	g.OpName = core.BotName(level)
+	g.Settings = core.DefaultSettings()
+	g.Settings.Rated = rated
 	startGameBot(g)
 }
 
 func ConnectAgainstBot(ctx *gin.Context) {
-	w, r := ctx.Writer, ctx.Request
 	gameType := ctx.Query("type")
 	username := getUsername(ctx)
 	if len(username) == 0 {
 		return
 	}
 
-	c, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println("ConnectPlayer:", err)
+	level, err := strconv.Atoi(
+		ctx.DefaultQuery("level", strconv.Itoa(core.DEFAULT_BOT_LEVEL)),
+	)
+	if err != nil || level < core.MIN_BOT_LEVEL || level > core.MAX_BOT_LEVEL {
+		ctx.JSON(400, gin.H{"error": "Invalid bot level"})
+		return
+	}
+	rated := ctx.DefaultQuery("rated", "true") == "true"
+
+	if gameType != "reconnect" && rejectIfDraining(ctx) {
+		return
+	}
+
+	c := upgradeGame(ctx)
+	if c == nil {
 		return
 	}
 
 	if gameType == "reconnect" {
 		if ok := reconnectBot(username, c); !ok {
-			c.WriteMessage(
-				websocket.TextMessage,
-				[]byte("Error in reconnecting"),
+			protocol.WriteError(
+				c, protocol.ERR_RECONNECT_FAILED, "no game to reconnect to",
 			)
 		}
 		return
@@ -95,5 +146,5 @@ func ConnectAgainstBot(ctx *gin.Context) {
 	g.Player.Username = username
 	g.Player.Wsc = c
 
-	setupGameBot(g)
+	setupGameBot(g, level, rated)
 }
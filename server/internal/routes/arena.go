@@ -0,0 +1,427 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
+	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
+)
+
+const (
+	ARENA_WIN_POINTS = 2
+
+	// a player who won the last two games is on a streak and scores double
+	// until the next loss
+	ARENA_STREAK_LENGTH = 2
+)
+
+type Arena struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	StartsAt  time.Time `json:"startsAt"`
+	Duration  int       `json:"duration"`
+	CreatedBy string    `json:"createdBy"`
+	core.GameSettings
+}
+
+type ArenaScore struct {
+	Rank     int    `json:"rank"`
+	Username string `json:"username"`
+	Score    int    `json:"score"`
+	Games    int    `json:"games"`
+	Wins     int    `json:"wins"`
+	Streak   int    `json:"streak"`
+}
+
+type ArenaEvent struct {
+	Type        string       `json:"type"`
+	GameId      string       `json:"gameId"`
+	Black       string       `json:"black"`
+	White       string       `json:"white"`
+	Winner      int          `json:"winner"`
+	Leaderboard []ArenaScore `json:"leaderboard"`
+}
+
+var (
+	arenaPools   = make(map[string]*PlayerExists)
+	arenaPoolsMu sync.Mutex
+)
+
+func (a *Arena) EndsAt() time.Time {
+	return a.StartsAt.Add(time.Duration(a.Duration) * time.Minute)
+}
+
+func (a *Arena) IsRunning() bool {
+	now := time.Now()
+	return now.After(a.StartsAt) && now.Before(a.EndsAt())
+}
+
+func arenaChannel(id string) string {
+	return "arena:" + id
+}
+
+// arenaPool returns the matchmaking pool of an arena, so that arena players
+// are only paired among themselves. The pool closes when the arena ends,
+// which sends home the players still waiting in it.
+func arenaPool(a Arena) *PlayerExists {
+	arenaPoolsMu.Lock()
+	defer arenaPoolsMu.Unlock()
+
+	pe, ok := arenaPools[a.Id]
+	if !ok {
+		pe = new(PlayerExists)
+		pe.Ch = make(chan GameStarterData)
+		pe.Closed = make(chan struct{})
+		arenaPools[a.Id] = pe
+
+		time.AfterFunc(time.Until(a.EndsAt()), func() {
+			arenaPoolsMu.Lock()
+			defer arenaPoolsMu.Unlock()
+			close(pe.Closed)
+			delete(arenaPools, a.Id)
+		})
+	}
+	return pe
+}
+
+func getArena(id string) (Arena, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT id, name, startsat, duration, createdby, size, maintime
+	FROM arenas WHERE id = $1`
+
+	var a Arena
+	err := db.QueryRow(query, id).Scan(
+		&a.Id, &a.Name, &a.StartsAt, &a.Duration, &a.CreatedBy,
+		&a.Size, &a.MainTime,
+	)
+	a.Rated = true
+	return a, err
+}
+
+func isArenaPlayer(arenaId string, username string) bool {
+	db := database.GetDatabase()
+	query := `
+	SELECT COUNT(*) FROM arena_players
+	WHERE arenaid = $1 AND username = $2`
+
+	var count int
+	if err := db.QueryRow(query, arenaId, username).Scan(&count); err != nil {
+		log.Println("Error checking arena player:", err)
+		return false
+	}
+	return count > 0
+}
+
+func getArenaLeaderboard(arenaId string) ([]ArenaScore, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT username, score, games, wins, streak
+	FROM arena_players
+	WHERE arenaid = $1
+	ORDER BY score DESC, wins DESC, games ASC`
+
+	var leaderboard []ArenaScore
+	rows, err := db.Query(query, arenaId)
+	if err != nil {
+		return leaderboard, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s ArenaScore
+		if err := rows.Scan(
+			&s.Username, &s.Score, &s.Games, &s.Wins, &s.Streak,
+		); err != nil {
+			return leaderboard, err
+		}
+		s.Rank = len(leaderboard) + 1
+		leaderboard = append(leaderboard, s)
+	}
+	return leaderboard, nil
+}
+
+func publishArenaEvent(arenaId string, event ArenaEvent) {
+	jsondata, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Error marshalling arena event:", err)
+		return
+	}
+
+	err = pubsub.Rdb.Publish(pubsub.RdbCtx, arenaChannel(arenaId), jsondata).Err()
+	if err != nil {
+		log.Println("Error publishing arena event:", err)
+	}
+}
+
+func arenaPoints(streak int) int {
+	if streak >= ARENA_STREAK_LENGTH {
+		return 2 * ARENA_WIN_POINTS
+	}
+	return ARENA_WIN_POINTS
+}
+
+// RecordArenaResult is the game over hook that scores arena games. Games
+// that end after the arena are not scored.
+func RecordArenaResult(result core.GameResult) {
+	db := database.GetDatabase()
+
+	var arenaId string
+	query := `
+	UPDATE arena_games SET done = true
+	WHERE gameid = $1 AND done = false
+	RETURNING arenaid`
+	if err := db.QueryRow(query, result.GameId).Scan(&arenaId); err != nil {
+		// not an arena game, or already scored
+		return
+	}
+
+	a, err := getArena(arenaId)
+	if err != nil {
+		log.Println("Error fetching arena:", err)
+		return
+	}
+	if time.Now().After(a.EndsAt()) {
+		return
+	}
+
+	winner, loser := result.Black, result.White
+	if result.Winner == core.WhiteCell {
+		winner, loser = loser, winner
+	}
+
+	var streak int
+	query = `
+	SELECT streak FROM arena_players WHERE arenaid = $1 AND username = $2`
+	if err := db.QueryRow(query, arenaId, winner).Scan(&streak); err != nil {
+		log.Println("Error fetching arena streak:", err)
+	}
+
+	winnerQuery := `
+	UPDATE arena_players SET
+	score = score + $3, games = games + 1, wins = wins + 1, streak = streak + 1
+	WHERE arenaid = $1 AND username = $2`
+	if _, err := db.Exec(
+		winnerQuery, arenaId, winner, arenaPoints(streak),
+	); err != nil {
+		log.Println("Error updating arena winner:", err)
+	}
+
+	loserQuery := `
+	UPDATE arena_players SET games = games + 1, streak = 0
+	WHERE arenaid = $1 AND username = $2`
+	if _, err := db.Exec(loserQuery, arenaId, loser); err != nil {
+		log.Println("Error updating arena loser:", err)
+	}
+
+	leaderboard, err := getArenaLeaderboard(arenaId)
+	if err != nil {
+		log.Println("Error fetching arena leaderboard:", err)
+	}
+	publishArenaEvent(arenaId, ArenaEvent{
+		Type:        "result",
+		GameId:      result.GameId,
+		Black:       result.Black,
+		White:       result.White,
+		Winner:      result.Winner,
+		Leaderboard: leaderboard,
+	})
+}
+
+func CreateArena(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	var a Arena
+	if err := ctx.ShouldBindJSON(&a); err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := a.GameSettings.Validate(); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if a.Duration <= 0 {
+		ctx.JSON(400, gin.H{"error": "Duration must be positive"})
+		return
+	}
+	if a.StartsAt.IsZero() {
+		a.StartsAt = time.Now()
+	}
+
+	a.Id = core.GetUniqueId()
+	a.CreatedBy = username
+
+	db := database.GetDatabase()
+	insertQuery := `
+	INSERT INTO arenas
+	(id, name, startsat, duration, createdby, size, maintime)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := db.Exec(
+		insertQuery, a.Id, a.Name, a.StartsAt, a.Duration, a.CreatedBy,
+		a.Size, a.MainTime,
+	); err != nil {
+		log.Println("Error creating arena:", err)
+		ctx.JSON(500, gin.H{"error": "Error creating arena"})
+		return
+	}
+
+	ctx.JSON(200, a)
+}
+
+func JoinArena(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	a, err := getArena(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Arena not found"})
+		return
+	}
+	if time.Now().After(a.EndsAt()) {
+		ctx.JSON(400, gin.H{"error": "Arena is over"})
+		return
+	}
+
+	db := database.GetDatabase()
+	insertQuery := `
+	INSERT INTO arena_players (arenaid, username, score, games, wins, streak)
+	VALUES ($1, $2, 0, 0, 0, 0)
+	ON CONFLICT DO NOTHING`
+	if _, err := db.Exec(insertQuery, a.Id, username); err != nil {
+		log.Println("Error joining arena:", err)
+		ctx.JSON(500, gin.H{"error": "Error joining arena"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"message": "Joined successfully"})
+}
+
+// ArenaFindGame works like FindGame, but only pairs players of the arena
+// with each other while the arena is running. Players call it again as soon
+// as their game is over.
+func ArenaFindGame(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	a, err := getArena(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Arena not found"})
+		return
+	}
+	if !a.IsRunning() {
+		ctx.JSON(400, gin.H{"error": "Arena is not running"})
+		return
+	}
+	if !isArenaPlayer(a.Id, username) {
+		ctx.JSON(403, gin.H{"error": "Join the arena first"})
+		return
+	}
+
+	userHashData, opName, ok := matchPlayer(arenaPool(a), username, a.GameSettings)
+	if !ok {
+		ctx.JSON(400, gin.H{"error": "Arena is over"})
+		return
+	}
+
+	if userHashData.Color == core.BlackCell {
+		db := database.GetDatabase()
+		insertQuery := "INSERT INTO arena_games (arenaid, gameid) VALUES ($1, $2)"
+		if _, err := db.Exec(insertQuery, a.Id, userHashData.GameId); err != nil {
+			log.Println("Error adding arena game:", err)
+		}
+
+		publishArenaEvent(a.Id, ArenaEvent{
+			Type:   "pairing",
+			GameId: userHashData.GameId,
+			Black:  username,
+			White:  opName,
+		})
+	}
+
+	addPlayer(username, userHashData)
+	ctx.JSON(200, gin.H{
+		"wsurl": instance.GameUrl(userHashData.GameId),
+	})
+}
+
+func GetArenaLeaderboard(ctx *gin.Context) {
+	a, err := getArena(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Arena not found"})
+		return
+	}
+
+	leaderboard, err := getArenaLeaderboard(a.Id)
+	if err != nil {
+		log.Println("Error fetching arena leaderboard:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"arena":       a,
+		"running":     a.IsRunning(),
+		"leaderboard": leaderboard,
+	})
+}
+
+// ArenaLive sends the leaderboard and then streams the pairing and result
+// events of the arena.
+func ArenaLive(ctx *gin.Context) {
+	w, r := ctx.Writer, ctx.Request
+
+	a, err := getArena(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Arena not found"})
+		return
+	}
+
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("ArenaLive:", err)
+		return
+	}
+	defer c.Close()
+
+	ps := pubsub.Rdb.Subscribe(pubsub.RdbCtx, arenaChannel(a.Id))
+	defer ps.Close()
+
+	if _, err := ps.Receive(pubsub.RdbCtx); err != nil {
+		log.Println("Subscription to arena channel failed")
+		return
+	}
+
+	leaderboard, err := getArenaLeaderboard(a.Id)
+	if err != nil {
+		log.Println("Error fetching arena leaderboard:", err)
+	}
+	if err := c.WriteJSON(ArenaEvent{
+		Type:        "leaderboard",
+		Leaderboard: leaderboard,
+	}); err != nil {
+		return
+	}
+
+	for msg := range ps.Channel() {
+		err := c.WriteMessage(websocket.TextMessage, []byte(msg.Payload))
+		if err != nil {
+			log.Println("Error sending arena event:", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArenaPoints(t *testing.T) {
+	tests := []struct {
+		streak int
+		want   int
+	}{
+		{streak: 0, want: ARENA_WIN_POINTS},
+		{streak: 1, want: ARENA_WIN_POINTS},
+		{streak: ARENA_STREAK_LENGTH, want: 2 * ARENA_WIN_POINTS},
+		{streak: ARENA_STREAK_LENGTH + 3, want: 2 * ARENA_WIN_POINTS},
+	}
+
+	for _, tt := range tests {
+		if got := arenaPoints(tt.streak); got != tt.want {
+			t.Errorf("arenaPoints(%d) = %d, want %d", tt.streak, got, tt.want)
+		}
+	}
+}
+
+func TestArenaIsRunning(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		startsAt time.Time
+		want     bool
+	}{
+		{name: "not started", startsAt: now.Add(time.Minute), want: false},
+		{name: "running", startsAt: now.Add(-time.Minute), want: true},
+		{name: "ended", startsAt: now.Add(-time.Hour), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Arena{StartsAt: tt.startsAt, Duration: 30}
+			if got := a.IsRunning(); got != tt.want {
+				t.Errorf("IsRunning() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArenaEndsAt(t *testing.T) {
+	startsAt := time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC)
+	a := Arena{StartsAt: startsAt, Duration: 45}
+	want := startsAt.Add(45 * time.Minute)
+	if got := a.EndsAt(); !got.Equal(want) {
+		t.Errorf("EndsAt() = %v, want %v", got, want)
+	}
+}
+
+func TestArenaPoolClosesAtEnd(t *testing.T) {
+	// ends 100ms from now
+	a := Arena{
+		Id:       "test-arena-pool",
+		StartsAt: time.Now().Add(100*time.Millisecond - time.Minute),
+		Duration: 1,
+	}
+
+	pe := arenaPool(a)
+	if arenaPool(a) != pe {
+		t.Fatal("arenaPool returned a new pool for the same arena")
+	}
+
+	matched := make(chan bool, 1)
+	go func() {
+		_, _, ok := matchPlayer(pe, "waiting", a.GameSettings)
+		matched <- ok
+	}()
+
+	select {
+	case ok := <-matched:
+		if ok {
+			t.Error("player waiting in a closed arena was matched")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("player still waiting after the arena ended")
+	}
+
+	arenaPoolsMu.Lock()
+	_, ok := arenaPools[a.Id]
+	arenaPoolsMu.Unlock()
+	if ok {
+		t.Error("pool of an ended arena is still registered")
+	}
+}
@@ -0,0 +1,461 @@
+package routes
+
+import (
+	crand "crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
+	"github.com/vanshjangir/rapid-go/server/internal/middleware"
+	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
+)
+
+const (
+	BOT_OFFER_HASH    = "bot_offers"
+	BOT_OFFER_TIMEOUT = 30 * time.Second
+	API_KEY_BYTES     = 32
+
+	// answers are an id and a type, anything longer is not one
+	BOT_ANSWER_LIMIT = 1024
+)
+
+// BotOffer is sent to a bot when someone challenges it, the bot answers
+// with a BotAnswer carrying the same id. Only Bot may answer it.
+type BotOffer struct {
+	Type       string `json:"type"`
+	Id         string `json:"id"`
+	Bot        string `json:"bot"`
+	Challenger string `json:"challenger"`
+	Rating     int    `json:"rating"`
+	core.GameSettings
+}
+
+type BotAnswer struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+type BotOfferResult struct {
+	Accepted bool   `json:"accepted"`
+	GameId   string `json:"gameId"`
+	Black    string `json:"black"`
+	White    string `json:"white"`
+}
+
+// BotStartMsg tells the bot to join the game on the game server, like
+// players do after FindGame.
+type BotStartMsg struct {
+	Type   string `json:"type"`
+	GameId string `json:"gameId"`
+	Color  int    `json:"color"`
+	Size   int    `json:"size"`
+	Wsurl  string `json:"wsurl"`
+}
+
+type createBotData struct {
+	Username string `json:"username"`
+}
+
+func botChannel(username string) string {
+	return "bot:" + username
+}
+
+func botOfferChannel(offerId string) string {
+	return "botoffer:" + offerId
+}
+
+func newApiKey() (string, error) {
+	key := make([]byte, API_KEY_BYTES)
+	if _, err := crand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func setApiKey(username string) (string, error) {
+	key, err := newApiKey()
+	if err != nil {
+		return "", err
+	}
+
+	db := database.GetDatabase()
+	if _, err := db.Exec(
+		"DELETE FROM api_keys WHERE username = $1", username,
+	); err != nil {
+		return "", err
+	}
+
+	insertQuery := `
+	INSERT INTO api_keys (keyhash, username, created_at)
+	VALUES ($1, $2, NOW())`
+	if _, err := db.Exec(
+		insertQuery, middleware.HashApiKey(key), username,
+	); err != nil {
+		return "", err
+	}
+	return TOKEN_TYPE_BOT + key, nil
+}
+
+// isHuman reports whether username is a registered account that is not a
+// bot, only those can own bots.
+func isHuman(username string) bool {
+	db := database.GetDatabase()
+	query := "SELECT COALESCE(isbot, false) FROM users WHERE username = $1"
+
+	var isbot bool
+	if err := db.QueryRow(query, username).Scan(&isbot); err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("Error fetching user:", err)
+		}
+		return false
+	}
+	return !isbot
+}
+
+func isBotOwner(owner string, bot string) bool {
+	db := database.GetDatabase()
+	query := `
+	SELECT username FROM users
+	WHERE username = $1 AND owner = $2 AND isbot = true`
+
+	var username string
+	return db.QueryRow(query, bot, owner).Scan(&username) == nil
+}
+
+// CreateBot registers a bot account owned by the user and returns its API
+// key. The key is not stored and cannot be shown again.
+func CreateBot(ctx *gin.Context) {
+	owner := getUsername(ctx)
+	if len(owner) == 0 {
+		return
+	}
+
+	if !isHuman(owner) {
+		ctx.JSON(403, gin.H{"error": "Only registered players can own bots"})
+		return
+	}
+
+	var req createBotData
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Username == "" {
+		ctx.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if core.IsReservedName(req.Username) {
+		ctx.JSON(400, gin.H{"error": "Username is reserved"})
+		return
+	}
+
+	db := database.GetDatabase()
+	var existingUsername string
+	queryUsername := "SELECT username FROM users WHERE username=$1"
+	err := db.QueryRow(queryUsername, req.Username).Scan(&existingUsername)
+	if err == nil {
+		ctx.JSON(409, gin.H{"error": "Username already in use"})
+		return
+	} else if err != sql.ErrNoRows {
+		log.Println("Error checking bot username:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	insertQuery := `
+	INSERT INTO users (username, isbot, owner)
+	VALUES ($1, true, $2)`
+	if _, err := db.Exec(insertQuery, req.Username, owner); err != nil {
+		log.Println("Error creating bot:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	token, err := setApiKey(req.Username)
+	if err != nil {
+		log.Println("Error creating API key:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"username": req.Username,
+		"token":    token,
+	})
+}
+
+// NewBotKey replaces the API key of a bot, the old key stops working.
+func NewBotKey(ctx *gin.Context) {
+	owner := getUsername(ctx)
+	if len(owner) == 0 {
+		return
+	}
+
+	bot := ctx.Param("username")
+	if !isBotOwner(owner, bot) {
+		ctx.JSON(403, gin.H{"error": "Bot belongs to another player"})
+		return
+	}
+
+	token, err := setApiKey(bot)
+	if err != nil {
+		log.Println("Error creating API key:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"username": bot,
+		"token":    token,
+	})
+}
+
+// takeBotOffer removes the offer, only the caller for which it returns true
+// may answer it. A bot can only take the offers made to it, the challenger
+// takes its own offer back with an empty bot.
+func takeBotOffer(offerId string, bot string) (BotOffer, bool) {
+	var offer BotOffer
+	jsondata, err := pubsub.Rdb.HGet(
+		pubsub.RdbCtx, BOT_OFFER_HASH, offerId,
+	).Result()
+	if err != nil {
+		return offer, false
+	}
+	if err := json.Unmarshal([]byte(jsondata), &offer); err != nil {
+		log.Println("Error unmarshalling bot offer:", err)
+		return offer, false
+	}
+	if bot != "" && offer.Bot != bot {
+		return offer, false
+	}
+
+	removed, err := pubsub.Rdb.HDel(
+		pubsub.RdbCtx, BOT_OFFER_HASH, offerId,
+	).Result()
+	if err != nil || removed == 0 {
+		return offer, false
+	}
+	return offer, true
+}
+
+func publishJSON(channel string, v any) int64 {
+	jsondata, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Error marshalling pubsub message:", err)
+		return 0
+	}
+
+	receivers, err := pubsub.Rdb.Publish(
+		pubsub.RdbCtx, channel, jsondata,
+	).Result()
+	if err != nil {
+		log.Println("Error publishing to", channel, err)
+	}
+	return receivers
+}
+
+// ChallengeBot offers a game to a bot and waits for its answer. When the
+// bot accepts, the game is set up and the challenger joins it through the
+// returned wsurl.
+func ChallengeBot(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+	bot := ctx.Param("username")
+
+	settings := core.DefaultSettings()
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&settings); err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+	if err := settings.Validate(); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	offer := BotOffer{
+		Type:         "offer",
+		Id:           core.GetUniqueId(),
+		Bot:          bot,
+		Challenger:   username,
+		GameSettings: settings,
+	}
+	offer.Rating = core.GetRating(
+		username, settings.Size, core.SpeedCategory(settings.MainTime),
+	)
+
+	jsondata, err := json.Marshal(offer)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+	err = pubsub.Rdb.HSet(
+		pubsub.RdbCtx, BOT_OFFER_HASH, offer.Id, jsondata,
+	).Err()
+	if err != nil {
+		log.Println("Error storing bot offer:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	ps := pubsub.Rdb.Subscribe(pubsub.RdbCtx, botOfferChannel(offer.Id))
+	defer ps.Close()
+	if _, err := ps.Receive(pubsub.RdbCtx); err != nil {
+		log.Println("Subscription to bot offer channel failed")
+		takeBotOffer(offer.Id, "")
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	if receivers := publishJSON(botChannel(bot), offer); receivers == 0 {
+		takeBotOffer(offer.Id, "")
+		ctx.JSON(404, gin.H{"error": "Bot is not online"})
+		return
+	}
+
+	result, ok := waitForBotAnswer(ps, offer.Id)
+	if !ok {
+		ctx.JSON(504, gin.H{"error": "Bot did not answer"})
+		return
+	}
+	if !result.Accepted {
+		ctx.JSON(409, gin.H{"error": "Bot declined the game"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"wsurl":  instance.GameUrl(result.GameId),
+		"gameId": result.GameId,
+		"black":  result.Black,
+		"white":  result.White,
+	})
+}
+
+func waitForBotAnswer(ps *redis.PubSub, offerId string) (BotOfferResult, bool) {
+	var result BotOfferResult
+	timeout := time.After(BOT_OFFER_TIMEOUT)
+	for {
+		select {
+		case msg := <-ps.Channel():
+			if err := json.Unmarshal([]byte(msg.Payload), &result); err != nil {
+				log.Println("Error unmarshalling bot answer:", err)
+				return result, false
+			}
+			return result, true
+
+		case <-timeout:
+			if _, ok := takeBotOffer(offerId, ""); ok {
+				return result, false
+			}
+			// the bot took the offer just now, its answer is on the way
+			timeout = time.After(time.Second)
+		}
+	}
+}
+
+func acceptBotOffer(bot string, offer BotOffer) {
+	black, white := offer.Challenger, bot
+	if rand.Intn(2) == 0 {
+		black, white = white, black
+	}
+
+	gameId := core.GetUniqueId()
+	RegisterGame(gameId, black, white, offer.GameSettings)
+
+	start := BotStartMsg{
+		Type:   "start",
+		GameId: gameId,
+		Color:  core.WhiteCell,
+		Size:   offer.Size,
+		Wsurl:  instance.GameUrl(gameId),
+	}
+	if black == bot {
+		start.Color = core.BlackCell
+	}
+
+	// the start message goes through the bot's channel, so the feed stays
+	// the only writer on the bot's connection
+	publishJSON(botChannel(bot), start)
+	publishJSON(botOfferChannel(offer.Id), BotOfferResult{
+		Accepted: true,
+		GameId:   gameId,
+		Black:    black,
+		White:    white,
+	})
+	log.Println("Bot accepted game", bot, gameId)
+}
+
+func botFeed(wsc *websocket.Conn, ps *redis.PubSub) {
+	for msg := range ps.Channel() {
+		err := wsc.WriteMessage(websocket.TextMessage, []byte(msg.Payload))
+		if err != nil {
+			log.Println("Error sending bot message:", err)
+			return
+		}
+	}
+}
+
+// BotApi is where bot accounts wait for games. The bot receives offer
+// messages and answers each with accept or decline, after accepting it gets
+// a start message and plays the game over the regular game websocket.
+func BotApi(ctx *gin.Context) {
+	w, r := ctx.Writer, ctx.Request
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	if !ctx.GetBool("isbot") {
+		ctx.JSON(403, gin.H{"error": "Only bot accounts can use the bot API"})
+		return
+	}
+
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("BotApi:", err)
+		return
+	}
+	defer c.Close()
+	c.SetReadLimit(BOT_ANSWER_LIMIT)
+
+	ps := pubsub.Rdb.Subscribe(pubsub.RdbCtx, botChannel(username))
+	defer ps.Close()
+
+	if _, err := ps.Receive(pubsub.RdbCtx); err != nil {
+		log.Println("Subscription to bot channel failed")
+		return
+	}
+
+	go botFeed(c, ps)
+
+	for {
+		var answer BotAnswer
+		if err := c.ReadJSON(&answer); err != nil {
+			break
+		}
+
+		offer, ok := takeBotOffer(answer.Id, username)
+		if !ok {
+			continue
+		}
+
+		switch answer.Type {
+		case "accept":
+			acceptBotOffer(username, offer)
+		default:
+			publishJSON(
+				botOfferChannel(offer.Id), BotOfferResult{Accepted: false},
+			)
+		}
+	}
+
+	log.Println("Bot disconnected", username)
+}
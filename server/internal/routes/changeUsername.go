@@ -11,6 +11,26 @@ type ChangeUsernameType struct {
 	Newusername string `json:"newusername"`
 }
 
+// usernameColumns lists the columns outside of users that hold a username,
+// as table and column. The bot account tables follow users by themselves.
+var usernameColumns = [][2]string{
+	{"games", "white"},
+	{"games", "black"},
+	{"ratings", "username"},
+	{"tournaments", "createdby"},
+	{"tournament_players", "username"},
+	{"tournament_games", "black"},
+	{"tournament_games", "white"},
+	{"arenas", "createdby"},
+	{"arena_players", "username"},
+	{"ladders", "createdby"},
+	{"ladder_players", "username"},
+	{"ladder_challenges", "challenger"},
+	{"ladder_challenges", "defender"},
+	{"leaderboard_snapshots", "username"},
+	{"spectator_chat", "username"},
+}
+
 func ChangeUsername(ctx *gin.Context) {
 	db := database.GetDatabase()
 
@@ -21,32 +41,45 @@ func ChangeUsername(ctx *gin.Context) {
 		return
 	}
 
-	query := "SELECT * FROM users WHERE username = $1"
+	query := "SELECT username FROM users WHERE username = $1"
 	var username string
-	db.QueryRow(query).Scan(&username)
+	db.QueryRow(query, cu.Newusername).Scan(&username)
 	if username != "" {
 		ctx.JSON(400, gin.H{"error": "Username already exists"})
 		return
 	}
 
+	// the rename goes through everywhere or nowhere
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("DB transaction error: ", err)
+		ctx.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+
 	query = "UPDATE users SET username = $1 WHERE username = $2"
-	if _, err := db.Exec(query, cu.Newusername, cu.Username); err != nil {
+	if _, err := tx.Exec(query, cu.Newusername, cu.Username); err != nil {
 		log.Println("DB query error: ", err)
 		ctx.JSON(500, gin.H{"error": "Error updating username in users"})
 		return
 	}
 
-	query = "UPDATE games SET white = $1 WHERE white = $2"
-	if _, err := db.Exec(query, cu.Newusername, cu.Username); err != nil {
-		log.Println("DB query error: ", err)
-		ctx.JSON(500, gin.H{"error": "Error creating white in games"})
-		return
+	for _, tc := range usernameColumns {
+		query = "UPDATE " + tc[0] + " SET " + tc[1] + " = $1 WHERE " +
+			tc[1] + " = $2"
+		if _, err := tx.Exec(query, cu.Newusername, cu.Username); err != nil {
+			log.Println("DB query error: ", err)
+			ctx.JSON(500, gin.H{
+				"error": "Error updating " + tc[1] + " in " + tc[0],
+			})
+			return
+		}
 	}
 
-	query = "UPDATE games SET black = $1 WHERE black = $2"
-	if _, err := db.Exec(query, cu.Newusername, cu.Username); err != nil {
-		log.Println("DB query error: ", err)
-		ctx.JSON(500, gin.H{"error": "Error creating black in games"})
+	if err := tx.Commit(); err != nil {
+		log.Println("DB commit error: ", err)
+		ctx.JSON(500, gin.H{"error": "Internal server error"})
 		return
 	}
 
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+)
+
+// rejectIfDraining answers requests for new games while the instance is
+// draining, so the client asks /getwsurl for another one.
+func rejectIfDraining(ctx *gin.Context) bool {
+	if !core.Draining() {
+		return false
+	}
+	ctx.JSON(503, gin.H{"error": "Server is draining, try another server"})
+	return true
+}
+
+// DrainInstance starts draining this instance without shutting it down.
+func DrainInstance(ctx *gin.Context) {
+	go core.Drain()
+	ctx.JSON(202, gin.H{"message": "Draining started"})
+}
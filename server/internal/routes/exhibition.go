@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+)
+
+type exhibitionRequest struct {
+	BlackLevel int `json:"blackLevel"`
+	WhiteLevel int `json:"whiteLevel"`
+	Size       int `json:"size"`
+}
+
+func validBotLevel(level int) bool {
+	return level >= core.MIN_BOT_LEVEL && level <= core.MAX_BOT_LEVEL
+}
+
+// StartExhibition starts a game between two engine levels which can be
+// watched through /spectate/:gameId. Exhibition games are not rated.
+func StartExhibition(ctx *gin.Context) {
+	if rejectIfDraining(ctx) {
+		return
+	}
+
+	var req exhibitionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if !validBotLevel(req.BlackLevel) || !validBotLevel(req.WhiteLevel) {
+		ctx.JSON(400, gin.H{"error": "Invalid bot level"})
+		return
+	}
+
+	settings := core.DefaultSettings()
+	settings.Rated = false
+	if req.Size != 0 {
+		settings.Size = req.Size
+	}
+	if err := settings.Validate(); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	g := new(core.Game)
+	g.Id = core.GetUniqueId()
+	g.Player = new(core.Player)
+	g.Player.Game = g
+	g.Player.Username, g.OpName = core.ExhibitionNames(
+		req.BlackLevel, req.WhiteLevel,
+	)
+	g.Player.Color = core.BlackCell
+	g.AgainstBot = true
+	g.Exhibition = true
+	g.BlackLevel = req.BlackLevel
+	g.BotLevel = req.WhiteLevel
+	g.Settings = settings
+	g.InitGame()
+
+	// both engines of a game are held under keys of their own, so the per
+	// user limit of the pool does not apply
+	blackKey, whiteKey := g.Id+"/black", g.Id+"/white"
+	black, err := core.Engines.Acquire(blackKey, req.BlackLevel, settings.Size)
+	if err != nil {
+		ctx.JSON(503, gin.H{"error": err.Error()})
+		return
+	}
+	white, err := core.Engines.Acquire(whiteKey, req.WhiteLevel, settings.Size)
+	if err != nil {
+		core.Engines.Release(blackKey, black)
+		ctx.JSON(503, gin.H{"error": err.Error()})
+		return
+	}
+
+	addGameWithSettings(g.Id, g.Player.Username, g.OpName, settings)
+	err = addGameToDb(g)
+	if err == nil {
+		err = addBotEntry(g)
+	}
+	if err != nil {
+		log.Println("Error adding exhibition game:", err)
+		core.Engines.Release(blackKey, black)
+		core.Engines.Release(whiteKey, white)
+		ctx.JSON(500, gin.H{"error": "Error creating game"})
+		return
+	}
+
+	go func() {
+		defer core.Engines.Release(blackKey, black)
+		defer core.Engines.Release(whiteKey, white)
+		core.RunExhibition(g, black, white)
+	}()
+
+	log.Println("Exhibition game started", g.Id, g.Player.Username, g.OpName)
+	ctx.JSON(200, gin.H{
+		"gameId": g.Id,
+		"black":  g.Player.Username,
+		"white":  g.OpName,
+	})
+}
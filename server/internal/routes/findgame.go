@@ -3,12 +3,12 @@ package routes
 import (
 	"encoding/json"
 	"log"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
 	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
 )
 
@@ -22,13 +22,22 @@ type GameStarterData struct {
 	Username string `json:"white"`
 }
 
+// PlayerExists is a matchmaking pool. A pool with a Closed channel stops
+// pairing players once it is closed, the rating pools never close.
 type PlayerExists struct {
 	mu     sync.Mutex
 	Ch     chan GameStarterData
 	Exists bool
+	Closed chan struct{}
 }
 
-var Pe *PlayerExists
+// MATCH_RATING_BAND is the width of the rating bands players are paired in.
+const MATCH_RATING_BAND = 300
+
+var (
+	ratingPools   = make(map[int]*PlayerExists)
+	ratingPoolsMu sync.Mutex
+)
 
 func (pe *PlayerExists) doesExists() bool {
 	pe.mu.Lock()
@@ -60,6 +69,12 @@ func addPlayer(username string, userHashData UserHashData) {
 }
 
 func addGame(gameId string, black string, white string) {
+	addGameWithSettings(gameId, black, white, core.DefaultSettings())
+}
+
+func addGameWithSettings(
+	gameId string, black string, white string, settings core.GameSettings,
+) {
 	hashkey := "live_game"
 
 	var gdr core.GameDataRedis
@@ -67,6 +82,7 @@ func addGame(gameId string, black string, white string) {
 	gdr.White = white
 	gdr.Turn = core.BlackCell
 	gdr.Id = gameId
+	gdr.GameSettings = settings
 
 	jsondata, err := json.Marshal(gdr)
 	if err != nil {
@@ -82,6 +98,7 @@ func addGame(gameId string, black string, white string) {
 		)
 	} else {
 		log.Printf("Game data added in redis for %v : %v", gameId, gdr)
+		listGame(gdr)
 	}
 
 	err = pubsub.Rdb.Expire(pubsub.RdbCtx, hashkey, 35*60*time.Second).Err()
@@ -93,48 +110,120 @@ func addGame(gameId string, black string, white string) {
 	}
 }
 
-func FindGame(ctx *gin.Context) {
+// RegisterGame stores a game that has been set up without the matchmaker,
+// like an accepted seek or a rematch, along with the game entries of both
+// players.
+func RegisterGame(
+	gameId string, black string, white string, settings core.GameSettings,
+) {
+	addGameWithSettings(gameId, black, white, settings)
+	addPlayer(black, UserHashData{GameId: gameId, Color: core.BlackCell})
+	addPlayer(white, UserHashData{GameId: gameId, Color: core.WhiteCell})
+}
+
+// matchPlayer pairs the player with the one already waiting in pe, or waits
+// in pe for an opponent. The waiting player plays black and registers the
+// game with the given settings. It returns the player's game entry and, to
+// the waiting player only, the opponent's username. It returns false when
+// the pool closes before the player is paired.
+func matchPlayer(
+	pe *PlayerExists, username string, settings core.GameSettings,
+) (UserHashData, string, bool) {
 	var userHashData UserHashData
 	var gameStarterData GameStarterData
-	usernameItf, exists := ctx.Get("username")
-	if !exists {
-		ctx.JSON(500, gin.H{"error": "Internal server error"})
-		return
-	}
 
-	username, ok := usernameItf.(string)
-	if !ok {
-		ctx.JSON(500, gin.H{"error": "Internal server error"})
-		return
-	}
-
-	if Pe.doesExists() == false {
+	if pe.doesExists() == false {
 		// wait for the other player to join, which will send gameId
 		// and his username to this player
 
-		Pe.flip()
-		gameStarterData = <-Pe.Ch
+		pe.flip()
+		select {
+		case gameStarterData = <-pe.Ch:
+		case <-pe.Closed:
+			return userHashData, "", false
+		}
 		userHashData.GameId = gameStarterData.GameId
 		userHashData.Color = core.BlackCell
 
-		addGame(
+		addGameWithSettings(
 			userHashData.GameId,
 			username,                 // black player username
 			gameStarterData.Username, // white player username
+			settings,
 		)
-	} else {
-		// generate the game id, and send it to the channel
-		// where a player is already waiting
-		Pe.flip()
-		gameStarterData.GameId = core.GetUniqueId()
-		gameStarterData.Username = username
-		Pe.Ch <- gameStarterData
-		userHashData.GameId = gameStarterData.GameId
-		userHashData.Color = core.WhiteCell
+		return userHashData, gameStarterData.Username, true
+	}
+
+	// generate the game id, and send it to the channel
+	// where a player is already waiting
+	pe.flip()
+	gameStarterData.GameId = core.GetUniqueId()
+	gameStarterData.Username = username
+	select {
+	case pe.Ch <- gameStarterData:
+	case <-pe.Closed:
+		return userHashData, "", false
+	}
+	userHashData.GameId = gameStarterData.GameId
+	userHashData.Color = core.WhiteCell
+	return userHashData, "", true
+}
+
+// ratingPool returns the matchmaking pool of a rating band.
+func ratingPool(band int) *PlayerExists {
+	ratingPoolsMu.Lock()
+	defer ratingPoolsMu.Unlock()
+
+	pe, ok := ratingPools[band]
+	if !ok {
+		pe = new(PlayerExists)
+		pe.Ch = make(chan GameStarterData)
+		ratingPools[band] = pe
+	}
+	return pe
+}
+
+// matchPool returns the pool a player with the given rating is paired in,
+// the one of the player's band, unless nobody waits there but someone waits
+// in the band next to the rating.
+func matchPool(rating int) *PlayerExists {
+	band := rating / MATCH_RATING_BAND
+	pe := ratingPool(band)
+	if pe.doesExists() {
+		return pe
+	}
+
+	next := band - 1
+	if rating%MATCH_RATING_BAND >= MATCH_RATING_BAND/2 {
+		next = band + 1
+	}
+	if nextPe := ratingPool(next); nextPe.doesExists() {
+		return nextPe
+	}
+	return pe
+}
+
+func FindGame(ctx *gin.Context) {
+	usernameItf, exists := ctx.Get("username")
+	if !exists {
+		ctx.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	username, ok := usernameItf.(string)
+	if !ok {
+		ctx.JSON(500, gin.H{"error": "Internal server error"})
+		return
 	}
 
+	settings := core.DefaultSettings()
+	rating := core.GetRating(
+		username, settings.Size, core.SpeedCategory(settings.MainTime),
+	)
+	userHashData, _, _ := matchPlayer(matchPool(rating), username, settings)
+
 	addPlayer(username, userHashData)
 	ctx.JSON(200, gin.H{
-		"wsurl": os.Getenv("WSURL"),
+		"wsurl": instance.GameUrl(userHashData.GameId),
 	})
 }
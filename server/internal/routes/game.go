@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
 	"github.com/vanshjangir/rapid-go/server/internal/core"
 	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
+	"github.com/vanshjangir/rapid-go/server/internal/protocol"
 	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
 )
 
@@ -28,23 +31,8 @@ const (
 	MSG_TYPE_ABORT = 4
 	MSG_TYPE_WIN   = 5
 	MSG_TYPE_LOSE  = 6
-
-	GNUGO_RATING = 1800
 )
 
-func getRating(username string) int {
-	db := database.GetDatabase()
-	query := "SELECT rating FROM users WHERE username = $1"
-
-	var rating int
-	err := db.QueryRow(query, username).Scan(&rating)
-	if err != nil {
-		return 400
-	}
-
-	return rating
-}
-
 func addGameToDb(g *core.Game) error {
 	player := "white"
 	if g.Player.Color == core.BlackCell {
@@ -71,11 +59,15 @@ func addGameToDb(g *core.Game) error {
 		}
 	} else {
 		insertQuery := fmt.Sprintf(`
-			INSERT INTO games (gameid, %s) VALUES ($1, $2)`,
+			INSERT INTO games (gameid, %s, size, maintime, category, rated)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
 			player,
 		)
 
-		if _, err := db.Exec(insertQuery, g.Id, g.Player.Username); err != nil {
+		if _, err := db.Exec(
+			insertQuery, g.Id, g.Player.Username, g.Settings.Size,
+			g.Settings.MainTime, g.RatingCategory(), g.Settings.Rated,
+		); err != nil {
 			return err
 		}
 	}
@@ -87,12 +79,12 @@ func startGame(g *core.Game) {
 	log.Println("New match has started")
 
 	g.InitGame()
-	g.Player.Rating = getRating(g.Player.Username)
+	g.LoadRatings()
 	g.Player.Wsc.WriteJSON(
-		core.StartMsg{Start: 1, Color: g.Player.Color, GameId: g.Id},
+		g.StartMsg(),
 	)
 
-	core.Pmap[g.Player.Username] = g
+	core.AddGame(g.Player.Username, g)
 	g.Over = make(chan bool)
 	if err := addGameToDb(g); err != nil {
 		log.Println("Error occurred in adding Game data:", err)
@@ -103,16 +95,17 @@ func startGame(g *core.Game) {
 	go core.MonitorTimeout(g)
 }
 
-func reconnect(username string, c *websocket.Conn) bool {
-	g, ok := core.Pmap[username]
+func reconnect(username string, c *protocol.Conn) bool {
+	g, ok := core.GetGame(username)
 	if !ok || g == nil {
-		return false
+		// the game may have been handed off to this instance
+		return restoreGame(username, c)
 	}
 
 	g.Player.DisConn = false
 	g.Player.Wsc = c
 	g.Player.Wsc.WriteJSON(
-		core.StartMsg{Start: 1, Color: g.Player.Color, GameId: g.Id},
+		g.StartMsg(),
 	)
 	go core.PlayGame(g)
 
@@ -160,6 +153,87 @@ func getOpName(gameId string) (string, error) {
 	return jsonData, nil
 }
 
+// restoreGame picks up a game from its state in Redis, for games that were
+// running on another instance, games against the engine included.
+func restoreGame(username string, c *protocol.Conn) bool {
+	jsondata, err := getPlayerGame(username)
+	if err != nil {
+		log.Println("Error getting player game", err)
+		return false
+	}
+
+	var userHashData UserHashData
+	if err := json.Unmarshal([]byte(jsondata), &userHashData); err != nil {
+		log.Println("Error in Unmarshalling json for restoreGame: ", err)
+		return false
+	}
+
+	// only the owner runs the game, a client that reached another instance
+	// has to ask /getwsurl where the game is
+	if instance.GameUrl(userHashData.GameId) != instance.Self.Url {
+		return false
+	}
+
+	gdr, err := getGameFromRedis(userHashData.GameId)
+	if err != nil {
+		log.Println("Error restoring game:", err)
+		return false
+	}
+
+	if username != gdr.Black && username != gdr.White {
+		return false
+	}
+	g, err := core.GameFromRedis(gdr, userHashData.Color)
+	if err != nil {
+		log.Println("Error replaying restored game:", err)
+		return false
+	}
+	g.Player.Wsc = c
+
+	// the clock of the player to move kept running since the last update,
+	// unless the game was handed off, which stops the clocks
+	if !gdr.Paused && !gdr.HandedOff && !gdr.LastUpdated.IsZero() {
+		elapsed := time.Since(gdr.LastUpdated).Milliseconds()
+		if gdr.Turn == g.Player.Color {
+			g.Player.Clk.Spent += elapsed
+		} else {
+			g.Player.OpClk.Spent += elapsed
+		}
+	}
+	if gdr.Paused {
+		g.Paused = true
+		g.PauseStart = time.Now()
+	}
+
+	var engine *core.GnuGo
+	if g.AgainstBot {
+		if engine, err = acquireEngine(g); err != nil {
+			log.Println("Error acquiring engine:", err)
+			return false
+		}
+	}
+
+	g.LoadRatings()
+	g.Player.Wsc.WriteJSON(
+		g.StartMsg(),
+	)
+
+	g.Over = make(chan bool)
+	core.AddGame(username, g)
+	if gdr.HandedOff {
+		core.TakeOver(g)
+	}
+	if g.AgainstBot {
+		go core.PlayGameBot(g, engine)
+	} else {
+		go core.PlayGame(g)
+		go core.MonitorTimeout(g)
+	}
+
+	log.Println("Player restored game", username, g.Id)
+	return true
+}
+
 func setupGame(g *core.Game) {
 	var jsondata string
 	var err error
@@ -198,28 +272,47 @@ func setupGame(g *core.Game) {
 	} else {
 		g.OpName = players["black"].(string)
 	}
+
+	// games created before settings were stored fall back to the defaults
+	// in InitGame
+	var settings core.GameSettings
+	if err := json.Unmarshal([]byte(jsondata), &settings); err != nil {
+		log.Println("Error in Unmarshalling game settings: ", err)
+	} else if settings.Size != 0 {
+		g.Settings = settings
+	}
 	startGame(g)
 }
 
 func ConnectPlayer(ctx *gin.Context) {
-	w, r := ctx.Writer, ctx.Request
 	gameType := ctx.Query("type")
 	username := getUsername(ctx)
 	if len(username) == 0 {
 		return
 	}
 
-	c, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println("ConnectPlayer:", err)
+	if gameType != "reconnect" && rejectIfDraining(ctx) {
+		return
+	}
+
+	c := upgradeGame(ctx)
+	if c == nil {
 		return
 	}
 
 	if gameType == "reconnect" {
 		if ok := reconnect(username, c); !ok {
-			c.WriteMessage(
-				websocket.TextMessage,
-				[]byte("Error in reconnecting"),
+			protocol.WriteError(
+				c, protocol.ERR_RECONNECT_FAILED, "no game to reconnect to",
+			)
+		}
+		return
+	}
+
+	if gameType == "resume" {
+		if ok := resumeAdjourned(username, ctx.Query("gameId"), c); !ok {
+			protocol.WriteError(
+				c, protocol.ERR_RESUME_FAILED, "the game cannot be resumed",
 			)
 		}
 		return
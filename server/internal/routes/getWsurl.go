@@ -1,11 +1,16 @@
 package routes
 
 import (
-	"os"
-
 	"github.com/gin-gonic/gin"
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
 )
 
+// GetWsurl returns the websocket server to connect to. With a gameId it is
+// the server that owns the game, which is where reconnects have to go.
 func GetWsurl(ctx *gin.Context) {
-	ctx.JSON(200, gin.H{"wsurl": os.Getenv("WSURL")})
+	if gameId := ctx.Query("gameId"); gameId != "" {
+		ctx.JSON(200, gin.H{"wsurl": instance.GameUrl(gameId)})
+		return
+	}
+	ctx.JSON(200, gin.H{"wsurl": instance.Url()})
 }
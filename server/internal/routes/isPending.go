@@ -18,9 +18,11 @@ func IsPending(ctx *gin.Context) {
 		return
 	}
 
-	_, ok = core.Pmap[username]
+	_, ok = core.GetGame(username)
 	if ok {
 		ctx.JSON(200, gin.H{"status": "present"})
+	} else if games := getAdjournedGames(username); len(games) > 0 {
+		ctx.JSON(200, gin.H{"status": "adjourned", "games": games})
 	} else {
 		ctx.JSON(200, gin.H{"status": "absent"})
 	}
@@ -0,0 +1,666 @@
+package routes
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
+)
+
+const (
+	CHALLENGE_PENDING  = "pending"
+	CHALLENGE_PLAYING  = "playing"
+	CHALLENGE_DONE     = "done"
+	CHALLENGE_DECLINED = "declined"
+	CHALLENGE_EXPIRED  = "expired"
+
+	DEFAULT_MAX_CHALLENGE     = 3
+	DEFAULT_CHALLENGE_TIMEOUT = 48
+
+	CHALLENGE_EXPIRY_CHECK = time.Minute
+)
+
+type Ladder struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	MaxChallenge int    `json:"maxChallenge"`
+	Timeout      int    `json:"timeout"`
+	CreatedBy    string `json:"createdBy"`
+	core.GameSettings
+}
+
+type LadderPlayer struct {
+	Position int    `json:"position"`
+	Username string `json:"username"`
+}
+
+type Challenge struct {
+	Id         string    `json:"id"`
+	LadderId   string    `json:"ladderId"`
+	Challenger string    `json:"challenger"`
+	Defender   string    `json:"defender"`
+	GameId     string    `json:"gameId"`
+	Wsurl      string    `json:"wsurl,omitempty"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"createdAt"`
+	AcceptedAt time.Time `json:"acceptedAt"`
+}
+
+// inRange tells whether the player at challengerPos may challenge the one at
+// defenderPos, who has to be above and at most MaxChallenge places up.
+func (l *Ladder) inRange(challengerPos int, defenderPos int) bool {
+	return defenderPos < challengerPos &&
+		challengerPos-defenderPos <= l.MaxChallenge
+}
+
+func getLadder(id string) (Ladder, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT id, name, maxchallenge, timeout, createdby, size, maintime
+	FROM ladders WHERE id = $1`
+
+	var l Ladder
+	err := db.QueryRow(query, id).Scan(
+		&l.Id, &l.Name, &l.MaxChallenge, &l.Timeout, &l.CreatedBy,
+		&l.Size, &l.MainTime,
+	)
+	l.Rated = true
+	return l, err
+}
+
+func getLadderPosition(ladderId string, username string) (int, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT position FROM ladder_players
+	WHERE ladderid = $1 AND username = $2`
+
+	var position int
+	err := db.QueryRow(query, ladderId, username).Scan(&position)
+	return position, err
+}
+
+func getLadderPlayers(ladderId string) ([]LadderPlayer, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT position, username FROM ladder_players
+	WHERE ladderid = $1 ORDER BY position`
+
+	var players []LadderPlayer
+	rows, err := db.Query(query, ladderId)
+	if err != nil {
+		return players, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p LadderPlayer
+		if err := rows.Scan(&p.Position, &p.Username); err != nil {
+			return players, err
+		}
+		players = append(players, p)
+	}
+	return players, nil
+}
+
+func scanChallenges(rows *sql.Rows) ([]Challenge, error) {
+	defer rows.Close()
+
+	var challenges []Challenge
+	for rows.Next() {
+		var c Challenge
+		if err := rows.Scan(
+			&c.Id, &c.LadderId, &c.Challenger, &c.Defender, &c.GameId,
+			&c.Status, &c.CreatedAt, &c.AcceptedAt,
+		); err != nil {
+			return challenges, err
+		}
+		challenges = append(challenges, c)
+	}
+	return challenges, nil
+}
+
+func getOpenChallenges(ladderId string) ([]Challenge, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT id, ladderid, challenger, defender, COALESCE(gameid, ''), status,
+	created_at, COALESCE(accepted_at, created_at)
+	FROM ladder_challenges
+	WHERE ladderid = $1 AND status IN ($2, $3)
+	ORDER BY created_at`
+
+	rows, err := db.Query(query, ladderId, CHALLENGE_PENDING, CHALLENGE_PLAYING)
+	if err != nil {
+		return nil, err
+	}
+	return scanChallenges(rows)
+}
+
+func getChallenge(id string) (Challenge, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT id, ladderid, challenger, defender, COALESCE(gameid, ''), status,
+	created_at, COALESCE(accepted_at, created_at)
+	FROM ladder_challenges WHERE id = $1`
+
+	var c Challenge
+	err := db.QueryRow(query, id).Scan(
+		&c.Id, &c.LadderId, &c.Challenger, &c.Defender, &c.GameId,
+		&c.Status, &c.CreatedAt, &c.AcceptedAt,
+	)
+	return c, err
+}
+
+// insertChallenge stores a new challenge unless one of its players already
+// has an open challenge on the ladder. The check and the insert hold the
+// ladder's lock, so that two challenges cannot both pass the check.
+func insertChallenge(c Challenge) (bool, error) {
+	db := database.GetDatabase()
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"SELECT pg_advisory_xact_lock(hashtext($1))", c.LadderId,
+	); err != nil {
+		return false, err
+	}
+
+	var open int
+	query := `
+	SELECT COUNT(*) FROM ladder_challenges
+	WHERE ladderid = $1 AND status IN ($2, $3)
+	AND (challenger IN ($4, $5) OR defender IN ($4, $5))`
+	if err := tx.QueryRow(
+		query, c.LadderId, CHALLENGE_PENDING, CHALLENGE_PLAYING,
+		c.Challenger, c.Defender,
+	).Scan(&open); err != nil {
+		return false, err
+	}
+	if open > 0 {
+		return false, nil
+	}
+
+	insertQuery := `
+	INSERT INTO ladder_challenges
+	(id, ladderid, challenger, defender, status, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+	if _, err := tx.Exec(
+		insertQuery, c.Id, c.LadderId, c.Challenger, c.Defender, c.Status,
+		c.CreatedAt,
+	); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// swapLadderPositions lets the challenger take the defender's place and
+// moves the defender to where the challenger was.
+func swapLadderPositions(c Challenge) error {
+	challengerPos, err := getLadderPosition(c.LadderId, c.Challenger)
+	if err != nil {
+		return err
+	}
+	defenderPos, err := getLadderPosition(c.LadderId, c.Defender)
+	if err != nil {
+		return err
+	}
+
+	db := database.GetDatabase()
+	query := `
+	UPDATE ladder_players SET position = CASE
+	WHEN username = $2 THEN $5::int
+	WHEN username = $3 THEN $4::int
+	END
+	WHERE ladderid = $1 AND username IN ($2, $3)`
+	_, err = db.Exec(
+		query, c.LadderId, c.Challenger, c.Defender, challengerPos, defenderPos,
+	)
+	return err
+}
+
+// closeChallenge sets the final status of an open challenge and applies the
+// ladder result when the challenger won. It returns false if the challenge
+// was already closed.
+func closeChallenge(c Challenge, status string, challengerWon bool) bool {
+	db := database.GetDatabase()
+	query := `
+	UPDATE ladder_challenges SET status = $2
+	WHERE id = $1 AND status IN ($3, $4)`
+	res, err := db.Exec(query, c.Id, status, CHALLENGE_PENDING, CHALLENGE_PLAYING)
+	if err != nil {
+		log.Println("Error closing ladder challenge:", err)
+		return false
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return false
+	}
+
+	if challengerWon {
+		if err := swapLadderPositions(c); err != nil {
+			log.Println("Error swapping ladder positions:", err)
+		}
+	}
+	return true
+}
+
+// challengeGameResult decides a challenge whose game has not reported a
+// result: by the game's winner if it has one, otherwise in favour of the
+// player who connected to the game when the other did not.
+func challengeGameResult(c Challenge) bool {
+	db := database.GetDatabase()
+	query := `
+	SELECT COALESCE(winner, -1), COALESCE(black, ''), COALESCE(white, '')
+	FROM games WHERE gameid = $1`
+
+	var winner int
+	var black, white string
+	err := db.QueryRow(query, c.GameId).Scan(&winner, &black, &white)
+	if err == sql.ErrNoRows {
+		return false
+	} else if err != nil {
+		log.Println("Error fetching ladder game:", err)
+		return false
+	}
+
+	return challengerWon(c, winner, black, white)
+}
+
+// challengerWon decides a challenge by its game. The challenger plays black,
+// a game without a winner is won by the challenger only if the defender never
+// joined it.
+func challengerWon(c Challenge, winner int, black string, white string) bool {
+	switch winner {
+	case core.BlackCell:
+		return true
+	case core.WhiteCell:
+		return false
+	}
+	return black == c.Challenger && white != c.Defender
+}
+
+// expired tells whether the challenge has waited longer than timeout, for the
+// defender to answer or for its game to finish.
+func (c *Challenge) expired(timeout time.Duration, now time.Time) bool {
+	switch c.Status {
+	case CHALLENGE_PENDING:
+		return now.Sub(c.CreatedAt) > timeout
+	case CHALLENGE_PLAYING:
+		return now.Sub(c.AcceptedAt) > timeout
+	}
+	return false
+}
+
+// expireChallenges forfeits the challenges the defender has not answered in
+// time, the challenger then moves up as if the game had been won. Accepted
+// challenges whose game has not finished in the same time are closed too.
+func expireChallenges(l Ladder) {
+	challenges, err := getOpenChallenges(l.Id)
+	if err != nil {
+		log.Println("Error fetching ladder challenges:", err)
+		return
+	}
+
+	timeout := time.Duration(l.Timeout) * time.Hour
+	now := time.Now()
+	for _, c := range challenges {
+		if !c.expired(timeout, now) {
+			continue
+		}
+		if c.Status == CHALLENGE_PENDING {
+			closeChallenge(c, CHALLENGE_EXPIRED, true)
+		} else {
+			closeChallenge(c, CHALLENGE_EXPIRED, challengeGameResult(c))
+		}
+	}
+}
+
+// RunChallengeExpiry expires the challenges of all ladders, so that open
+// challenges do not wait for someone to look at their ladder.
+func RunChallengeExpiry() {
+	for {
+		expireAllChallenges()
+		time.Sleep(CHALLENGE_EXPIRY_CHECK)
+	}
+}
+
+func expireAllChallenges() {
+	db := database.GetDatabase()
+	query := `
+	SELECT DISTINCT ladderid FROM ladder_challenges
+	WHERE status IN ($1, $2)`
+
+	rows, err := db.Query(query, CHALLENGE_PENDING, CHALLENGE_PLAYING)
+	if err != nil {
+		log.Println("Error fetching ladders with open challenges:", err)
+		return
+	}
+
+	var ladderIds []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			log.Println("Error reading ladder id:", err)
+			continue
+		}
+		ladderIds = append(ladderIds, id)
+	}
+	rows.Close()
+
+	for _, id := range ladderIds {
+		l, err := getLadder(id)
+		if err != nil {
+			log.Println("Error fetching ladder:", err)
+			continue
+		}
+		expireChallenges(l)
+	}
+}
+
+// RecordLadderResult is the game over hook that applies the results of
+// ladder challenge games.
+func RecordLadderResult(result core.GameResult) {
+	db := database.GetDatabase()
+	query := `
+	SELECT id, ladderid, challenger, defender, gameid, status, created_at,
+	COALESCE(accepted_at, created_at)
+	FROM ladder_challenges WHERE gameid = $1 AND status = $2`
+
+	var c Challenge
+	if err := db.QueryRow(query, result.GameId, CHALLENGE_PLAYING).Scan(
+		&c.Id, &c.LadderId, &c.Challenger, &c.Defender, &c.GameId,
+		&c.Status, &c.CreatedAt, &c.AcceptedAt,
+	); err != nil {
+		// not a ladder game
+		return
+	}
+
+	winner := result.White
+	if result.Winner == core.BlackCell {
+		winner = result.Black
+	}
+	closeChallenge(c, CHALLENGE_DONE, winner == c.Challenger)
+}
+
+func CreateLadder(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	var l Ladder
+	if err := ctx.ShouldBindJSON(&l); err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := l.GameSettings.Validate(); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if l.MaxChallenge <= 0 {
+		l.MaxChallenge = DEFAULT_MAX_CHALLENGE
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = DEFAULT_CHALLENGE_TIMEOUT
+	}
+
+	l.Id = core.GetUniqueId()
+	l.CreatedBy = username
+
+	db := database.GetDatabase()
+	insertQuery := `
+	INSERT INTO ladders
+	(id, name, maxchallenge, timeout, createdby, size, maintime)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := db.Exec(
+		insertQuery, l.Id, l.Name, l.MaxChallenge, l.Timeout, l.CreatedBy,
+		l.Size, l.MainTime,
+	); err != nil {
+		log.Println("Error creating ladder:", err)
+		ctx.JSON(500, gin.H{"error": "Error creating ladder"})
+		return
+	}
+
+	ctx.JSON(200, l)
+}
+
+func GetLadder(ctx *gin.Context) {
+	l, err := getLadder(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Ladder not found"})
+		return
+	}
+
+	expireChallenges(l)
+
+	players, err := getLadderPlayers(l.Id)
+	if err != nil {
+		log.Println("Error fetching ladder players:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	challenges, err := getOpenChallenges(l.Id)
+	if err != nil {
+		log.Println("Error fetching ladder challenges:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"ladder":     l,
+		"players":    players,
+		"challenges": challenges,
+	})
+}
+
+func JoinLadder(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	l, err := getLadder(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Ladder not found"})
+		return
+	}
+
+	if _, err := getLadderPosition(l.Id, username); err == nil {
+		ctx.JSON(400, gin.H{"error": "Already on the ladder"})
+		return
+	}
+
+	// new players start at the bottom of the ladder
+	db := database.GetDatabase()
+	insertQuery := `
+	INSERT INTO ladder_players (ladderid, username, position)
+	SELECT $1, $2, COALESCE(MAX(position), 0) + 1
+	FROM ladder_players WHERE ladderid = $1`
+	if _, err := db.Exec(insertQuery, l.Id, username); err != nil {
+		log.Println("Error joining ladder:", err)
+		ctx.JSON(500, gin.H{"error": "Error joining ladder"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"message": "Joined successfully"})
+}
+
+type challengeReq struct {
+	Defender string `json:"defender"`
+}
+
+func CreateChallenge(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	var req challengeReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	l, err := getLadder(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Ladder not found"})
+		return
+	}
+
+	expireChallenges(l)
+
+	challengerPos, err := getLadderPosition(l.Id, username)
+	if err != nil {
+		ctx.JSON(403, gin.H{"error": "Join the ladder first"})
+		return
+	}
+	defenderPos, err := getLadderPosition(l.Id, req.Defender)
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Defender is not on the ladder"})
+		return
+	}
+
+	if !l.inRange(challengerPos, defenderPos) {
+		ctx.JSON(400, gin.H{"error": "Defender is out of challenge range"})
+		return
+	}
+
+	c := Challenge{
+		Id:         core.GetUniqueId(),
+		LadderId:   l.Id,
+		Challenger: username,
+		Defender:   req.Defender,
+		Status:     CHALLENGE_PENDING,
+		CreatedAt:  time.Now(),
+	}
+
+	ok, err := insertChallenge(c)
+	if err != nil {
+		log.Println("Error creating ladder challenge:", err)
+		ctx.JSON(500, gin.H{"error": "Error creating challenge"})
+		return
+	}
+	if !ok {
+		ctx.JSON(409, gin.H{"error": "Player already has an open challenge"})
+		return
+	}
+
+	ctx.JSON(200, c)
+}
+
+// AnswerChallenge lets the defender accept a challenge, which starts the
+// game with the ladder's settings, or decline it, which forfeits the
+// challenge.
+func AnswerChallenge(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	c, err := getChallenge(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Challenge not found"})
+		return
+	}
+	if c.Defender != username {
+		ctx.JSON(403, gin.H{"error": "Challenge is for another player"})
+		return
+	}
+	if c.Status != CHALLENGE_PENDING {
+		ctx.JSON(400, gin.H{"error": "Challenge is not pending"})
+		return
+	}
+
+	l, err := getLadder(c.LadderId)
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Ladder not found"})
+		return
+	}
+
+	if time.Since(c.CreatedAt) > time.Duration(l.Timeout)*time.Hour {
+		closeChallenge(c, CHALLENGE_EXPIRED, true)
+		ctx.JSON(400, gin.H{"error": "Challenge has expired"})
+		return
+	}
+
+	if ctx.Query("action") == "decline" {
+		closeChallenge(c, CHALLENGE_DECLINED, true)
+		ctx.JSON(200, gin.H{"message": "Challenge declined"})
+		return
+	}
+
+	c.GameId = core.GetUniqueId()
+	db := database.GetDatabase()
+	updateQuery := `
+	UPDATE ladder_challenges SET status = $2, gameid = $3, accepted_at = NOW()
+	WHERE id = $1 AND status = $4`
+	res, err := db.Exec(
+		updateQuery, c.Id, CHALLENGE_PLAYING, c.GameId, CHALLENGE_PENDING,
+	)
+	if err != nil {
+		log.Println("Error accepting ladder challenge:", err)
+		ctx.JSON(500, gin.H{"error": "Error accepting challenge"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		ctx.JSON(409, gin.H{"error": "Challenge is not pending"})
+		return
+	}
+
+	// the challenger is the lower placed player and takes black
+	RegisterGame(c.GameId, c.Challenger, c.Defender, l.GameSettings)
+
+	ctx.JSON(200, gin.H{
+		"wsurl":  instance.GameUrl(c.GameId),
+		"gameId": c.GameId,
+	})
+}
+
+// GetChallenges lists the open challenges of the player on all ladders, so
+// the challenger learns the game id once the defender has accepted.
+func GetChallenges(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	db := database.GetDatabase()
+	query := `
+	SELECT id, ladderid, challenger, defender, COALESCE(gameid, ''), status,
+	created_at, COALESCE(accepted_at, created_at)
+	FROM ladder_challenges
+	WHERE (challenger = $1 OR defender = $1) AND status IN ($2, $3)
+	ORDER BY created_at`
+
+	rows, err := db.Query(query, username, CHALLENGE_PENDING, CHALLENGE_PLAYING)
+	if err != nil {
+		log.Println("Error fetching challenges:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	challenges, err := scanChallenges(rows)
+	if err != nil {
+		log.Println("Error scanning challenges:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	for i := range challenges {
+		if challenges[i].Status == CHALLENGE_PLAYING {
+			challenges[i].Wsurl = instance.GameUrl(challenges[i].GameId)
+		}
+	}
+
+	ctx.JSON(200, gin.H{
+		"wsurl":      instance.Url(),
+		"challenges": challenges,
+	})
+}
@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+)
+
+func TestLadderInRange(t *testing.T) {
+	l := Ladder{MaxChallenge: 3}
+	tests := []struct {
+		name                       string
+		challengerPos, defenderPos int
+		want                       bool
+	}{
+		{name: "one place up", challengerPos: 5, defenderPos: 4, want: true},
+		{name: "max places up", challengerPos: 5, defenderPos: 2, want: true},
+		{name: "too far up", challengerPos: 5, defenderPos: 1, want: false},
+		{name: "same place", challengerPos: 5, defenderPos: 5, want: false},
+		{name: "below", challengerPos: 5, defenderPos: 6, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := l.inRange(tt.challengerPos, tt.defenderPos)
+			if got != tt.want {
+				t.Errorf("inRange(%d, %d) = %v, want %v",
+					tt.challengerPos, tt.defenderPos, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChallengeExpired(t *testing.T) {
+	now := time.Now()
+	timeout := 24 * time.Hour
+	old, recent := now.Add(-25*time.Hour), now.Add(-time.Hour)
+	tests := []struct {
+		name string
+		c    Challenge
+		want bool
+	}{
+		{
+			name: "pending in time",
+			c:    Challenge{Status: CHALLENGE_PENDING, CreatedAt: recent},
+			want: false,
+		},
+		{
+			name: "pending too long",
+			c:    Challenge{Status: CHALLENGE_PENDING, CreatedAt: old},
+			want: true,
+		},
+		{
+			name: "playing since accepted recently",
+			c: Challenge{
+				Status: CHALLENGE_PLAYING, CreatedAt: old, AcceptedAt: recent,
+			},
+			want: false,
+		},
+		{
+			name: "playing too long",
+			c: Challenge{
+				Status: CHALLENGE_PLAYING, CreatedAt: old, AcceptedAt: old,
+			},
+			want: true,
+		},
+		{
+			name: "closed",
+			c:    Challenge{Status: CHALLENGE_EXPIRED, CreatedAt: old},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.expired(timeout, now); got != tt.want {
+				t.Errorf("expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChallengerWon(t *testing.T) {
+	c := Challenge{Challenger: "challenger", Defender: "defender"}
+	tests := []struct {
+		name         string
+		winner       int
+		black, white string
+		want         bool
+	}{
+		{
+			name: "black won", winner: core.BlackCell,
+			black: "challenger", white: "defender", want: true,
+		},
+		{
+			name: "white won", winner: core.WhiteCell,
+			black: "challenger", white: "defender", want: false,
+		},
+		{
+			name: "defender never joined", winner: -1,
+			black: "challenger", white: "", want: true,
+		},
+		{
+			name: "unfinished with both players", winner: -1,
+			black: "challenger", white: "defender", want: false,
+		},
+		{
+			name: "no game", winner: -1, want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := challengerWon(c, tt.winner, tt.black, tt.white)
+			if got != tt.want {
+				t.Errorf("challengerWon() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
+)
+
+const (
+	LEADERBOARD_CACHE_TTL  = 60 * time.Second
+	LEADERBOARD_PAGE_SIZE  = 50
+	LEADERBOARD_MAX_PAGE   = 100
+	ACTIVE_DAYS            = 30
+	SNAPSHOT_INTERVAL      = 24 * time.Hour
+	MOVERS_PERIOD          = 7 * 24 * time.Hour
+	MOVERS_DEFAULT_COUNT   = 10
+	SNAPSHOT_CHECK_TIMEOUT = time.Hour
+
+	// SNAPSHOT_LOCK is the advisory lock held while taking a snapshot, every
+	// backend checks whether one is due
+	SNAPSHOT_LOCK = 7302
+)
+
+type LeaderboardEntry struct {
+	Rank     int    `json:"rank"`
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+	Games    int    `json:"games"`
+	KyuDan   string `json:"kyuDan"`
+}
+
+type Mover struct {
+	Username     string `json:"username"`
+	Rating       int    `json:"rating"`
+	Rank         int    `json:"rank"`
+	RatingChange int    `json:"ratingChange"`
+	RankChange   int    `json:"rankChange"`
+}
+
+type leaderboardFilter struct {
+	size     int
+	category string
+	active   bool
+	all      bool
+}
+
+func parseLeaderboardFilter(ctx *gin.Context) (leaderboardFilter, error) {
+	var f leaderboardFilter
+	size, err := strconv.Atoi(ctx.DefaultQuery("size", "19"))
+	if err != nil || (size != 9 && size != 13 && size != 19) {
+		return f, fmt.Errorf("invalid board size")
+	}
+	f.size = size
+
+	f.category = ctx.DefaultQuery(
+		"category", core.SpeedCategory(core.DEFAULT_MAIN_TIME),
+	)
+	switch f.category {
+	case core.SPEED_BLITZ, core.SPEED_RAPID, core.SPEED_CLASSICAL, core.SPEED_BOT:
+	default:
+		return f, fmt.Errorf("invalid category")
+	}
+
+	f.active = ctx.Query("active") == "true"
+	f.all = ctx.Query("all") == "true"
+	return f, nil
+}
+
+// where returns the conditions shared by all leaderboard queries on the
+// table r of ratings, with the size and category as $1 and $2. Players are
+// active if they played in the ACTIVE_DAYS before at. Guests have no row in
+// users, so joining users leaves them out along with bot accounts.
+func (f leaderboardFilter) where(r string, at string) string {
+	where := fmt.Sprintf("%[1]s.size = $1 AND %[1]s.category = $2", r)
+	if !f.all {
+		where += fmt.Sprintf(` AND EXISTS (
+		SELECT 1 FROM users u
+		WHERE u.username = %s.username AND NOT u.isbot)`, r)
+	}
+	if f.active {
+		where += fmt.Sprintf(` AND EXISTS (
+		SELECT 1 FROM games g
+		WHERE (g.black = %[1]s.username OR g.white = %[1]s.username)
+		AND g.created_at > %[2]s - INTERVAL '%[3]d days'
+		AND g.created_at <= %[2]s)`, r, at, ACTIVE_DAYS)
+	}
+	return where
+}
+
+func (f leaderboardFilter) cacheKey(parts ...any) string {
+	key := fmt.Sprintf(
+		"leaderboard:%d:%s:%v:%v", f.size, f.category, f.active, f.all,
+	)
+	for _, part := range parts {
+		key += fmt.Sprintf(":%v", part)
+	}
+	return key
+}
+
+func getCached(key string, v any) bool {
+	jsondata, err := pubsub.Rdb.Get(pubsub.RdbCtx, key).Result()
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal([]byte(jsondata), v) == nil
+}
+
+func setCached(key string, v any) {
+	jsondata, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Error marshalling leaderboard for cache:", err)
+		return
+	}
+
+	err = pubsub.Rdb.Set(
+		pubsub.RdbCtx, key, jsondata, LEADERBOARD_CACHE_TTL,
+	).Err()
+	if err != nil {
+		log.Println("Error caching leaderboard:", err)
+	}
+}
+
+func getLeaderboard(
+	f leaderboardFilter, page int, limit int,
+) ([]LeaderboardEntry, error) {
+	db := database.GetDatabase()
+	query := fmt.Sprintf(`
+	SELECT username, rating, games, rank FROM (
+		SELECT r.username, r.rating, r.games,
+		RANK() OVER (ORDER BY r.rating DESC) AS rank
+		FROM ratings r
+		WHERE %s
+	) ranked
+	ORDER BY rating DESC, games DESC, username
+	LIMIT $3 OFFSET $4`, f.where("r", "NOW()"))
+
+	entries := []LeaderboardEntry{}
+	offset := (page - 1) * limit
+	rows, err := db.Query(query, f.size, f.category, limit, offset)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e LeaderboardEntry
+		if err := rows.Scan(
+			&e.Username, &e.Rating, &e.Games, &e.Rank,
+		); err != nil {
+			return entries, err
+		}
+		e.KyuDan = core.RankString(e.Rating, e.Games < core.PROVISIONAL_GAMES)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func Leaderboard(ctx *gin.Context) {
+	f, err := parseLeaderboardFilter(ctx)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 || page > LEADERBOARD_MAX_PAGE {
+		ctx.JSON(400, gin.H{"error": "Invalid page"})
+		return
+	}
+	limit, err := strconv.Atoi(
+		ctx.DefaultQuery("limit", strconv.Itoa(LEADERBOARD_PAGE_SIZE)),
+	)
+	if err != nil || limit < 1 || limit > LEADERBOARD_PAGE_SIZE {
+		ctx.JSON(400, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	var entries []LeaderboardEntry
+	key := f.cacheKey(page, limit)
+	if !getCached(key, &entries) {
+		entries, err = getLeaderboard(f, page, limit)
+		if err != nil {
+			log.Println("Error fetching leaderboard:", err)
+			ctx.JSON(500, gin.H{"error": "Server error"})
+			return
+		}
+		setCached(key, entries)
+	}
+
+	ctx.JSON(200, gin.H{
+		"size":     f.size,
+		"category": f.category,
+		"page":     page,
+		"entries":  entries,
+	})
+}
+
+// LeaderboardRank returns the position of a player on the leaderboard of a
+// category, with the same filters as Leaderboard.
+func LeaderboardRank(ctx *gin.Context) {
+	f, err := parseLeaderboardFilter(ctx)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	username := ctx.Query("username")
+
+	info := core.GetRatingInfo(username, f.size, f.category)
+	if info.Games == 0 {
+		ctx.JSON(404, gin.H{"error": "Player has no rating in this category"})
+		return
+	}
+
+	// a player the filters leave out has no place on the leaderboard
+	db := database.GetDatabase()
+	query := fmt.Sprintf(`
+	SELECT (SELECT COUNT(*) FROM ratings o WHERE %s AND o.rating > r.rating)
+	FROM ratings r
+	WHERE %s AND r.username = $3`,
+		f.where("o", "NOW()"), f.where("r", "NOW()"),
+	)
+
+	var higher int
+	err = db.QueryRow(query, f.size, f.category, username).Scan(&higher)
+	if err == sql.ErrNoRows {
+		ctx.JSON(404, gin.H{"error": "Player is not on this leaderboard"})
+		return
+	} else if err != nil {
+		log.Println("Error fetching leaderboard rank:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"username": username,
+		"rank":     higher + 1,
+		"rating":   info.Rating,
+		"kyuDan":   info.Rank,
+	})
+}
+
+// LeaderboardMovers compares the current ratings with the snapshot taken a
+// week ago and returns the players who gained the most. Both are ranked the
+// way Leaderboard ranks, with the same filters.
+func LeaderboardMovers(ctx *gin.Context) {
+	f, err := parseLeaderboardFilter(ctx)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	movers := []Mover{}
+	key := f.cacheKey("movers")
+	if getCached(key, &movers) {
+		ctx.JSON(200, movers)
+		return
+	}
+
+	db := database.GetDatabase()
+	query := fmt.Sprintf(`
+	WITH current AS (
+		SELECT r.username, r.rating,
+		RANK() OVER (ORDER BY r.rating DESC) AS rank
+		FROM ratings r
+		WHERE %s
+	), previous AS (
+		SELECT s.username, s.rating,
+		RANK() OVER (ORDER BY s.rating DESC) AS rank
+		FROM leaderboard_snapshots s
+		WHERE %s AND s.taken_at = (
+			SELECT MAX(taken_at) FROM leaderboard_snapshots
+			WHERE size = $1 AND category = $2 AND taken_at <= $3
+		)
+	)
+	SELECT c.username, c.rating, c.rank,
+	c.rating - p.rating AS rating_change, p.rank - c.rank AS rank_change
+	FROM current c JOIN previous p ON p.username = c.username
+	ORDER BY rating_change DESC
+	LIMIT $4`, f.where("r", "NOW()"), f.where("s", "s.taken_at"))
+
+	rows, err := db.Query(
+		query, f.size, f.category, time.Now().Add(-MOVERS_PERIOD),
+		MOVERS_DEFAULT_COUNT,
+	)
+	if err != nil {
+		log.Println("Error fetching leaderboard movers:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Mover
+		if err := rows.Scan(
+			&m.Username, &m.Rating, &m.Rank, &m.RatingChange, &m.RankChange,
+		); err != nil {
+			log.Println("Error scanning leaderboard movers:", err)
+			continue
+		}
+		movers = append(movers, m)
+	}
+
+	setCached(key, movers)
+	ctx.JSON(200, movers)
+}
+
+// takeLeaderboardSnapshot takes a snapshot once SNAPSHOT_INTERVAL has passed
+// since the last one. The check and the copy are made under SNAPSHOT_LOCK,
+// so backends checking at once take a single snapshot.
+func takeLeaderboardSnapshot() error {
+	db := database.GetDatabase()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"SELECT pg_advisory_xact_lock($1)", SNAPSHOT_LOCK,
+	); err != nil {
+		return err
+	}
+
+	var last time.Time
+	query := "SELECT COALESCE(MAX(taken_at), 'epoch') FROM leaderboard_snapshots"
+	if err := tx.QueryRow(query).Scan(&last); err != nil {
+		return err
+	}
+	if time.Since(last) < SNAPSHOT_INTERVAL {
+		return nil
+	}
+
+	// ranks depend on the filters and are computed when the snapshot is
+	// compared
+	insertQuery := `
+	INSERT INTO leaderboard_snapshots
+	(taken_at, size, category, username, rating)
+	SELECT NOW(), size, category, username, rating
+	FROM ratings`
+	if _, err := tx.Exec(insertQuery); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RunLeaderboardSnapshots stores a daily copy of every leaderboard, which
+// LeaderboardMovers compares the current ratings against.
+func RunLeaderboardSnapshots() {
+	for {
+		if err := takeLeaderboardSnapshot(); err != nil {
+			log.Println("Error taking leaderboard snapshot:", err)
+		}
+		time.Sleep(SNAPSHOT_CHECK_TIMEOUT)
+	}
+}
@@ -0,0 +1,263 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
+)
+
+const (
+	LIVE_GAMES_HASH    = "live_games"
+	LIVE_GAMES_CHANNEL = "live_games"
+	SPECTATORS_HASH    = "game_spectators"
+	LIVE_GAMES_LIMIT   = 50
+
+	SORT_RATING = "rating"
+	SORT_NEWEST = "newest"
+)
+
+// LiveGame is an entry of the live games index. The index is kept apart
+// from live_game, which also holds the players' entries, and only stores
+// what is known when the game starts. Moves and Spectators are filled in
+// when the index is read.
+type LiveGame struct {
+	GameId      string    `json:"gameId"`
+	Black       string    `json:"black"`
+	White       string    `json:"white"`
+	BlackRating int       `json:"blackRating"`
+	WhiteRating int       `json:"whiteRating"`
+	StartedAt   time.Time `json:"startedAt"`
+	Moves       int       `json:"moves"`
+	Spectators  int       `json:"spectators"`
+	core.GameSettings
+}
+
+// LiveGameEvent is sent on the live games feed, Game is set for
+// gameStarted and GameId for gameEnded.
+type LiveGameEvent struct {
+	Type   string    `json:"type"`
+	Game   *LiveGame `json:"game,omitempty"`
+	GameId string    `json:"gameId,omitempty"`
+}
+
+func (lg LiveGame) rating() int {
+	return (lg.BlackRating + lg.WhiteRating) / 2
+}
+
+// listGame adds a game that has just been set up to the index.
+func listGame(gdr core.GameDataRedis) {
+	category := core.SpeedCategory(gdr.MainTime)
+	lg := LiveGame{
+		GameId:       gdr.Id,
+		Black:        gdr.Black,
+		White:        gdr.White,
+		BlackRating:  core.GetRating(gdr.Black, gdr.Size, category),
+		WhiteRating:  core.GetRating(gdr.White, gdr.Size, category),
+		StartedAt:    time.Now(),
+		GameSettings: gdr.GameSettings,
+	}
+
+	jsondata, err := json.Marshal(lg)
+	if err != nil {
+		log.Println("Error marshalling live game:", err)
+		return
+	}
+
+	err = pubsub.Rdb.HSet(
+		pubsub.RdbCtx, LIVE_GAMES_HASH, lg.GameId, jsondata,
+	).Err()
+	if err != nil {
+		log.Println("Error adding live game:", err)
+		return
+	}
+	publishJSON(
+		LIVE_GAMES_CHANNEL, LiveGameEvent{Type: "gameStarted", Game: &lg},
+	)
+}
+
+// unlistGame removes a game from the index. Both players' servers remove
+// it, only the first one announces it.
+func unlistGame(gameId string) {
+	removed, err := pubsub.Rdb.HDel(
+		pubsub.RdbCtx, LIVE_GAMES_HASH, gameId,
+	).Result()
+	if err != nil {
+		log.Println("Error removing live game:", err)
+		return
+	}
+
+	if removed > 0 {
+		publishJSON(
+			LIVE_GAMES_CHANNEL, LiveGameEvent{Type: "gameEnded", GameId: gameId},
+		)
+	}
+}
+
+// UnlistFinishedGame is a game over hook that removes the game from the
+// live games index.
+func UnlistFinishedGame(result core.GameResult) {
+	unlistGame(result.GameId)
+}
+
+// UnlistAdjournedGame is a game adjourned hook, the game comes back on the
+// index when it is resumed.
+func UnlistAdjournedGame(gameId string) {
+	unlistGame(gameId)
+}
+
+func getLiveGames() ([]LiveGame, error) {
+	entries, err := pubsub.Rdb.HGetAll(pubsub.RdbCtx, LIVE_GAMES_HASH).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	games := []LiveGame{}
+	ids := []string{}
+	for _, jsondata := range entries {
+		var lg LiveGame
+		if err := json.Unmarshal([]byte(jsondata), &lg); err != nil {
+			log.Println("Error unmarshalling live game:", err)
+			continue
+		}
+		games = append(games, lg)
+		ids = append(ids, lg.GameId)
+	}
+	if len(games) == 0 {
+		return games, nil
+	}
+
+	gameData, err := pubsub.Rdb.HMGet(
+		pubsub.RdbCtx, "live_game", ids...,
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+	spectators, err := pubsub.Rdb.HMGet(
+		pubsub.RdbCtx, SPECTATORS_HASH, ids...,
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	live := []LiveGame{}
+	for i, lg := range games {
+		jsondata, ok := gameData[i].(string)
+		if !ok {
+			// the game has expired without ending, as when both players
+			// left, so it has no game over to unlist it
+			unlistGame(lg.GameId)
+			continue
+		}
+
+		var gdr core.GameDataRedis
+		if err := json.Unmarshal([]byte(jsondata), &gdr); err != nil {
+			log.Println("Error unmarshalling game data:", err)
+			continue
+		}
+		lg.Moves = len(gdr.History)
+
+		if count, ok := spectators[i].(string); ok {
+			lg.Spectators, _ = strconv.Atoi(count)
+		}
+		live = append(live, lg)
+	}
+	return live, nil
+}
+
+// LiveGames lists the games being played, highest rated first or, with
+// sort=newest, the latest first. size filters on the board size.
+func LiveGames(ctx *gin.Context) {
+	order := ctx.DefaultQuery("sort", SORT_RATING)
+	if order != SORT_RATING && order != SORT_NEWEST {
+		ctx.JSON(400, gin.H{"error": "Invalid sort"})
+		return
+	}
+
+	size := 0
+	if s := ctx.Query("size"); s != "" {
+		var err error
+		size, err = strconv.Atoi(s)
+		if err != nil || (size != 9 && size != 13 && size != 19) {
+			ctx.JSON(400, gin.H{"error": "Invalid board size"})
+			return
+		}
+	}
+
+	limit, err := strconv.Atoi(
+		ctx.DefaultQuery("limit", strconv.Itoa(LIVE_GAMES_LIMIT)),
+	)
+	if err != nil || limit < 1 || limit > LIVE_GAMES_LIMIT {
+		ctx.JSON(400, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	games, err := getLiveGames()
+	if err != nil {
+		log.Println("Error fetching live games:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"games": selectLiveGames(games, order, size, limit)})
+}
+
+// selectLiveGames keeps the games of the board size, any size if it is 0,
+// in the given order and at most limit of them.
+func selectLiveGames(
+	games []LiveGame, order string, size int, limit int,
+) []LiveGame {
+	if size != 0 {
+		filtered := []LiveGame{}
+		for _, lg := range games {
+			if lg.Size == size {
+				filtered = append(filtered, lg)
+			}
+		}
+		games = filtered
+	}
+
+	sort.Slice(games, func(i, j int) bool {
+		if order == SORT_NEWEST || games[i].rating() == games[j].rating() {
+			return games[i].StartedAt.After(games[j].StartedAt)
+		}
+		return games[i].rating() > games[j].rating()
+	})
+	if len(games) > limit {
+		games = games[:limit]
+	}
+	return games
+}
+
+// LiveGamesFeed streams gameStarted and gameEnded events.
+func LiveGamesFeed(ctx *gin.Context) {
+	w, r := ctx.Writer, ctx.Request
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("LiveGamesFeed:", err)
+		return
+	}
+	defer c.Close()
+
+	ps := pubsub.Rdb.Subscribe(pubsub.RdbCtx, LIVE_GAMES_CHANNEL)
+	defer ps.Close()
+
+	if _, err := ps.Receive(pubsub.RdbCtx); err != nil {
+		log.Println("Subscription to live games channel failed")
+		return
+	}
+
+	go lobbyFeed(c, ps)
+
+	// the client does not send anything, reading only detects when it leaves
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
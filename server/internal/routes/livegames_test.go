@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+)
+
+func liveGame(id string, rating int, size int, startedAt time.Time) LiveGame {
+	return LiveGame{
+		GameId:       id,
+		BlackRating:  rating,
+		WhiteRating:  rating,
+		StartedAt:    startedAt,
+		GameSettings: core.GameSettings{Size: size},
+	}
+}
+
+func gameIds(games []LiveGame) []string {
+	ids := []string{}
+	for _, lg := range games {
+		ids = append(ids, lg.GameId)
+	}
+	return ids
+}
+
+func TestLiveGameRating(t *testing.T) {
+	lg := LiveGame{BlackRating: 1500, WhiteRating: 1700}
+	if got := lg.rating(); got != 1600 {
+		t.Errorf("rating() = %d, want 1600", got)
+	}
+}
+
+func TestSelectLiveGames(t *testing.T) {
+	now := time.Now()
+	games := func() []LiveGame {
+		return []LiveGame{
+			liveGame("old-strong", 2000, 19, now.Add(-time.Hour)),
+			liveGame("new-weak", 800, 9, now),
+			liveGame("mid", 1400, 19, now.Add(-time.Minute)),
+			liveGame("new-strong", 2000, 19, now.Add(-time.Second)),
+		}
+	}
+
+	tests := []struct {
+		name  string
+		order string
+		size  int
+		limit int
+		want  []string
+	}{
+		{
+			name: "highest rated, newest among equals", order: SORT_RATING,
+			limit: LIVE_GAMES_LIMIT,
+			want:  []string{"new-strong", "old-strong", "mid", "new-weak"},
+		},
+		{
+			name: "newest", order: SORT_NEWEST, limit: LIVE_GAMES_LIMIT,
+			want: []string{"new-weak", "new-strong", "mid", "old-strong"},
+		},
+		{
+			name: "board size", order: SORT_NEWEST, size: 19,
+			limit: LIVE_GAMES_LIMIT,
+			want:  []string{"new-strong", "mid", "old-strong"},
+		},
+		{
+			name: "limit", order: SORT_RATING, limit: 2,
+			want: []string{"new-strong", "old-strong"},
+		},
+		{
+			name: "no game of the size", order: SORT_RATING, size: 13,
+			limit: LIVE_GAMES_LIMIT, want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gameIds(selectLiveGames(games(), tt.order, tt.size, tt.limit))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// invalid queries are refused before the index is read
+func TestLiveGamesInvalidQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, query := range []string{
+		"sort=oldest", "size=10", "size=x", "limit=0",
+		"limit=" + strconv.Itoa(LIVE_GAMES_LIMIT+1),
+	} {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/livegames?"+query, nil)
+
+		LiveGames(ctx)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d",
+				query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -22,6 +22,7 @@ const (
 	TOKEN_TYPE_JWT   = "1"
 	TOKEN_TYPE_OAUTH = "2"
 	TOKEN_TYPE_GUEST = "3"
+	TOKEN_TYPE_BOT   = "4"
 )
 
 type loginData struct {
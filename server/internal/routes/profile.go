@@ -3,25 +3,33 @@ package routes
 import (
 	"database/sql"
 	"github.com/gin-gonic/gin"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
 	"github.com/vanshjangir/rapid-go/server/internal/database"
 	"log"
 )
 
 type RecentGame struct {
-	GameId    string `json:"gameid"`
-	Opponent  string `json:"opponent"`
-	Result    string `json:"result"`
-	CreatedAt string `json:"created_at"`
+	GameId     string `json:"gameid"`
+	Opponent   string `json:"opponent"`
+	Result     string `json:"result"`
+	AgainstBot bool   `json:"againstBot"`
+	CreatedAt  string `json:"created_at"`
 }
 
 type UserProfileData struct {
-	Name          string       `json:"name"`
-	Rating        int          `json:"rating"`
-	GamesPlayed   int          `json:"gamesPlayed"`
-	Wins          int          `json:"wins"`
-	Losses        int          `json:"losses"`
-	HighestRating int          `json:"highestRating"`
-	RecentGames   []RecentGame `json:"recentGames"`
+	Name          string        `json:"name"`
+	Rating        int           `json:"rating"`
+	GamesPlayed   int           `json:"gamesPlayed"`
+	Wins          int           `json:"wins"`
+	Losses        int           `json:"losses"`
+	HighestRating int           `json:"highestRating"`
+	BotGames      int           `json:"botGamesPlayed"`
+	BotWins       int           `json:"botWins"`
+	BotLosses     int           `json:"botLosses"`
+	Provisional   bool          `json:"provisional"`
+	Rank          string        `json:"rank"`
+	Ratings       []core.Rating `json:"ratings"`
+	RecentGames   []RecentGame  `json:"recentGames"`
 }
 
 func Profile(ctx *gin.Context) {
@@ -32,18 +40,42 @@ func Profile(ctx *gin.Context) {
 	var data UserProfileData
 	data.Name = username
 
+	// rating and highestRating are those of the default category, every
+	// category is listed in ratings. Games against bots are counted apart,
+	// older ones are only marked by the bot playing white.
 	query = `
+	WITH played AS (
+		SELECT
+		(white = $1 AND winner = 0) OR (black = $1 AND winner = 1) AS won,
+		COALESCE(category = $4, false) OR white = 'bot' AS against_bot
+		FROM games WHERE white = $1 OR black = $1
+	)
 	SELECT
-	(SELECT rating FROM users WHERE username = $1) AS user_rating,
-	(SELECT highestrating FROM users WHERE username = $1) AS highest_rating,
-	(SELECT COUNT(*) FROM games WHERE (white = $1 AND winner = 0)
-	OR
-	(black = $1 AND winner = 1)) AS games_won,
-	(SELECT COUNT(*) FROM games WHERE white = $1 OR black = $1) AS games_played;
+	COALESCE(
+		(SELECT rating FROM ratings
+		WHERE username = $1 AND size = $2 AND category = $3),
+		(SELECT rating FROM users WHERE username = $1)
+	) AS user_rating,
+	COALESCE(
+		(SELECT peak FROM ratings
+		WHERE username = $1 AND size = $2 AND category = $3),
+		(SELECT highestrating FROM users WHERE username = $1)
+	) AS highest_rating,
+	(SELECT COUNT(*) FROM played WHERE won AND NOT against_bot) AS games_won,
+	(SELECT COUNT(*) FROM played WHERE NOT against_bot) AS games_played,
+	(SELECT COUNT(*) FROM played WHERE won AND against_bot) AS bot_won,
+	(SELECT COUNT(*) FROM played WHERE against_bot) AS bot_played;
 	`
 
-	if err := db.QueryRow(query, username).Scan(
+	if err := db.QueryRow(
+		query,
+		username,
+		core.DEFAULT_BOARD_SIZE,
+		core.SpeedCategory(core.DEFAULT_MAIN_TIME),
+		core.SPEED_BOT,
+	).Scan(
 		&data.Rating, &data.HighestRating, &data.Wins, &data.GamesPlayed,
+		&data.BotWins, &data.BotGames,
 	); err == sql.ErrNoRows {
 		log.Println("Error fetching games won")
 		ctx.JSON(400, gin.H{"error": "username not found"})
@@ -51,16 +83,32 @@ func Profile(ctx *gin.Context) {
 	}
 
 	data.Losses = data.GamesPlayed - data.Wins
+	data.BotLosses = data.BotGames - data.BotWins
+
+	if ratings, err := core.GetRatings(username); err != nil {
+		log.Println("Error fetching ratings:", err)
+	} else {
+		data.Ratings = ratings
+	}
+
+	defaultRating := core.GetRatingInfo(
+		username,
+		core.DEFAULT_BOARD_SIZE,
+		core.SpeedCategory(core.DEFAULT_MAIN_TIME),
+	)
+	data.Provisional = defaultRating.Provisional
+	data.Rank = core.RankString(data.Rating, data.Provisional)
 
 	query = `
-	SELECT gameid, white, black, winner, created_at
+	SELECT gameid, white, black, winner, created_at,
+	COALESCE(category = $2, false) OR white = 'bot'
 	FROM
 	games
 	WHERE (black = $1 OR white = $1)
 	AND winner IS NOT NULL
 	ORDER BY created_at DESC LIMIT 10`
 
-	if rows, err := db.Query(query, username); err != nil {
+	if rows, err := db.Query(query, username, core.SPEED_BOT); err != nil {
 		log.Println("Error fetching recent games:", err)
 		ctx.JSON(400, gin.H{"error": "username not found"})
 		return
@@ -72,7 +120,7 @@ func Profile(ctx *gin.Context) {
 			var winner int
 			rows.Scan(
 				&recentGame.GameId, &white, &black, &winner,
-				&recentGame.CreatedAt,
+				&recentGame.CreatedAt, &recentGame.AgainstBot,
 			)
 
 			if white == username {
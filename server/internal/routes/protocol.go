@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/vanshjangir/rapid-go/server/internal/protocol"
+)
+
+var gameUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+	Subprotocols: protocol.Subprotocols,
+}
+
+// upgradeGame upgrades a game connection, in the encoding the client asked
+// for with Sec-WebSocket-Protocol, and settles the protocol version it asked
+// for with ?v=. It returns nil when the connection could not be set up.
+func upgradeGame(ctx *gin.Context) *protocol.Conn {
+	wsc, err := gameUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		log.Println("Error upgrading game connection:", err)
+		return nil
+	}
+	wsc.SetReadLimit(protocol.MAX_MESSAGE_SIZE)
+	c := protocol.NewConn(wsc)
+
+	version, err := protocol.Negotiate(ctx.Query("v"))
+	if err != nil {
+		if protoErr, ok := err.(*protocol.Error); ok {
+			c.WriteJSON(protoErr.Frame())
+		}
+		c.Close()
+		return nil
+	}
+
+	if version > protocol.MIN_VERSION {
+		if err := c.WriteJSON(protocol.Hello(version)); err != nil {
+			log.Println("Error sending hello msg:", err)
+			c.Close()
+			return nil
+		}
+	}
+	return c
+}
@@ -2,7 +2,12 @@ package routes
 
 import (
 	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
 	"github.com/vanshjangir/rapid-go/server/internal/database"
 )
 
@@ -39,3 +44,89 @@ func Review(ctx *gin.Context) {
 		"winner": winner,
 	})
 }
+
+// ReviewAnalysis returns the engine analysis of a finished game, its status
+// is pending until the analysis job has gone through the game.
+func ReviewAnalysis(ctx *gin.Context) {
+	db := database.GetDatabase()
+	gameid := ctx.Query("gameid")
+
+	var status string
+	var moves []byte
+	query := "SELECT status, moves FROM game_analysis WHERE gameid = $1"
+
+	err := db.QueryRow(query, gameid).Scan(&status, &moves)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(404, gin.H{"error": "Analysis not found"})
+		} else {
+			ctx.JSON(500, gin.H{"error": "Server error"})
+		}
+		return
+	}
+
+	var analysis []core.MoveAnalysis
+	if err := json.Unmarshal(moves, &analysis); err != nil {
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"status": status,
+		"moves":  analysis,
+	})
+}
+
+type SpectatorChatEntry struct {
+	Username  string    `json:"username"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ReviewSpectatorChat returns what the spectators said during a game. It is
+// kept from everyone until the game is over, so the players cannot read it.
+func ReviewSpectatorChat(ctx *gin.Context) {
+	db := database.GetDatabase()
+	gameid := ctx.Query("gameid")
+
+	var finished bool
+	query := "SELECT winner IS NOT NULL FROM games WHERE gameid = $1"
+	err := db.QueryRow(query, gameid).Scan(&finished)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(404, gin.H{"error": "Game not found"})
+		} else {
+			ctx.JSON(500, gin.H{"error": "Server error"})
+		}
+		return
+	}
+	if !finished {
+		ctx.JSON(403, gin.H{"error": "The game is not over"})
+		return
+	}
+
+	query = `
+	SELECT username, message, created_at FROM spectator_chat
+	WHERE gameid = $1 ORDER BY created_at`
+	rows, err := db.Query(query, gameid)
+	if err != nil {
+		log.Println("Error fetching spectator chat:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+	defer rows.Close()
+
+	chat := []SpectatorChatEntry{}
+	for rows.Next() {
+		var entry SpectatorChatEntry
+		err := rows.Scan(&entry.Username, &entry.Message, &entry.CreatedAt)
+		if err != nil {
+			log.Println("Error scanning spectator chat:", err)
+			ctx.JSON(500, gin.H{"error": "Server error"})
+			return
+		}
+		chat = append(chat, entry)
+	}
+
+	ctx.JSON(200, gin.H{"chat": chat})
+}
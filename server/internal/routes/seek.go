@@ -0,0 +1,362 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/instance"
+	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
+)
+
+const (
+	SEEK_HASH     = "seeks"
+	LOBBY_CHANNEL = "lobby"
+
+	// seeks are also withdrawn when the lobby connection they were posted
+	// from closes, the TTL removes those posted without one
+	SEEK_TTL          = 30 * time.Minute
+	SEEK_EXPIRY_CHECK = time.Minute
+)
+
+type Seek struct {
+	Id        string    `json:"id"`
+	Username  string    `json:"username"`
+	Rating    int       `json:"rating"`
+	MinRating int       `json:"minRating"`
+	MaxRating int       `json:"maxRating"`
+	CreatedAt time.Time `json:"createdAt"`
+	LobbyId   string    `json:"lobbyId,omitempty"`
+	core.GameSettings
+}
+
+type LobbyEvent struct {
+	Type   string `json:"type"`
+	Seek   Seek   `json:"seek"`
+	GameId string `json:"gameId"`
+	Black  string `json:"black"`
+	White  string `json:"white"`
+}
+
+// LobbySnapshot opens the lobby feed. Seeks created with its LobbyId are
+// withdrawn when that connection closes.
+type LobbySnapshot struct {
+	Type    string `json:"type"`
+	LobbyId string `json:"lobbyId"`
+	Seeks   []Seek `json:"seeks"`
+}
+
+func publishLobbyEvent(event LobbyEvent) {
+	jsondata, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Error marshalling lobby event:", err)
+		return
+	}
+
+	err = pubsub.Rdb.Publish(pubsub.RdbCtx, LOBBY_CHANNEL, jsondata).Err()
+	if err != nil {
+		log.Println("Error publishing lobby event:", err)
+	}
+}
+
+func (seek Seek) expired() bool {
+	return time.Since(seek.CreatedAt) > SEEK_TTL
+}
+
+// getSeeks returns the open seeks, the expired ones are removed.
+func getSeeks() ([]Seek, error) {
+	seeks := []Seek{}
+	entries, err := pubsub.Rdb.HGetAll(pubsub.RdbCtx, SEEK_HASH).Result()
+	if err != nil {
+		return seeks, err
+	}
+
+	for _, jsondata := range entries {
+		var seek Seek
+		if err := json.Unmarshal([]byte(jsondata), &seek); err != nil {
+			log.Println("Error unmarshalling seek:", err)
+			continue
+		}
+		if seek.expired() {
+			takeSeek(seek)
+			continue
+		}
+		seeks = append(seeks, seek)
+	}
+	return seeks, nil
+}
+
+func getSeek(seekId string) (Seek, error) {
+	var seek Seek
+	jsondata, err := pubsub.Rdb.HGet(pubsub.RdbCtx, SEEK_HASH, seekId).Result()
+	if err != nil {
+		return seek, err
+	}
+	if err := json.Unmarshal([]byte(jsondata), &seek); err != nil {
+		return seek, err
+	}
+	if seek.expired() {
+		takeSeek(seek)
+		return seek, redis.Nil
+	}
+	return seek, nil
+}
+
+// RunSeekExpiry removes the seeks older than SEEK_TTL, so that the lobby
+// hears about them without waiting for someone to list the seeks.
+func RunSeekExpiry() {
+	for {
+		if _, err := getSeeks(); err != nil {
+			log.Println("Error expiring seeks:", err)
+		}
+		time.Sleep(SEEK_EXPIRY_CHECK)
+	}
+}
+
+// takeSeek removes the seek from the lobby. Only the caller for which it
+// returns true may use the seek, which makes accepting a seek atomic.
+func takeSeek(seek Seek) bool {
+	removed, err := pubsub.Rdb.HDel(pubsub.RdbCtx, SEEK_HASH, seek.Id).Result()
+	if err != nil {
+		log.Println("Error removing seek:", err)
+		return false
+	}
+	if removed == 0 {
+		return false
+	}
+
+	publishLobbyEvent(LobbyEvent{Type: "seekRemoved", Seek: seek})
+	return true
+}
+
+func removeUserSeeks(username string) {
+	removeSeeks(func(seek Seek) bool { return seek.Username == username })
+}
+
+// removeLobbySeeks removes the seeks posted from a lobby connection.
+func removeLobbySeeks(username string, lobbyId string) {
+	removeSeeks(func(seek Seek) bool {
+		return seek.Username == username && seek.LobbyId == lobbyId
+	})
+}
+
+func removeSeeks(match func(Seek) bool) {
+	seeks, err := getSeeks()
+	if err != nil {
+		log.Println("Error fetching seeks:", err)
+		return
+	}
+
+	for _, seek := range seeks {
+		if match(seek) {
+			takeSeek(seek)
+		}
+	}
+}
+
+func GetSeeks(ctx *gin.Context) {
+	seeks, err := getSeeks()
+	if err != nil {
+		log.Println("Error fetching seeks:", err)
+		ctx.JSON(500, gin.H{"error": "Error fetching seeks"})
+		return
+	}
+	ctx.JSON(200, seeks)
+}
+
+func CreateSeek(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	var seek Seek
+	if err := ctx.ShouldBindJSON(&seek); err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := seek.GameSettings.Validate(); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if seek.MinRating != 0 && seek.MaxRating != 0 &&
+		seek.MinRating > seek.MaxRating {
+		ctx.JSON(400, gin.H{"error": "Minimum rating above the maximum"})
+		return
+	}
+
+	// a player has at most one open seek
+	removeUserSeeks(username)
+
+	seek.Id = core.GetUniqueId()
+	seek.Username = username
+	seek.Rating = core.GetRating(
+		username, seek.Size, core.SpeedCategory(seek.MainTime),
+	)
+	seek.CreatedAt = time.Now()
+
+	jsondata, err := json.Marshal(seek)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "Error creating seek"})
+		return
+	}
+
+	err = pubsub.Rdb.HSet(pubsub.RdbCtx, SEEK_HASH, seek.Id, jsondata).Err()
+	if err != nil {
+		log.Println("Error storing seek:", err)
+		ctx.JSON(500, gin.H{"error": "Error creating seek"})
+		return
+	}
+
+	publishLobbyEvent(LobbyEvent{Type: "seekCreated", Seek: seek})
+	ctx.JSON(200, seek)
+}
+
+func CancelSeek(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	seek, err := getSeek(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Seek not found"})
+		return
+	}
+
+	if seek.Username != username {
+		ctx.JSON(403, gin.H{"error": "Seek belongs to another player"})
+		return
+	}
+
+	takeSeek(seek)
+	ctx.JSON(200, gin.H{"message": "Seek cancelled"})
+}
+
+func AcceptSeek(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	seek, err := getSeek(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Seek not found"})
+		return
+	}
+
+	if seek.Username == username {
+		ctx.JSON(400, gin.H{"error": "Cannot accept your own seek"})
+		return
+	}
+
+	// neither player can be in two games at once
+	for _, player := range []string{seek.Username, username} {
+		if _, err := getPlayerGame(player); err == nil {
+			ctx.JSON(409, gin.H{"error": player + " is already in a game"})
+			return
+		}
+	}
+
+	rating := core.GetRating(
+		username, seek.Size, core.SpeedCategory(seek.MainTime),
+	)
+	if (seek.MinRating != 0 && rating < seek.MinRating) ||
+		(seek.MaxRating != 0 && rating > seek.MaxRating) {
+		ctx.JSON(403, gin.H{"error": "Rating outside of the seek's range"})
+		return
+	}
+
+	if ok := takeSeek(seek); !ok {
+		ctx.JSON(409, gin.H{"error": "Seek is no longer available"})
+		return
+	}
+
+	removeUserSeeks(username)
+
+	black, white := seek.Username, username
+	if rand.Intn(2) == 0 {
+		black, white = white, black
+	}
+
+	gameId := core.GetUniqueId()
+	RegisterGame(gameId, black, white, seek.GameSettings)
+
+	publishLobbyEvent(LobbyEvent{
+		Type:   "seekAccepted",
+		Seek:   seek,
+		GameId: gameId,
+		Black:  black,
+		White:  white,
+	})
+
+	ctx.JSON(200, gin.H{
+		"wsurl":  instance.GameUrl(gameId),
+		"gameId": gameId,
+	})
+}
+
+func lobbyFeed(wsc *websocket.Conn, ps *redis.PubSub) {
+	for msg := range ps.Channel() {
+		err := wsc.WriteMessage(websocket.TextMessage, []byte(msg.Payload))
+		if err != nil {
+			log.Println("Error sending lobby event:", err)
+			return
+		}
+	}
+}
+
+// Lobby streams the open seeks followed by seekCreated, seekRemoved and
+// seekAccepted events. The seeks posted with the connection's lobby id are
+// withdrawn when it closes, those of the player's other tabs stay.
+func Lobby(ctx *gin.Context) {
+	w, r := ctx.Writer, ctx.Request
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Lobby:", err)
+		return
+	}
+	defer c.Close()
+
+	ps := pubsub.Rdb.Subscribe(pubsub.RdbCtx, LOBBY_CHANNEL)
+	defer ps.Close()
+
+	if _, err := ps.Receive(pubsub.RdbCtx); err != nil {
+		log.Println("Subscription to lobby channel failed")
+		return
+	}
+
+	seeks, err := getSeeks()
+	if err != nil {
+		log.Println("Error fetching seeks:", err)
+	}
+	lobbyId := core.GetUniqueId()
+	if err := c.WriteJSON(LobbySnapshot{
+		Type: "seeks", LobbyId: lobbyId, Seeks: seeks,
+	}); err != nil {
+		log.Println("Error sending seeks:", err)
+		return
+	}
+
+	go lobbyFeed(c, ps)
+
+	// the client does not send anything, reading only detects when it leaves
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	removeLobbySeeks(username, lobbyId)
+}
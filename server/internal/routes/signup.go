@@ -3,6 +3,7 @@ package routes
 import (
 	"database/sql"
 	"github.com/gin-gonic/gin"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
 	"github.com/vanshjangir/rapid-go/server/internal/database"
 	"log"
 )
@@ -23,6 +24,11 @@ func Signup(ctx *gin.Context) {
 	}
 	log.Println("Signup attempt for email:", req.Email)
 
+	if core.IsReservedName(req.Username) {
+		ctx.JSON(400, gin.H{"error": "Username is reserved"})
+		return
+	}
+
 	var existingEmail string
 	queryEmail := "SELECT email FROM users WHERE email=$1"
 	err := db.QueryRow(queryEmail, req.Email).Scan(&existingEmail)
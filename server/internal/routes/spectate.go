@@ -2,58 +2,524 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
 	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/protocol"
 	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
 )
 
-func spectateGame(wsc *websocket.Conn, gameId string, black string) {
-	ps := pubsub.Rdb.Subscribe(pubsub.RdbCtx, gameId)
-	defer ps.Unsubscribe(pubsub.RdbCtx, gameId)
-	defer wsc.Close()
-	defer ps.Close()
+const (
+	// spectators:<gameId> and spectators_anon:<gameId> map the usernames
+	// watching a game to their number of connections
+	VIEWERS_PREFIX      = "spectators:"
+	ANON_VIEWERS_PREFIX = "spectators_anon:"
+	VIEWERS_TTL         = 24 * time.Hour
+	MAX_LISTED_VIEWERS  = 100
+
+	// spectator chat has its own channel, the players are not subscribed to
+	// it so they cannot be told what the spectators think of the game
+	SPECTATOR_CHAT_PREFIX = "spectatorchat:"
+
+	// how long a spectator following a player waits for their next game
+	FOLLOW_WAIT = 10 * time.Minute
+
+	// how spectateGame ends, SPECTATE_LEFT when the spectator has left
+	SPECTATE_LEFT      = 0
+	SPECTATE_OVER      = 1
+	SPECTATE_ADJOURNED = 2
+)
+
+// spectator is a connection watching a game. Both the pubsub loop and the
+// read loop write to it, so writes go through mu. The game being watched
+// changes when the spectator follows a player, the read loop gets it from
+// watching.
+type spectator struct {
+	wsc       *websocket.Conn
+	mu        sync.Mutex
+	username  string
+	anonymous bool
+	done      chan struct{}
+
+	gameMu sync.Mutex
+	gameId string
+	black  string
+	player bool
+
+	// side is the color the spectator watches from, game has every move the
+	// spectator got, including the ones still held
+	side       int
+	game       *core.Game
+	publicChat bool
+
+	// the broadcast delay of the game, moves are held until it is over
+	delayMoves   int
+	delaySeconds int
+	held         []heldMsg
+}
+
+type heldMsg struct {
+	msg  any
+	due  time.Time
+	move bool
+}
+
+func (s *spectator) send(v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wsc.WriteJSON(v)
+}
+
+func (s *spectator) sendRaw(msgBytes []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wsc.WriteMessage(websocket.TextMessage, msgBytes)
+}
+
+// watching returns the game the spectator is on and whether they play in it.
+func (s *spectator) watching() (string, bool) {
+	s.gameMu.Lock()
+	defer s.gameMu.Unlock()
+	return s.gameId, s.player
+}
+
+func (s *spectator) sendError(err error) {
+	var protoErr *protocol.Error
+	if !errors.As(err, &protoErr) {
+		protoErr = &protocol.Error{
+			Code: protocol.ERR_INVALID_MESSAGE, Message: err.Error(),
+		}
+	}
+	if err := s.send(protoErr.Frame()); err != nil {
+		log.Println("Error sending error msg:", err)
+	}
+}
+
+func (s *spectator) viewersKey() string {
+	if s.anonymous {
+		return ANON_VIEWERS_PREFIX + s.gameId
+	}
+	return VIEWERS_PREFIX + s.gameId
+}
+
+// hold sends a message of the game once the delay has passed, after the
+// ones held before it. Without a delay it is sent at once.
+func (s *spectator) hold(msg any, move bool) error {
+	switch {
+	case s.delayMoves > 0:
+		s.held = append(s.held, heldMsg{msg: msg, move: move})
+		return s.releaseMoves()
+
+	case s.delaySeconds > 0:
+		due := time.Now().Add(time.Duration(s.delaySeconds) * time.Second)
+		s.held = append(s.held, heldMsg{msg: msg, due: due, move: move})
+		return nil
+
+	default:
+		return s.send(msg)
+	}
+}
+
+// releaseMoves sends the messages held before the last delayMoves moves.
+func (s *spectator) releaseMoves() error {
+	if s.delayMoves <= 0 {
+		return nil
+	}
+	moves := 0
+	for _, h := range s.held {
+		if h.move {
+			moves++
+		}
+	}
 
-	_, err := ps.Receive(pubsub.RdbCtx)
+	n := 0
+	for n < len(s.held) && (moves > s.delayMoves || !s.held[n].move) {
+		if s.held[n].move {
+			moves--
+		}
+		n++
+	}
+	return s.release(n)
+}
+
+// releaseDue sends the messages whose delay in seconds has passed. With a
+// delay in moves the messages have no due time, releaseMoves sends them.
+func (s *spectator) releaseDue() error {
+	if s.delaySeconds <= 0 {
+		return nil
+	}
+	n := 0
+	for n < len(s.held) && !s.held[n].due.After(time.Now()) {
+		n++
+	}
+	return s.release(n)
+}
+
+func (s *spectator) release(n int) error {
+	for n > 0 {
+		if err := s.send(s.held[0].msg); err != nil {
+			return err
+		}
+		s.held = s.held[1:]
+		n--
+	}
+	return nil
+}
+
+// clocks orders the times of a move message, which are given as the
+// player's who sent it and their opponent's.
+func (s *spectator) clocks(player string, selfTime, opTime int64) (int64, int64) {
+	if player == s.black {
+		return selfTime, opTime
+	}
+	return opTime, selfTime
+}
+
+func handleSpectatorMove(s *spectator, pubsubMsg pubsub.PubsubMsg) error {
+	var moveMsg core.PubsubMoveMsg
+	if err := json.Unmarshal(pubsubMsg.Data, &moveMsg); err != nil {
+		return fmt.Errorf("Error unmarshaling move msg: %v", err)
+	}
+
+	// the game read from redis can have the move already, as it is stored
+	// before it is published, and a move missing before it means the
+	// spectator is behind
+	if played := len(s.game.History); moveMsg.MoveNo > 0 {
+		if moveMsg.MoveNo <= played {
+			return nil
+		}
+		if moveMsg.MoveNo > played+1 {
+			return resyncSpectator(s)
+		}
+	}
+
+	color := s.game.Turn
+	state, err := s.game.UpdateState(moveMsg.Move, color)
 	if err != nil {
-		log.Println("Subscription to redis channel failed")
+		return fmt.Errorf("Error playing move for spectator: %v", err)
 	}
+	if moveMsg.Move == "ps" {
+		state, _ = s.game.Board.Encode()
+	}
+	s.game.Turn = 1 - color
+
+	spectatorMove := protocol.SpectatorMoveMsg{
+		Type:     "spectatormove",
+		Move:     moveMsg.Move,
+		Color:    color,
+		Pass:     moveMsg.Move == "ps",
+		State:    state,
+		Captures: s.game.Captures,
+	}
+	spectatorMove.BlackTime, spectatorMove.WhiteTime = s.clocks(
+		pubsubMsg.Player, moveMsg.SelfTime, moveMsg.OpTime,
+	)
+	return s.hold(spectatorMove, true)
+}
 
+// handleSpectatorPause forwards pauses and adjournments, it returns true
+// once the game has been adjourned.
+func handleSpectatorPause(
+	s *spectator, pubsubMsg pubsub.PubsubMsg,
+) (bool, error) {
+	var pauseMsg core.PauseMsg
+	if err := json.Unmarshal(pubsubMsg.Data, &pauseMsg); err != nil {
+		return false, fmt.Errorf("Error unmarshaling pause msg: %v", err)
+	}
+
+	// offers and declines are between the players
+	switch pauseMsg.Action {
+	case "accept", "resumeaccept", "resumed", "rejoin":
+	default:
+		return false, nil
+	}
+
+	spectatorPause := protocol.SpectatorPauseMsg{
+		Type:   "spectatorpause",
+		Kind:   pubsubMsg.Type,
+		Action: pauseMsg.Action,
+	}
+
+	// the moves still held stay hidden, the game goes on from them when it
+	// is resumed
+	if pubsubMsg.Type == "adjourn" && pauseMsg.Action == "accept" {
+		return true, s.send(spectatorPause)
+	}
+	return false, s.hold(spectatorPause, false)
+}
+
+func handleSpectatorGameOver(s *spectator, pubsubMsg pubsub.PubsubMsg) error {
+	var gameOverMsg core.GameOverMsg
+	if err := json.Unmarshal(pubsubMsg.Data, &gameOverMsg); err != nil {
+		return fmt.Errorf("Error unmarshaling gameover msg: %v", err)
+	}
+
+	endMsg := protocol.SpectatorEndMsg{
+		Type:    "spectatorend",
+		Winner:  gameOverMsg.Winner,
+		Message: gameOverMsg.Message,
+	}
+	if s.game.IsOver() != -1 {
+		bs, ws := s.game.Board.Score()
+		endMsg.BlackScore = float64(bs)
+		endMsg.WhiteScore = float64(ws) + core.DEFAULT_KOMI
+	}
+
+	// nothing is left to hide once the game is over
+	if err := s.release(len(s.held)); err != nil {
+		return err
+	}
+	return s.send(endMsg)
+}
+
+// spectateGame forwards a game to the spectator until it is over or
+// adjourned, or the spectator has left. A game handed off to another
+// instance keeps its channel, the spectator goes on watching it.
+func spectateGame(s *spectator, ps *redis.PubSub) int {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	chatChannel := SPECTATOR_CHAT_PREFIX + s.gameId
 	ch := ps.Channel()
-	for msg := range ch {
+	for {
+		var msg *redis.Message
+		select {
+		case <-tick.C:
+			if s.delaySeconds <= 0 {
+				continue
+			}
+			if err := s.releaseDue(); err != nil {
+				log.Println("Error sending delayed msg to client:", err)
+				return SPECTATE_LEFT
+			}
+			continue
+
+		case <-s.done:
+			return SPECTATE_LEFT
+
+		case m, ok := <-ch:
+			if !ok {
+				return SPECTATE_LEFT
+			}
+			msg = m
+		}
+
+		if msg.Channel == chatChannel {
+			if err := s.sendRaw([]byte(msg.Payload)); err != nil {
+				log.Println("Error sending spectator chat to client:", err)
+				return SPECTATE_LEFT
+			}
+			continue
+		}
+
 		var pubsubMsg pubsub.PubsubMsg
 		if err := json.Unmarshal([]byte(msg.Payload), &pubsubMsg); err != nil {
 			log.Println("Error unmarshaling json in PubsubRecv", err)
-			break
+			return SPECTATE_LEFT
 		}
 
-		if pubsubMsg.Type == "move" {
-			var moveMsg core.MoveMsg
-			if err := json.Unmarshal(pubsubMsg.Data, &moveMsg); err != nil {
-				log.Println("Error unmarshaling moveMsg in PubsubRecv:", err)
-				break
-			}
+		var err error
+		switch pubsubMsg.Type {
+		case "move":
+			err = handleSpectatorMove(s, pubsubMsg)
 
-			if pubsubMsg.Player != black {
-				// if white, then swap because spectator is a Black Player
-				moveMsg.SelfTime, moveMsg.OpTime = moveMsg.OpTime, moveMsg.SelfTime
+		case "pause", "adjourn":
+			adjourned, err := handleSpectatorPause(s, pubsubMsg)
+			if err != nil {
+				log.Println("Error sending pause to spectator:", err)
+				return SPECTATE_LEFT
+			}
+			if adjourned {
+				return SPECTATE_ADJOURNED
 			}
 
-			if err := wsc.WriteJSON(moveMsg); err != nil {
-				log.Println("Error sending data from redis to client:", err)
-				break
+		case "chat":
+			if !s.publicChat {
+				continue
 			}
-		} else if pubsubMsg.Type == "gameover" {
-			if err := wsc.WriteMessage(websocket.TextMessage, pubsubMsg.Data); err != nil {
-				log.Println("Error sending data from redis to client:", err)
+			var chatMsg core.ChatMsg
+			if err := json.Unmarshal(pubsubMsg.Data, &chatMsg); err != nil {
+				log.Println("Error unmarshaling chat msg:", err)
+				continue
 			}
-			break
+			err = s.hold(protocol.SpectatorChatMsg{
+				Type:     "playerchat",
+				Username: pubsubMsg.Player,
+				Message:  chatMsg.Message,
+			}, false)
+
+		case "spectators":
+			err = s.sendRaw(pubsubMsg.Data)
+
+		case "gameover":
+			if err := handleSpectatorGameOver(s, pubsubMsg); err != nil {
+				log.Println("Error sending game over to spectator:", err)
+				return SPECTATE_LEFT
+			}
+			return SPECTATE_OVER
+		}
+
+		if err != nil {
+			log.Println("Error sending data from redis to client:", err)
+			return SPECTATE_LEFT
+		}
+	}
+}
+
+// joinGame and leaveGame count the connections of a spectator, a user
+// watching from two tabs is listed once and leaves when both are closed.
+func joinGame(s *spectator) {
+	key := s.viewersKey()
+	pipe := pubsub.Rdb.TxPipeline()
+	pipe.HIncrBy(pubsub.RdbCtx, key, s.username, 1)
+	pipe.Expire(pubsub.RdbCtx, key, VIEWERS_TTL)
+	if _, err := pipe.Exec(pubsub.RdbCtx); err != nil {
+		log.Println("Error adding spectator:", err)
+		return
+	}
+	publishSpectators(s.gameId)
+}
+
+func leaveGame(s *spectator) {
+	key := s.viewersKey()
+	count, err := pubsub.Rdb.HIncrBy(
+		pubsub.RdbCtx, key, s.username, -1,
+	).Result()
+	if err != nil {
+		log.Println("Error removing spectator:", err)
+		return
+	}
+	if count <= 0 {
+		pubsub.Rdb.HDel(pubsub.RdbCtx, key, s.username)
+	}
+	publishSpectators(s.gameId)
+}
+
+func getSpectators(gameId string) (protocol.SpectatorsMsg, error) {
+	msg := protocol.SpectatorsMsg{Type: "spectators", Viewers: []string{}}
+
+	viewers, err := pubsub.Rdb.HKeys(
+		pubsub.RdbCtx, VIEWERS_PREFIX+gameId,
+	).Result()
+	if err != nil {
+		return msg, err
+	}
+	anonymous, err := pubsub.Rdb.HLen(
+		pubsub.RdbCtx, ANON_VIEWERS_PREFIX+gameId,
+	).Result()
+	if err != nil {
+		return msg, err
+	}
+
+	msg.Count = len(viewers) + int(anonymous)
+	if len(viewers) > MAX_LISTED_VIEWERS {
+		viewers = viewers[:MAX_LISTED_VIEWERS]
+	}
+	msg.Viewers = append(msg.Viewers, viewers...)
+	return msg, nil
+}
+
+// publishSpectators sends the spectators of a game to its players and
+// spectators, and keeps the count of the live games index up to date.
+func publishSpectators(gameId string) {
+	msg, err := getSpectators(gameId)
+	if err != nil {
+		log.Println("Error getting spectators:", err)
+		return
+	}
+
+	if msg.Count > 0 {
+		pubsub.Rdb.HSet(pubsub.RdbCtx, SPECTATORS_HASH, gameId, msg.Count)
+	} else {
+		pubsub.Rdb.HDel(pubsub.RdbCtx, SPECTATORS_HASH, gameId)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("Error marshalling spectators msg:", err)
+		return
+	}
+	publishJSON(gameId, pubsub.PubsubMsg{Type: "spectators", Data: data})
+}
+
+// handleSpectatorChat keeps the message with the game and sends it to the
+// other spectators.
+func handleSpectatorChat(s *spectator, chatMsg *protocol.ChatMsg) {
+	gameId, player := s.watching()
+	if player {
+		s.sendError(&protocol.Error{
+			Code:    protocol.ERR_INVALID_MESSAGE,
+			Message: "players cannot use the spectator chat",
+		})
+		return
+	}
+
+	db := database.GetDatabase()
+	insertQuery := `
+	INSERT INTO spectator_chat (gameid, username, message, created_at)
+	VALUES ($1, $2, $3, $4)`
+	_, err := db.Exec(
+		insertQuery, gameId, s.username, chatMsg.Message, time.Now(),
+	)
+	if err != nil {
+		log.Println("Error saving spectator chat:", err)
+		return
+	}
+
+	publishJSON(SPECTATOR_CHAT_PREFIX+gameId, protocol.SpectatorChatMsg{
+		Type:     "spectatorchat",
+		Username: s.username,
+		Message:  chatMsg.Message,
+	})
+}
+
+// handleRecvSpectator reads a message of a spectator, who can only chat
+// and ask for the state of the game.
+func handleRecvSpectator(s *spectator) error {
+	_, msgBytes, err := s.wsc.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	msgType, msg, err := protocol.Decode(msgBytes)
+	if err != nil {
+		s.sendError(err)
+		return nil
+	}
+
+	switch msgType {
+	case "chat":
+		handleSpectatorChat(s, msg.(*protocol.ChatMsg))
+
+	case "reqState":
+		gameId, _ := s.watching()
+		gdr, err := getGameFromRedis(gameId)
+		if err != nil {
+			log.Println(err)
+			return nil
 		}
+		view, _, _, err := spectatorView(gdr)
+		if err != nil {
+			log.Println("Error replaying game for spectator:", err)
+			return nil
+		}
+		sendSyncStateSpectator(s, view)
+
+	default:
+		s.sendError(&protocol.Error{
+			Code:    protocol.ERR_UNKNOWN_TYPE,
+			Message: fmt.Sprintf("spectators cannot send %q", msgType),
+		})
 	}
+	return nil
 }
 
 func getGameFromRedis(gameId string) (core.GameDataRedis, error) {
@@ -75,45 +541,407 @@ func getGameFromRedis(gameId string) (core.GameDataRedis, error) {
 	}
 }
 
-func sendSyncStateSpectator(wsc *websocket.Conn, gdr core.GameDataRedis) {
-	var syncMsg core.SyncMsg
-	syncMsg.Type = "sync"
-	syncMsg.Color = core.BlackCell
-	syncMsg.GameId = gdr.Id
-	syncMsg.History = gdr.History
-	syncMsg.PName = gdr.Black
-	syncMsg.OpName = gdr.White
-	syncMsg.SelfTime = gdr.BTime
-	syncMsg.OpTime = gdr.WTime
-	syncMsg.State = gdr.State
-	syncMsg.Turn = gdr.Turn == core.BlackCell
+// spectatorView replays a game for a spectator. It returns the state the
+// spectator may see, behind by the broadcast delay of the game, the game
+// with all its moves and the moves to hold until their delay is over.
+func spectatorView(
+	gdr core.GameDataRedis,
+) (protocol.SpectatorSyncMsg, *core.Game, []heldMsg, error) {
+	var view protocol.SpectatorSyncMsg
 
-	if gdr.Turn == core.BlackCell {
-		syncMsg.SelfTime += time.Since(gdr.LastUpdated).Milliseconds()
-	} else {
-		syncMsg.OpTime += time.Since(gdr.LastUpdated).Milliseconds()
+	visible := len(gdr.History)
+	if gdr.DelayMoves > 0 {
+		visible = max(0, len(gdr.History)-gdr.DelayMoves)
+	} else if gdr.DelaySeconds > 0 {
+		shown := time.Now().Add(-time.Duration(gdr.DelaySeconds) * time.Second)
+		for visible > 0 && visible <= len(gdr.Clocks) &&
+			gdr.Clocks[visible-1].At.After(shown) {
+			visible--
+		}
 	}
+	delay := time.Duration(gdr.DelaySeconds) * time.Second
 
-	if err := wsc.WriteJSON(syncMsg); err != nil {
+	g := new(core.Game)
+	g.Player = new(core.Player)
+	g.Settings = gdr.GameSettings
+	g.InitGame()
+	if err := g.Replay(gdr.History[:visible]); err != nil {
+		return view, nil, nil, err
+	}
+	state, err := g.Board.Encode()
+	if err != nil {
+		return view, nil, nil, err
+	}
+
+	view = protocol.SpectatorSyncMsg{
+		Type:         "spectatorsync",
+		GameId:       gdr.Id,
+		Black:        gdr.Black,
+		White:        gdr.White,
+		Turn:         g.Turn,
+		State:        state,
+		History:      append([]string{}, g.History...),
+		BlackTime:    gdr.BTime,
+		WhiteTime:    gdr.WTime,
+		Paused:       gdr.Paused,
+		DelayMoves:   gdr.DelayMoves,
+		DelaySeconds: gdr.DelaySeconds,
+	}
+
+	lastUpdated := gdr.LastUpdated
+	if visible < len(gdr.History) {
+		// the clocks of the view only run with a delay in seconds, with a
+		// delay in moves the spectator does not know when the next move was
+		// played
+		view.BlackTime, view.WhiteTime = 0, 0
+		lastUpdated = time.Now()
+		if visible > 0 && visible <= len(gdr.Clocks) {
+			clock := gdr.Clocks[visible-1]
+			view.BlackTime, view.WhiteTime = clock.BTime, clock.WTime
+			if gdr.DelaySeconds > 0 {
+				lastUpdated = clock.At.Add(delay)
+			}
+		}
+	}
+
+	// clocks are frozen while the game is paused
+	if !view.Paused {
+		if view.Turn == core.BlackCell {
+			view.BlackTime += time.Since(lastUpdated).Milliseconds()
+		} else {
+			view.WhiteTime += time.Since(lastUpdated).Milliseconds()
+		}
+	}
+
+	var held []heldMsg
+	for i, move := range gdr.History[visible:] {
+		color := g.Turn
+		state, err := g.UpdateState(move, color)
+		if err != nil {
+			return view, nil, nil, err
+		}
+		if move == "ps" {
+			state, _ = g.Board.Encode()
+		}
+		g.Turn = 1 - color
+
+		moveMsg := protocol.SpectatorMoveMsg{
+			Type:     "spectatormove",
+			Move:     move,
+			Color:    color,
+			Pass:     move == "ps",
+			State:    state,
+			Captures: g.Captures,
+		}
+		played := gdr.LastUpdated
+		if n := visible + i; n < len(gdr.Clocks) {
+			moveMsg.BlackTime = gdr.Clocks[n].BTime
+			moveMsg.WhiteTime = gdr.Clocks[n].WTime
+			played = gdr.Clocks[n].At
+		}
+		h := heldMsg{msg: moveMsg, move: true}
+		if gdr.DelaySeconds > 0 {
+			h.due = played.Add(delay)
+		}
+		held = append(held, h)
+	}
+	return view, g, held, nil
+}
+
+func sendSyncStateSpectator(s *spectator, view protocol.SpectatorSyncMsg) {
+	view.Side = s.side
+	if err := s.send(view); err != nil {
 		log.Println("Error sending sync msg:", err)
 	}
 }
 
+// readSpectator runs the read loop of a spectator until they leave.
+func readSpectator(s *spectator) {
+	defer close(s.done)
+	for {
+		if err := handleRecvSpectator(s); err != nil {
+			break
+		}
+	}
+}
+
+// loadGame replays the game for the spectator, the moves they are sent
+// from then on are played on top of it.
+func loadGame(
+	s *spectator, gdr core.GameDataRedis,
+) (protocol.SpectatorSyncMsg, error) {
+	view, game, held, err := spectatorView(gdr)
+	if err != nil {
+		return view, err
+	}
+
+	s.game = game
+	s.held = held
+	s.publicChat = gdr.PublicChat
+	s.delayMoves = gdr.DelayMoves
+	s.delaySeconds = gdr.DelaySeconds
+	return view, nil
+}
+
+// resyncSpectator reads the game again from redis, when the spectator has
+// missed a move.
+func resyncSpectator(s *spectator) error {
+	gameId, _ := s.watching()
+	gdr, err := getGameFromRedis(gameId)
+	if err != nil {
+		return err
+	}
+	view, err := loadGame(s, gdr)
+	if err != nil {
+		return fmt.Errorf("Error replaying game for spectator: %v", err)
+	}
+	view.Side = s.side
+	return s.send(view)
+}
+
+// watchGame streams a game to the spectator, it returns how spectateGame
+// ended.
+func watchGame(s *spectator, gdr core.GameDataRedis) int {
+	s.gameMu.Lock()
+	s.gameId = gdr.Id
+	s.black = gdr.Black
+	s.player = s.username == gdr.Black || s.username == gdr.White
+	s.gameMu.Unlock()
+
+	// a player watching their own game does not get the spectator chat
+	channels := []string{gdr.Id}
+	if !s.player {
+		channels = append(channels, SPECTATOR_CHAT_PREFIX+gdr.Id)
+	}
+	ps := pubsub.Rdb.Subscribe(pubsub.RdbCtx, channels...)
+	defer ps.Close()
+
+	if _, err := ps.Receive(pubsub.RdbCtx); err != nil {
+		log.Println("Subscription to redis channel failed")
+		return SPECTATE_LEFT
+	}
+
+	// the game is read once subscribed, so that no move is played between
+	// the two without the spectator getting it
+	gdr, err := getGameFromRedis(gdr.Id)
+	if err != nil {
+		log.Println(err)
+		return SPECTATE_LEFT
+	}
+	view, err := loadGame(s, gdr)
+	if err != nil {
+		log.Println("Error replaying game for spectator:", err)
+		return SPECTATE_LEFT
+	}
+	sendSyncStateSpectator(s, view)
+
+	joinGame(s)
+	defer leaveGame(s)
+
+	return spectateGame(s, ps)
+}
+
+// spectatorSide reads the side query parameter, black or white, which is
+// the color to watch the game from.
+func spectatorSide(ctx *gin.Context) (int, bool) {
+	switch ctx.DefaultQuery("side", "black") {
+	case "black":
+		return core.BlackCell, true
+	case "white":
+		return core.WhiteCell, true
+	default:
+		ctx.JSON(400, gin.H{"error": "Invalid side"})
+		return 0, false
+	}
+}
+
+// newSpectator upgrades the connection of a spectator and settles the
+// protocol version it asked for with ?v=, like a game connection. With
+// anonymous=true the spectator is counted but not listed among the viewers.
+func newSpectator(ctx *gin.Context, username string, side int) *spectator {
+	c, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		log.Println("Spectate:", err)
+		return nil
+	}
+	c.SetReadLimit(protocol.MAX_MESSAGE_SIZE)
+
+	version, err := protocol.Negotiate(ctx.Query("v"))
+	if err != nil {
+		if protoErr, ok := err.(*protocol.Error); ok {
+			c.WriteJSON(protoErr.Frame())
+		}
+		c.Close()
+		return nil
+	}
+	if version > protocol.MIN_VERSION {
+		if err := c.WriteJSON(protocol.Hello(version)); err != nil {
+			log.Println("Error sending hello msg:", err)
+			c.Close()
+			return nil
+		}
+	}
+
+	return &spectator{
+		wsc:       c,
+		username:  username,
+		anonymous: ctx.Query("anonymous") == "true",
+		done:      make(chan struct{}),
+		side:      side,
+	}
+}
+
+// Spectate streams a game to a spectator.
 func Spectate(ctx *gin.Context) {
-	w, r := ctx.Writer, ctx.Request
 	gameId := ctx.Param("gameId")
+	username := getUsername(ctx)
+	if username == "" {
+		return
+	}
+	side, ok := spectatorSide(ctx)
+	if !ok {
+		return
+	}
 
-	c, err := upgrader.Upgrade(w, r, nil)
+	gdr, err := getGameFromRedis(gameId)
 	if err != nil {
-		log.Println("ConnectPlayer:", err)
+		ctx.JSON(404, gin.H{"error": "Game not found"})
 		return
 	}
 
-	gdr, err := getGameFromRedis(gameId)
+	s := newSpectator(ctx, username, side)
+	if s == nil {
+		return
+	}
+	defer s.wsc.Close()
+
+	go readSpectator(s)
+	watchGame(s, gdr)
+}
+
+// followPlayer sends the games started by a player, it ends when ps is
+// closed.
+func followPlayer(ps *redis.PubSub, player string) <-chan string {
+	started := make(chan string, 1)
+	go func() {
+		for msg := range ps.Channel() {
+			var event LiveGameEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Println("Error unmarshalling live game event:", err)
+				continue
+			}
+			if event.Type != "gameStarted" || event.Game == nil {
+				continue
+			}
+			if event.Game.Black != player && event.Game.White != player {
+				continue
+			}
+
+			// only the latest game matters
+			select {
+			case <-started:
+			default:
+			}
+			started <- event.Game.GameId
+		}
+	}()
+	return started
+}
+
+// nextGame waits for the game after finished, which may have started
+// before finished was over, as a rematch does. With no finished game any
+// game of the player is taken.
+func nextGame(
+	s *spectator, started <-chan string, finished string,
+) (core.GameDataRedis, bool) {
+	wait := time.NewTimer(FOLLOW_WAIT)
+	defer wait.Stop()
+
+	for {
+		select {
+		case gameId := <-started:
+			if gameId == finished {
+				continue
+			}
+			gdr, err := getGameFromRedis(gameId)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			return gdr, true
+
+		case <-s.done:
+			return core.GameDataRedis{}, false
+
+		case <-wait.C:
+			return core.GameDataRedis{}, false
+		}
+	}
+}
+
+// SpectateUser streams the game a player is playing, and then the games
+// they play next, until they have not started one for FOLLOW_WAIT. Games
+// against the engine are not in redis and never announce gameStarted, a
+// player who goes on to one is not followed into it.
+func SpectateUser(ctx *gin.Context) {
+	player := ctx.Param("username")
+	username := getUsername(ctx)
+	if username == "" {
+		return
+	}
+	side, ok := spectatorSide(ctx)
+	if !ok {
+		return
+	}
+
+	jsondata, err := getPlayerGame(player)
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Player is not in a game"})
+		return
+	}
+	var userHashData UserHashData
+	if err := json.Unmarshal([]byte(jsondata), &userHashData); err != nil {
+		log.Println("Error unmarshalling player game:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+	gdr, err := getGameFromRedis(userHashData.GameId)
 	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Player is not in a game"})
 		return
 	}
 
-	sendSyncStateSpectator(c, gdr)
-	go spectateGame(c, gameId, gdr.Black)
+	// subscribed before watching, so that a game started before the
+	// current one is over is not missed
+	ps := pubsub.Rdb.Subscribe(pubsub.RdbCtx, LIVE_GAMES_CHANNEL)
+	defer ps.Close()
+	if _, err := ps.Receive(pubsub.RdbCtx); err != nil {
+		log.Println("Subscription to live games channel failed")
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+	started := followPlayer(ps, player)
+
+	s := newSpectator(ctx, username, side)
+	if s == nil {
+		return
+	}
+	defer s.wsc.Close()
+
+	go readSpectator(s)
+	for {
+		end := watchGame(s, gdr)
+		if end == SPECTATE_LEFT {
+			break
+		}
+
+		// an adjourned game starts again under its id when it is resumed
+		finished := gdr.Id
+		if end == SPECTATE_ADJOURNED {
+			finished = ""
+		}
+		if gdr, ok = nextGame(s, started, finished); !ok {
+			break
+		}
+	}
 }
@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestSpectator connects a spectator to a client, which reads what the
+// spectator is sent.
+func newTestSpectator(t *testing.T) (*spectator, *websocket.Conn) {
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			c, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conns <- c
+		},
+	))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	wsc := <-conns
+	t.Cleanup(func() { wsc.Close() })
+	return &spectator{wsc: wsc, done: make(chan struct{})}, client
+}
+
+type testMsg struct {
+	N int `json:"n"`
+}
+
+// expectSent reads the messages sent to the client, in order.
+func expectSent(t *testing.T, client *websocket.Conn, want ...int) {
+	t.Helper()
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	for _, n := range want {
+		var msg testMsg
+		if err := client.ReadJSON(&msg); err != nil {
+			t.Fatalf("reading msg %d: %v", n, err)
+		}
+		if msg.N != n {
+			t.Fatalf("got msg %d, want %d", msg.N, n)
+		}
+	}
+}
+
+func expectHeld(t *testing.T, s *spectator, want int) {
+	t.Helper()
+	if len(s.held) != want {
+		t.Fatalf("%d msgs held, want %d", len(s.held), want)
+	}
+}
+
+func TestHoldWithoutDelay(t *testing.T) {
+	s, client := newTestSpectator(t)
+
+	for n := 1; n <= 3; n++ {
+		if err := s.hold(testMsg{n}, n != 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectHeld(t, s, 0)
+	expectSent(t, client, 1, 2, 3)
+}
+
+func TestHoldDelayMoves(t *testing.T) {
+	s, client := newTestSpectator(t)
+	s.delayMoves = 2
+
+	// moves 1 and 2, with a pause in between
+	s.hold(testMsg{1}, true)
+	s.hold(testMsg{2}, false)
+	s.hold(testMsg{3}, true)
+	expectHeld(t, s, 3)
+
+	// the seconds have no say in move mode
+	if err := s.releaseDue(); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, s, 3)
+
+	// the third move lets the first one out, and the pause after it
+	if err := s.hold(testMsg{4}, true); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, s, 2)
+	expectSent(t, client, 1, 2)
+
+	// a message that is not a move waits behind the moves held
+	s.hold(testMsg{5}, false)
+	expectHeld(t, s, 3)
+	s.hold(testMsg{6}, true)
+	expectHeld(t, s, 3)
+	expectSent(t, client, 3)
+
+	if err := s.release(len(s.held)); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, s, 0)
+	expectSent(t, client, 4, 5, 6)
+}
+
+func TestHoldDelaySeconds(t *testing.T) {
+	s, client := newTestSpectator(t)
+	s.delaySeconds = 60
+
+	for n := 1; n <= 3; n++ {
+		if err := s.hold(testMsg{n}, n != 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectHeld(t, s, 3)
+
+	// the moves have no say in seconds mode
+	if err := s.releaseMoves(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.releaseDue(); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, s, 3)
+
+	// the first two are due, the third is not
+	s.held[0].due = time.Now().Add(-time.Second)
+	s.held[1].due = time.Now()
+	if err := s.releaseDue(); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, s, 1)
+	expectSent(t, client, 1, 2)
+
+	s.held[0].due = time.Now().Add(-time.Second)
+	if err := s.releaseDue(); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, s, 0)
+	expectSent(t, client, 3)
+}
@@ -0,0 +1,795 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+	"github.com/vanshjangir/rapid-go/server/internal/database"
+	"github.com/vanshjangir/rapid-go/server/internal/pubsub"
+	"github.com/vanshjangir/rapid-go/server/internal/tournament"
+)
+
+const (
+	TOURNAMENT_REGISTERING = "registering"
+	TOURNAMENT_RUNNING     = "running"
+	TOURNAMENT_FINISHED    = "finished"
+
+	DEFAULT_SWISS_ROUNDS = 5
+	DEFAULT_MCMAHON_BAR  = 1800
+
+	// tournament games are shown to spectators a few moves late
+	DEFAULT_TOURNAMENT_DELAY_MOVES = 3
+
+	// a paired player who has not connected to their game by then forfeits
+	TOURNAMENT_CONNECT_DEADLINE = 3 * time.Minute
+	TOURNAMENT_FORFEIT_CHECK    = 15 * time.Second
+
+	// a game still unfinished this long after both players used up their
+	// main time, like an adjourned one, ends without a winner
+	TOURNAMENT_ROUND_GRACE = 10 * time.Minute
+)
+
+type Tournament struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	Format       string `json:"format"`
+	Rounds       int    `json:"rounds"`
+	McMahonBar   int    `json:"mcmahonBar"`
+	Status       string `json:"status"`
+	CurrentRound int    `json:"currentRound"`
+	CreatedBy    string `json:"createdBy"`
+	core.GameSettings
+}
+
+type TournamentEvent struct {
+	Type      string                `json:"type"`
+	Round     int                   `json:"round"`
+	Games     []tournament.Game     `json:"games"`
+	Standings []tournament.Standing `json:"standings"`
+}
+
+func tournamentChannel(id string) string {
+	return "tournament:" + id
+}
+
+func getTournament(id string) (Tournament, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT id, name, format, rounds, mcmahonbar, status, currentround,
+	createdby, size, maintime
+	FROM tournaments WHERE id = $1`
+
+	var t Tournament
+	err := db.QueryRow(query, id).Scan(
+		&t.Id, &t.Name, &t.Format, &t.Rounds, &t.McMahonBar, &t.Status,
+		&t.CurrentRound, &t.CreatedBy, &t.Size, &t.MainTime,
+	)
+	t.Rated = true
+	return t, err
+}
+
+func getTournamentPlayers(id string) ([]tournament.Player, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT username, rating FROM tournament_players
+	WHERE tournamentid = $1 ORDER BY joined_at`
+
+	var players []tournament.Player
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return players, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p tournament.Player
+		if err := rows.Scan(&p.Username, &p.Rating); err != nil {
+			return players, err
+		}
+		players = append(players, p)
+	}
+	return players, nil
+}
+
+func getTournamentGames(id string) ([]tournament.Game, error) {
+	db := database.GetDatabase()
+	query := `
+	SELECT round, gameid, black, white, COALESCE(winner, -1), done
+	FROM tournament_games
+	WHERE tournamentid = $1 ORDER BY round, board`
+
+	var games []tournament.Game
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return games, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g tournament.Game
+		if err := rows.Scan(
+			&g.Round, &g.GameId, &g.Black, &g.White, &g.Winner, &g.Done,
+		); err != nil {
+			return games, err
+		}
+		games = append(games, g)
+	}
+	return games, nil
+}
+
+func getStandings(t Tournament) ([]tournament.Standing, error) {
+	players, err := getTournamentPlayers(t.Id)
+	if err != nil {
+		return nil, err
+	}
+	games, err := getTournamentGames(t.Id)
+	if err != nil {
+		return nil, err
+	}
+	return tournament.Standings(t.Format, t.McMahonBar, players, games), nil
+}
+
+func publishTournamentEvent(t Tournament, event TournamentEvent) {
+	jsondata, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Error marshalling tournament event:", err)
+		return
+	}
+
+	err = pubsub.Rdb.Publish(
+		pubsub.RdbCtx, tournamentChannel(t.Id), jsondata,
+	).Err()
+	if err != nil {
+		log.Println("Error publishing tournament event:", err)
+	}
+}
+
+func nextPairings(t Tournament, round int) ([]tournament.Pairing, error) {
+	players, err := getTournamentPlayers(t.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Format {
+	case tournament.FORMAT_ROUND_ROBIN:
+		return tournament.RoundRobinPairings(players, round), nil
+
+	case tournament.FORMAT_ELIMINATION:
+		games, err := getTournamentGames(t.Id)
+		if err != nil {
+			return nil, err
+		}
+		return tournament.EliminationPairings(players, games), nil
+
+	default:
+		standings, err := getStandings(t)
+		if err != nil {
+			return nil, err
+		}
+		return tournament.SwissPairings(standings), nil
+	}
+}
+
+func finishTournament(t Tournament) {
+	db := database.GetDatabase()
+	query := "UPDATE tournaments SET status = $2 WHERE id = $1"
+	if _, err := db.Exec(query, t.Id, TOURNAMENT_FINISHED); err != nil {
+		log.Println("Error finishing tournament:", err)
+	}
+
+	standings, err := getStandings(t)
+	if err != nil {
+		log.Println("Error computing standings:", err)
+	}
+	publishTournamentEvent(t, TournamentEvent{
+		Type:      "finished",
+		Round:     t.CurrentRound,
+		Standings: standings,
+	})
+}
+
+// startRound pairs the round and sets up its games the same way matched
+// players are set up by FindGame. Players learn about their game from the
+// tournament channel and then connect to /game as usual.
+func startRound(t Tournament, round int) {
+	pairings, err := nextPairings(t, round)
+	if err != nil {
+		log.Println("Error pairing tournament round:", err)
+		return
+	}
+	if len(pairings) == 0 {
+		finishTournament(t)
+		return
+	}
+
+	db := database.GetDatabase()
+	insertQuery := `
+	INSERT INTO tournament_games
+	(tournamentid, round, board, gameid, black, white, winner, done)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	settings := t.GameSettings
+	if settings.DelayMoves == 0 && settings.DelaySeconds == 0 {
+		settings.DelayMoves = DEFAULT_TOURNAMENT_DELAY_MOVES
+	}
+
+	var games []tournament.Game
+	for i, p := range pairings {
+		g := tournament.Game{
+			Round:  round,
+			GameId: core.GetUniqueId(),
+			Black:  p.Black,
+			White:  p.White,
+			Winner: -1,
+		}
+
+		var winner any
+		if g.IsBye() {
+			g.Winner = core.BlackCell
+			g.Done = true
+			winner = g.Winner
+		} else {
+			RegisterGame(g.GameId, g.Black, g.White, settings)
+		}
+
+		if _, err := db.Exec(
+			insertQuery, t.Id, round, i, g.GameId, g.Black, g.White, winner, g.Done,
+		); err != nil {
+			log.Println("Error adding tournament game:", err)
+		}
+		games = append(games, g)
+	}
+
+	publishTournamentEvent(t, TournamentEvent{
+		Type:  "pairing",
+		Round: round,
+		Games: games,
+	})
+
+	// a round made only of byes is already complete
+	checkRoundComplete(t, round)
+}
+
+func isLastRound(t Tournament, round int) bool {
+	if t.Format == tournament.FORMAT_ELIMINATION {
+		return false
+	}
+	return round >= t.Rounds
+}
+
+// checkRoundComplete moves the tournament to the next round once every game
+// of the current one has a result. The conditional update makes sure only
+// one server advances the round when games end at the same time.
+func checkRoundComplete(t Tournament, round int) {
+	db := database.GetDatabase()
+
+	var pending int
+	query := `
+	SELECT COUNT(*) FROM tournament_games
+	WHERE tournamentid = $1 AND round = $2 AND done = false`
+	if err := db.QueryRow(query, t.Id, round).Scan(&pending); err != nil {
+		log.Println("Error counting pending tournament games:", err)
+		return
+	}
+	if pending > 0 {
+		return
+	}
+
+	if isLastRound(t, round) {
+		finishTournament(t)
+		return
+	}
+
+	updateQuery := `
+	UPDATE tournaments SET currentround = $3
+	WHERE id = $1 AND currentround = $2`
+	res, err := db.Exec(updateQuery, t.Id, round, round+1)
+	if err != nil {
+		log.Println("Error advancing tournament round:", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return
+	}
+
+	t.CurrentRound = round + 1
+	startRound(t, round+1)
+}
+
+// claimTournamentGame stores the result of a tournament game. It returns
+// false when the game is not a tournament game or already has its result,
+// so that a result is only ever recorded once. A negative winner is a double
+// forfeit.
+func claimTournamentGame(gameId string, winner int) (string, int, bool) {
+	db := database.GetDatabase()
+	query := `
+	UPDATE tournament_games SET winner = $2, done = true
+	WHERE gameid = $1 AND done = false
+	RETURNING tournamentid, round`
+
+	var dbWinner any = winner
+	if winner < 0 {
+		dbWinner = nil
+	}
+
+	var tournamentId string
+	var round int
+	if err := db.QueryRow(query, gameId, dbWinner).Scan(
+		&tournamentId, &round,
+	); err != nil {
+		return "", 0, false
+	}
+	return tournamentId, round, true
+}
+
+func announceTournamentResult(
+	tournamentId string, round int, result core.GameResult,
+) {
+	t, err := getTournament(tournamentId)
+	if err != nil {
+		log.Println("Error fetching tournament:", err)
+		return
+	}
+
+	standings, err := getStandings(t)
+	if err != nil {
+		log.Println("Error computing standings:", err)
+	}
+	publishTournamentEvent(t, TournamentEvent{
+		Type:  "result",
+		Round: round,
+		Games: []tournament.Game{{
+			Round:  round,
+			GameId: result.GameId,
+			Black:  result.Black,
+			White:  result.White,
+			Winner: result.Winner,
+			Done:   true,
+		}},
+		Standings: standings,
+	})
+
+	checkRoundComplete(t, round)
+}
+
+// RecordTournamentResult is the game over hook that stores the results of
+// tournament games and pairs the next round.
+func RecordTournamentResult(result core.GameResult) {
+	tournamentId, round, ok := claimTournamentGame(result.GameId, result.Winner)
+	if !ok {
+		// not a tournament game
+		return
+	}
+	announceTournamentResult(tournamentId, round, result)
+}
+
+// forfeitTournamentGame ends a tournament game that a player never
+// connected to. The player who connected, if any, wins and their game is
+// ended as if the absent player had resigned.
+func forfeitTournamentGame(
+	gameId string, black string, white string, blackIn bool, whiteIn bool,
+) {
+	result := core.GameResult{
+		GameId: gameId,
+		Black:  black,
+		White:  white,
+		Winner: -1,
+		WonBy:  "forfeit",
+	}
+	absent := []string{black, white}
+	switch {
+	case blackIn:
+		result.Winner = core.BlackCell
+		absent = []string{white}
+	case whiteIn:
+		result.Winner = core.WhiteCell
+		absent = []string{black}
+	}
+
+	tournamentId, round, ok := claimTournamentGame(gameId, result.Winner)
+	if !ok {
+		// the game ended on its own in the meantime
+		return
+	}
+	log.Printf("Tournament game %s forfeited by %v\n", gameId, absent)
+
+	if result.Winner >= 0 {
+		db := database.GetDatabase()
+		query := "UPDATE games SET winner = $2, wonby = $3 WHERE gameid = $1"
+		if _, err := db.Exec(
+			query, gameId, result.Winner, result.WonBy,
+		); err != nil {
+			log.Println("Error saving forfeited game:", err)
+		}
+
+		gameOverMsg, err := json.Marshal(core.GameOverMsg{
+			Type:    "gameover",
+			Winner:  result.Winner,
+			Message: result.WonBy,
+		})
+		if err != nil {
+			log.Println("Error marshalling gameover msg:", err)
+		}
+		publishJSON(gameId, pubsub.PubsubMsg{
+			Player: absent[0],
+			Type:   "gameover",
+			Data:   gameOverMsg,
+		})
+	} else {
+		pubsub.Rdb.HDel(pubsub.RdbCtx, "live_game", gameId)
+	}
+
+	for _, username := range absent {
+		clearPlayerGame(username, gameId)
+	}
+	unlistGame(gameId)
+
+	announceTournamentResult(tournamentId, round, result)
+}
+
+// clearPlayerGame removes the game entry of the player if it is still the
+// given game.
+func clearPlayerGame(username string, gameId string) {
+	jsondata, err := getPlayerGame(username)
+	if err != nil {
+		return
+	}
+	var userHashData UserHashData
+	if err := json.Unmarshal([]byte(jsondata), &userHashData); err != nil {
+		return
+	}
+	if userHashData.GameId == gameId {
+		pubsub.Rdb.HDel(pubsub.RdbCtx, "live_game", username)
+	}
+}
+
+// expireTournamentGame ends a tournament game that is still unfinished at
+// the round deadline without a winner, so that it cannot hold up the round.
+// An adjourned game can no longer be resumed.
+func expireTournamentGame(gameId string, black string, white string) {
+	result := core.GameResult{
+		GameId: gameId,
+		Black:  black,
+		White:  white,
+		Winner: -1,
+		WonBy:  "unfinished",
+	}
+
+	tournamentId, round, ok := claimTournamentGame(gameId, result.Winner)
+	if !ok {
+		// the game ended on its own in the meantime
+		return
+	}
+	log.Printf("Tournament game %s unfinished at the round deadline\n", gameId)
+
+	db := database.GetDatabase()
+	query := `
+	UPDATE games SET adjourned = false, wonby = $2
+	WHERE gameid = $1 AND winner IS NULL`
+	if _, err := db.Exec(query, gameId, result.WonBy); err != nil {
+		log.Println("Error saving unfinished game:", err)
+	}
+
+	pubsub.Rdb.HDel(pubsub.RdbCtx, "live_game", gameId)
+	clearPlayerGame(black, gameId)
+	clearPlayerGame(white, gameId)
+	unlistGame(gameId)
+
+	announceTournamentResult(tournamentId, round, result)
+}
+
+// RunTournamentForfeits forfeits the tournament games that a player has not
+// connected to within TOURNAMENT_CONNECT_DEADLINE, so that an absent player
+// cannot hold up the round. Players are known to have connected once the
+// game's row names them. Games still unfinished at the round deadline end
+// without a winner.
+func RunTournamentForfeits() {
+	for {
+		forfeitAbsentPlayers()
+		expireUnfinishedGames()
+		time.Sleep(TOURNAMENT_FORFEIT_CHECK)
+	}
+}
+
+// expireUnfinishedGames ends the tournament games that are not over
+// TOURNAMENT_ROUND_GRACE after both players could have used up their main
+// time.
+func expireUnfinishedGames() {
+	db := database.GetDatabase()
+	query := `
+	SELECT tg.gameid, tg.black, tg.white
+	FROM tournament_games tg JOIN tournaments t ON t.id = tg.tournamentid
+	WHERE tg.done = false
+	AND tg.created_at + t.maintime * 2 * INTERVAL '1 millisecond' < $1`
+
+	deadline := time.Now().Add(-TOURNAMENT_ROUND_GRACE)
+	rows, err := db.Query(query, deadline)
+	if err != nil {
+		log.Println("Error fetching unfinished tournament games:", err)
+		return
+	}
+
+	type unfinishedGame struct {
+		gameId, black, white string
+	}
+	var unfinished []unfinishedGame
+	for rows.Next() {
+		var u unfinishedGame
+		if err := rows.Scan(&u.gameId, &u.black, &u.white); err != nil {
+			log.Println("Error reading unfinished tournament game:", err)
+			continue
+		}
+		unfinished = append(unfinished, u)
+	}
+	rows.Close()
+
+	for _, u := range unfinished {
+		expireTournamentGame(u.gameId, u.black, u.white)
+	}
+}
+
+func forfeitAbsentPlayers() {
+	db := database.GetDatabase()
+	query := `
+	SELECT tg.gameid, tg.black, tg.white,
+	COALESCE(g.black, '') = tg.black, COALESCE(g.white, '') = tg.white
+	FROM tournament_games tg LEFT JOIN games g ON g.gameid = tg.gameid
+	WHERE tg.done = false AND tg.created_at < $1`
+
+	deadline := time.Now().Add(-TOURNAMENT_CONNECT_DEADLINE)
+	rows, err := db.Query(query, deadline)
+	if err != nil {
+		log.Println("Error fetching pending tournament games:", err)
+		return
+	}
+
+	type pendingGame struct {
+		gameId, black, white string
+		blackIn, whiteIn     bool
+	}
+	var pending []pendingGame
+	for rows.Next() {
+		var p pendingGame
+		if err := rows.Scan(
+			&p.gameId, &p.black, &p.white, &p.blackIn, &p.whiteIn,
+		); err != nil {
+			log.Println("Error reading pending tournament game:", err)
+			continue
+		}
+		if !p.blackIn || !p.whiteIn {
+			pending = append(pending, p)
+		}
+	}
+	rows.Close()
+
+	for _, p := range pending {
+		forfeitTournamentGame(p.gameId, p.black, p.white, p.blackIn, p.whiteIn)
+	}
+}
+
+func CreateTournament(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	var t Tournament
+	if err := ctx.ShouldBindJSON(&t); err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	switch t.Format {
+	case tournament.FORMAT_SWISS, tournament.FORMAT_MCMAHON:
+		if t.Rounds <= 0 {
+			t.Rounds = DEFAULT_SWISS_ROUNDS
+		}
+		if t.McMahonBar == 0 {
+			t.McMahonBar = DEFAULT_MCMAHON_BAR
+		}
+	case tournament.FORMAT_ROUND_ROBIN, tournament.FORMAT_ELIMINATION:
+		// the number of rounds follows from the number of players
+		t.Rounds = 0
+	default:
+		ctx.JSON(400, gin.H{"error": "Unknown tournament format"})
+		return
+	}
+
+	if err := t.GameSettings.Validate(); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	t.Id = core.GetUniqueId()
+	t.Status = TOURNAMENT_REGISTERING
+	t.CreatedBy = username
+
+	db := database.GetDatabase()
+	insertQuery := `
+	INSERT INTO tournaments
+	(id, name, format, rounds, mcmahonbar, status, currentround, createdby,
+	size, maintime)
+	VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $8, $9)`
+	if _, err := db.Exec(
+		insertQuery, t.Id, t.Name, t.Format, t.Rounds, t.McMahonBar,
+		t.Status, t.CreatedBy, t.Size, t.MainTime,
+	); err != nil {
+		log.Println("Error creating tournament:", err)
+		ctx.JSON(500, gin.H{"error": "Error creating tournament"})
+		return
+	}
+
+	ctx.JSON(200, t)
+}
+
+func RegisterTournament(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	t, err := getTournament(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Tournament not found"})
+		return
+	}
+	if t.Status != TOURNAMENT_REGISTERING {
+		ctx.JSON(400, gin.H{"error": "Registration is closed"})
+		return
+	}
+
+	db := database.GetDatabase()
+	insertQuery := `
+	INSERT INTO tournament_players (tournamentid, username, rating)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING`
+	rating := core.GetRating(username, t.Size, core.SpeedCategory(t.MainTime))
+	if _, err := db.Exec(insertQuery, t.Id, username, rating); err != nil {
+		log.Println("Error registering tournament player:", err)
+		ctx.JSON(500, gin.H{"error": "Error registering player"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"message": "Registered successfully"})
+}
+
+func StartTournament(ctx *gin.Context) {
+	username := getUsername(ctx)
+	if len(username) == 0 {
+		return
+	}
+
+	t, err := getTournament(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Tournament not found"})
+		return
+	}
+	if t.CreatedBy != username {
+		ctx.JSON(403, gin.H{"error": "Only the organiser can start it"})
+		return
+	}
+	if t.Status != TOURNAMENT_REGISTERING {
+		ctx.JSON(400, gin.H{"error": "Tournament has already started"})
+		return
+	}
+
+	players, err := getTournamentPlayers(t.Id)
+	if err != nil || len(players) < 2 {
+		ctx.JSON(400, gin.H{"error": "Not enough players"})
+		return
+	}
+
+	if t.Format == tournament.FORMAT_ROUND_ROBIN {
+		t.Rounds = tournament.RoundRobinRounds(len(players))
+	}
+	t.Status = TOURNAMENT_RUNNING
+	t.CurrentRound = 1
+
+	db := database.GetDatabase()
+	updateQuery := `
+	UPDATE tournaments SET status = $2, currentround = 1, rounds = $3
+	WHERE id = $1 AND status = $4`
+	res, err := db.Exec(
+		updateQuery, t.Id, t.Status, t.Rounds, TOURNAMENT_REGISTERING,
+	)
+	if err != nil {
+		log.Println("Error starting tournament:", err)
+		ctx.JSON(500, gin.H{"error": "Error starting tournament"})
+		return
+	}
+	// only the request that moved it out of registering starts the round
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		ctx.JSON(400, gin.H{"error": "Tournament has already started"})
+		return
+	}
+
+	startRound(t, 1)
+	ctx.JSON(200, t)
+}
+
+func GetTournament(ctx *gin.Context) {
+	t, err := getTournament(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Tournament not found"})
+		return
+	}
+
+	games, err := getTournamentGames(t.Id)
+	if err != nil {
+		log.Println("Error fetching tournament games:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"tournament": t,
+		"games":      games,
+	})
+}
+
+func GetTournamentStandings(ctx *gin.Context) {
+	t, err := getTournament(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Tournament not found"})
+		return
+	}
+
+	standings, err := getStandings(t)
+	if err != nil {
+		log.Println("Error computing standings:", err)
+		ctx.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+	ctx.JSON(200, standings)
+}
+
+// TournamentLive sends the current standings and then streams the pairing,
+// result and finished events of the tournament.
+func TournamentLive(ctx *gin.Context) {
+	w, r := ctx.Writer, ctx.Request
+
+	t, err := getTournament(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Tournament not found"})
+		return
+	}
+
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("TournamentLive:", err)
+		return
+	}
+	defer c.Close()
+
+	ps := pubsub.Rdb.Subscribe(pubsub.RdbCtx, tournamentChannel(t.Id))
+	defer ps.Close()
+
+	if _, err := ps.Receive(pubsub.RdbCtx); err != nil {
+		log.Println("Subscription to tournament channel failed")
+		return
+	}
+
+	standings, err := getStandings(t)
+	if err != nil {
+		log.Println("Error computing standings:", err)
+	}
+	if err := c.WriteJSON(TournamentEvent{
+		Type:      "standings",
+		Round:     t.CurrentRound,
+		Standings: standings,
+	}); err != nil {
+		return
+	}
+
+	for msg := range ps.Channel() {
+		err := c.WriteMessage(websocket.TextMessage, []byte(msg.Payload))
+		if err != nil {
+			log.Println("Error sending tournament event:", err)
+			return
+		}
+	}
+}
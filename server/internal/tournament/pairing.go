@@ -0,0 +1,335 @@
+package tournament
+
+import (
+	"sort"
+
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+)
+
+const (
+	FORMAT_SWISS       = "swiss"
+	FORMAT_MCMAHON     = "mcmahon"
+	FORMAT_ROUND_ROBIN = "roundrobin"
+	FORMAT_ELIMINATION = "elimination"
+)
+
+type Player struct {
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+}
+
+// Game is a tournament game. A bye is stored as a game without a white
+// player that black has won, a double forfeit as a finished game without a
+// winner.
+type Game struct {
+	Round  int    `json:"round"`
+	GameId string `json:"gameId"`
+	Black  string `json:"black"`
+	White  string `json:"white"`
+	Winner int    `json:"winner"`
+	Done   bool   `json:"done"`
+}
+
+type Pairing struct {
+	Black string `json:"black"`
+	White string `json:"white"`
+}
+
+type Standing struct {
+	Rank     int     `json:"rank"`
+	Username string  `json:"username"`
+	Rating   int     `json:"rating"`
+	Score    float64 `json:"score"`
+	Wins     int     `json:"wins"`
+	SOS      float64 `json:"sos"`
+	SODOS    float64 `json:"sodos"`
+
+	opponents  []string
+	defeated   []string
+	blackGames int
+	hadBye     bool
+}
+
+func (g Game) IsBye() bool {
+	return g.White == ""
+}
+
+func (g Game) winnerName() string {
+	if g.Winner == core.BlackCell {
+		return g.Black
+	}
+	return g.White
+}
+
+// mcmahonScore is the score a player starts with in a McMahon tournament:
+// zero at or above the bar and one point less per 100 rating points below.
+func mcmahonScore(rating int, bar int) float64 {
+	if rating >= bar {
+		return 0
+	}
+	return -float64((bar - rating + 99) / 100)
+}
+
+// Standings ranks the players by score, then SOS (sum of the opponents'
+// scores), then SODOS (sum of the defeated opponents' scores) and rating.
+func Standings(
+	format string, mcmahonBar int, players []Player, games []Game,
+) []Standing {
+	byName := make(map[string]*Standing)
+	standings := make([]*Standing, 0, len(players))
+	for _, p := range players {
+		s := &Standing{Username: p.Username, Rating: p.Rating}
+		if format == FORMAT_MCMAHON {
+			s.Score = mcmahonScore(p.Rating, mcmahonBar)
+		}
+		byName[p.Username] = s
+		standings = append(standings, s)
+	}
+
+	for _, g := range games {
+		black, ok := byName[g.Black]
+		if !ok {
+			continue
+		}
+
+		if g.IsBye() {
+			black.hadBye = true
+			black.Score++
+			black.Wins++
+			continue
+		}
+
+		white, ok := byName[g.White]
+		if !ok {
+			continue
+		}
+		black.blackGames++
+		black.opponents = append(black.opponents, g.White)
+		white.opponents = append(white.opponents, g.Black)
+
+		if !g.Done || g.Winner < 0 {
+			continue
+		}
+		winner, loser := black, white
+		if g.Winner == core.WhiteCell {
+			winner, loser = white, black
+		}
+		winner.Score++
+		winner.Wins++
+		winner.defeated = append(winner.defeated, loser.Username)
+	}
+
+	for _, s := range standings {
+		for _, op := range s.opponents {
+			s.SOS += byName[op].Score
+		}
+		for _, op := range s.defeated {
+			s.SODOS += byName[op].Score
+		}
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.SOS != b.SOS {
+			return a.SOS > b.SOS
+		}
+		if a.SODOS != b.SODOS {
+			return a.SODOS > b.SODOS
+		}
+		return a.Rating > b.Rating
+	})
+
+	result := make([]Standing, len(standings))
+	for i, s := range standings {
+		s.Rank = i + 1
+		result[i] = *s
+	}
+	return result
+}
+
+func hasPlayed(s Standing, op string) bool {
+	for _, name := range s.opponents {
+		if name == op {
+			return true
+		}
+	}
+	return false
+}
+
+func colorPairing(a Standing, b Standing) Pairing {
+	// the player who had black less often takes black, the higher ranked
+	// player when both had it equally often
+	if b.blackGames < a.blackGames {
+		return Pairing{Black: b.Username, White: a.Username}
+	}
+	return Pairing{Black: a.Username, White: b.Username}
+}
+
+// SwissPairings pairs players with equal or close scores who have not met
+// yet, top of the standings first. With an odd number of players the lowest
+// ranked player without a bye so far gets one.
+func SwissPairings(standings []Standing) []Pairing {
+	var pairings []Pairing
+	remaining := append([]Standing(nil), standings...)
+
+	if len(remaining)%2 == 1 {
+		bye := len(remaining) - 1
+		for i := len(remaining) - 1; i >= 0; i-- {
+			if !remaining[i].hadBye {
+				bye = i
+				break
+			}
+		}
+		pairings = append(pairings, Pairing{Black: remaining[bye].Username})
+		remaining = append(remaining[:bye], remaining[bye+1:]...)
+	}
+
+	paired := make([]bool, len(remaining))
+	for i := range remaining {
+		if paired[i] {
+			continue
+		}
+
+		op := -1
+		for j := i + 1; j < len(remaining); j++ {
+			if paired[j] {
+				continue
+			}
+			if op == -1 {
+				op = j
+			}
+			if !hasPlayed(remaining[i], remaining[j].Username) {
+				op = j
+				break
+			}
+		}
+		if op == -1 {
+			continue
+		}
+
+		paired[i], paired[op] = true, true
+		pairings = append(pairings, colorPairing(remaining[i], remaining[op]))
+	}
+	return pairings
+}
+
+// RoundRobinRounds is the number of rounds needed for everyone to meet.
+func RoundRobinRounds(players int) int {
+	if players%2 == 1 {
+		return players
+	}
+	return players - 1
+}
+
+// RoundRobinPairings returns the pairings of a round (starting at 1) using
+// the circle method, with players in registration order.
+func RoundRobinPairings(players []Player, round int) []Pairing {
+	names := make([]string, 0, len(players)+1)
+	for _, p := range players {
+		names = append(names, p.Username)
+	}
+	if len(names)%2 == 1 {
+		// an empty name stands for the bye
+		names = append(names, "")
+	}
+
+	n := len(names)
+	if n < 2 {
+		return nil
+	}
+
+	// the first player stays fixed and the others rotate by one each round
+	rotated := []string{names[0]}
+	for i := 0; i < n-1; i++ {
+		rotated = append(rotated, names[1+(i+round-1)%(n-1)])
+	}
+
+	var pairings []Pairing
+	for i := 0; i < n/2; i++ {
+		a, b := rotated[i], rotated[n-1-i]
+		if a == "" {
+			a, b = b, a
+		}
+		if b == "" {
+			pairings = append(pairings, Pairing{Black: a})
+			continue
+		}
+		if (round+i)%2 == 0 {
+			a, b = b, a
+		}
+		pairings = append(pairings, Pairing{Black: a, White: b})
+	}
+	return pairings
+}
+
+// EliminationPairings pairs the first round by seed, the best against the
+// worst, and later rounds by pairing the winners of neighbouring games of
+// the previous round. A double forfeit knocks out both players. With an odd
+// number of players left, the bye goes to the first of them who has not
+// had one yet. It returns no pairings once a single player is left.
+func EliminationPairings(players []Player, games []Game) []Pairing {
+	last := 0
+	hadBye := make(map[string]bool)
+	for _, g := range games {
+		if g.Round > last {
+			last = g.Round
+		}
+		if g.IsBye() {
+			hadBye[g.Black] = true
+		}
+	}
+
+	if last == 0 {
+		seeded := append([]Player(nil), players...)
+		sort.SliceStable(seeded, func(i, j int) bool {
+			return seeded[i].Rating > seeded[j].Rating
+		})
+
+		var pairings []Pairing
+		if len(seeded)%2 == 1 {
+			pairings = append(pairings, Pairing{Black: seeded[0].Username})
+			seeded = seeded[1:]
+		}
+		for i := 0; i < len(seeded)/2; i++ {
+			pairings = append(pairings, Pairing{
+				Black: seeded[i].Username,
+				White: seeded[len(seeded)-1-i].Username,
+			})
+		}
+		return pairings
+	}
+
+	var alive []string
+	for _, g := range games {
+		switch {
+		case g.Round != last:
+		case g.IsBye():
+			alive = append(alive, g.Black)
+		case g.Winner >= 0:
+			alive = append(alive, g.winnerName())
+		}
+	}
+	if len(alive) < 2 {
+		return nil
+	}
+
+	var pairings []Pairing
+	if len(alive)%2 == 1 {
+		bye := 0
+		for i, name := range alive {
+			if !hadBye[name] {
+				bye = i
+				break
+			}
+		}
+		pairings = append(pairings, Pairing{Black: alive[bye]})
+		alive = append(alive[:bye], alive[bye+1:]...)
+	}
+	for i := 0; i+1 < len(alive); i += 2 {
+		pairings = append(pairings, Pairing{Black: alive[i], White: alive[i+1]})
+	}
+	return pairings
+}
@@ -0,0 +1,285 @@
+package tournament
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vanshjangir/rapid-go/server/internal/core"
+)
+
+var fourPlayers = []Player{
+	{Username: "a", Rating: 2000},
+	{Username: "b", Rating: 1900},
+	{Username: "c", Rating: 1800},
+	{Username: "d", Rating: 1700},
+}
+
+var threePlayers = fourPlayers[:3]
+
+func TestSwissPairings(t *testing.T) {
+	tests := []struct {
+		name    string
+		players []Player
+		games   []Game
+		want    []Pairing
+	}{
+		{
+			name:    "first round by rating",
+			players: fourPlayers,
+			want:    []Pairing{{Black: "a", White: "b"}, {Black: "c", White: "d"}},
+		},
+		{
+			name:    "winners meet",
+			players: fourPlayers,
+			games: []Game{
+				{Round: 1, Black: "a", White: "b", Winner: core.BlackCell, Done: true},
+				{Round: 1, Black: "c", White: "d", Winner: core.BlackCell, Done: true},
+			},
+			want: []Pairing{{Black: "a", White: "c"}, {Black: "b", White: "d"}},
+		},
+		{
+			name:    "no rematches",
+			players: fourPlayers,
+			games: []Game{
+				{Round: 1, Black: "a", White: "b", Winner: -1},
+				{Round: 1, Black: "c", White: "d", Winner: -1},
+			},
+			want: []Pairing{{Black: "a", White: "c"}, {Black: "b", White: "d"}},
+		},
+		{
+			name:    "bye to the lowest ranked",
+			players: threePlayers,
+			want:    []Pairing{{Black: "c"}, {Black: "a", White: "b"}},
+		},
+		{
+			name:    "no second bye",
+			players: threePlayers,
+			games: []Game{
+				{Round: 1, Black: "c", Winner: core.BlackCell, Done: true},
+				{Round: 1, Black: "a", White: "b", Winner: -1, Done: true},
+			},
+			want: []Pairing{{Black: "b"}, {Black: "c", White: "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			standings := Standings(FORMAT_SWISS, 0, tt.players, tt.games)
+			got := SwissPairings(standings)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SwissPairings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStandings(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     string
+		mcmahonBar int
+		players    []Player
+		games      []Game
+		want       []string
+		scores     []float64
+	}{
+		{
+			name:    "swiss by score",
+			format:  FORMAT_SWISS,
+			players: fourPlayers[:2],
+			games: []Game{
+				{Round: 1, Black: "a", White: "b", Winner: core.WhiteCell, Done: true},
+			},
+			want:   []string{"b", "a"},
+			scores: []float64{1, 0},
+		},
+		{
+			name:    "double forfeit scores nothing",
+			format:  FORMAT_SWISS,
+			players: fourPlayers[:2],
+			games: []Game{
+				{Round: 1, Black: "a", White: "b", Winner: -1, Done: true},
+			},
+			want:   []string{"a", "b"},
+			scores: []float64{0, 0},
+		},
+		{
+			name:       "mcmahon start scores",
+			format:     FORMAT_MCMAHON,
+			mcmahonBar: 1900,
+			players:    fourPlayers,
+			want:       []string{"a", "b", "c", "d"},
+			scores:     []float64{0, 0, -1, -2},
+		},
+		{
+			name:       "mcmahon win below the bar",
+			format:     FORMAT_MCMAHON,
+			mcmahonBar: 1900,
+			players:    fourPlayers,
+			games: []Game{
+				{Round: 1, Black: "a", White: "d", Winner: core.WhiteCell, Done: true},
+				{Round: 1, Black: "b", White: "c", Winner: core.WhiteCell, Done: true},
+			},
+			want:   []string{"b", "c", "a", "d"},
+			scores: []float64{0, 0, 0, -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			standings := Standings(tt.format, tt.mcmahonBar, tt.players, tt.games)
+			var names []string
+			var scores []float64
+			for i, s := range standings {
+				if s.Rank != i+1 {
+					t.Errorf("rank of %s = %d, want %d", s.Username, s.Rank, i+1)
+				}
+				names = append(names, s.Username)
+				scores = append(scores, s.Score)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("order = %v, want %v", names, tt.want)
+			}
+			if !reflect.DeepEqual(scores, tt.scores) {
+				t.Errorf("scores = %v, want %v", scores, tt.scores)
+			}
+		})
+	}
+}
+
+func TestMcMahonScore(t *testing.T) {
+	tests := []struct {
+		rating int
+		want   float64
+	}{
+		{2000, 0},
+		{1800, 0},
+		{1750, -1},
+		{1700, -1},
+		{1699, -2},
+		{1500, -3},
+	}
+
+	for _, tt := range tests {
+		if got := mcmahonScore(tt.rating, 1800); got != tt.want {
+			t.Errorf("mcmahonScore(%d, 1800) = %v, want %v", tt.rating, got, tt.want)
+		}
+	}
+}
+
+func TestRoundRobinPairings(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e", "f", "g"}
+
+	for n := 2; n <= len(names); n++ {
+		var players []Player
+		for _, name := range names[:n] {
+			players = append(players, Player{Username: name})
+		}
+
+		met := make(map[[2]string]int)
+		for round := 1; round <= RoundRobinRounds(n); round++ {
+			seen := make(map[string]bool)
+			for _, p := range RoundRobinPairings(players, round) {
+				for _, name := range []string{p.Black, p.White} {
+					if name == "" {
+						continue
+					}
+					if seen[name] {
+						t.Fatalf("%d players, round %d: %s plays twice", n, round, name)
+					}
+					seen[name] = true
+				}
+				if p.White == "" {
+					continue
+				}
+				pair := [2]string{p.Black, p.White}
+				if pair[0] > pair[1] {
+					pair[0], pair[1] = pair[1], pair[0]
+				}
+				met[pair]++
+			}
+			if len(seen) != n {
+				t.Fatalf("%d players, round %d: %d players paired", n, round, len(seen))
+			}
+		}
+
+		if want := n * (n - 1) / 2; len(met) != want {
+			t.Errorf("%d players: %d pairs met, want %d", n, len(met), want)
+		}
+		for pair, times := range met {
+			if times != 1 {
+				t.Errorf("%d players: %v met %d times", n, pair, times)
+			}
+		}
+	}
+}
+
+func TestEliminationPairings(t *testing.T) {
+	fivePlayers := append([]Player{{Username: "e", Rating: 1600}}, fourPlayers...)
+
+	round1 := []Game{
+		{Round: 1, Black: "a", Winner: core.BlackCell, Done: true},
+		{Round: 1, Black: "b", White: "e", Winner: core.BlackCell, Done: true},
+		{Round: 1, Black: "c", White: "d", Winner: core.WhiteCell, Done: true},
+	}
+	round2 := append(round1,
+		Game{Round: 2, Black: "b", Winner: core.BlackCell, Done: true},
+		Game{Round: 2, Black: "a", White: "d", Winner: core.BlackCell, Done: true},
+	)
+
+	tests := []struct {
+		name    string
+		players []Player
+		games   []Game
+		want    []Pairing
+	}{
+		{
+			name:    "seeded first round",
+			players: fourPlayers,
+			want:    []Pairing{{Black: "a", White: "d"}, {Black: "b", White: "c"}},
+		},
+		{
+			name:    "bye to the top seed",
+			players: fivePlayers,
+			want: []Pairing{
+				{Black: "a"}, {Black: "b", White: "e"}, {Black: "c", White: "d"},
+			},
+		},
+		{
+			name:    "bye moves on",
+			players: fivePlayers,
+			games:   round1,
+			want:    []Pairing{{Black: "b"}, {Black: "a", White: "d"}},
+		},
+		{
+			name:    "final",
+			players: fivePlayers,
+			games:   round2,
+			want:    []Pairing{{Black: "b", White: "a"}},
+		},
+		{
+			name:    "finished",
+			players: fivePlayers,
+			games: append(round2,
+				Game{Round: 3, Black: "b", White: "a", Winner: core.WhiteCell, Done: true},
+			),
+		},
+		{
+			name:    "double forfeit knocks out both",
+			players: fourPlayers,
+			games: []Game{
+				{Round: 1, Black: "a", White: "d", Winner: -1, Done: true},
+				{Round: 1, Black: "b", White: "c", Winner: core.BlackCell, Done: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EliminationPairings(tt.players, tt.games)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EliminationPairings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}